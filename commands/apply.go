@@ -0,0 +1,513 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/lvrach/smp/definitions"
+	"github.com/lvrach/smp/internal/build"
+	"github.com/lvrach/smp/internal/config"
+	"github.com/lvrach/smp/internal/docker"
+	"github.com/lvrach/smp/internal/host"
+	"github.com/lvrach/smp/internal/manifest"
+	"github.com/lvrach/smp/internal/prompt"
+	"github.com/lvrach/smp/internal/state"
+	"github.com/urfave/cli/v2"
+)
+
+// applyAction is what smp apply does to converge one MCP
+type applyAction string
+
+const (
+	actionInstall   applyAction = "install"
+	actionUpgrade   applyAction = "upgrade"
+	actionConfigure applyAction = "configure"
+	actionRemove    applyAction = "remove"
+)
+
+// applyStep is one MCP in the plan of smp apply
+type applyStep struct {
+	Action    applyAction
+	Entry     *manifest.MCP
+	Config    *config.MCPConfig
+	State     *state.MCPServer
+	Repo      *definitions.MCPRepository
+	Version   string
+	Installed string
+}
+
+// ApplyCommand returns the command for converging installed MCPs to a team manifest
+func ApplyCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "apply",
+		Usage: "Install, upgrade and remove MCPs to match a team manifest",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "file",
+				Aliases: []string{"f"},
+				Usage:   "Path of the manifest",
+				Value:   manifest.DefaultFile,
+			},
+			&cli.BoolFlag{
+				Name:  "update",
+				Usage: "Ignore the lockfile and resolve the latest image or commit of unpinned MCPs",
+			},
+			&cli.BoolFlag{
+				Name:  "prune",
+				Usage: "Also uninstall installed MCPs the manifest doesn't declare",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Only print what would change",
+			},
+			&cli.BoolFlag{
+				Name:    "yes",
+				Aliases: []string{"y"},
+				Usage:   "Apply without asking for confirmation",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			manifestPath := c.String("file")
+
+			m, err := manifest.Load(manifestPath)
+			if err != nil {
+				return err
+			}
+
+			lockPath := manifest.LockPath(manifestPath)
+			lock, err := manifest.LoadLock(lockPath)
+			if err != nil {
+				return err
+			}
+
+			stateManager, err := state.NewHomeStore()
+			if err != nil {
+				return fmt.Errorf("creating state manager: %w", err)
+			}
+
+			steps, err := applyPlan(stateManager, m, lock, c.Bool("update"), c.Bool("prune"), c.Bool("project"))
+			if err != nil {
+				return err
+			}
+
+			fmt.Println("Plan:")
+			for _, step := range steps {
+				fmt.Printf("  %s\n", step.describe())
+				// Secrets are read from wherever the manifest points, show where
+				for _, name := range sortedKeys(step.secrets()) {
+					fmt.Printf("      secret %s from %s\n", name, step.Entry.Secrets[name])
+				}
+			}
+
+			if c.Bool("dry-run") {
+				return nil
+			}
+
+			if !c.Bool("yes") {
+				ok, err := prompt.Confirm("Apply?", true)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return nil
+				}
+			}
+
+			hostManager := host.DefaultManager()
+			for _, step := range steps {
+				name := step.State.Name
+
+				if step.Action == actionRemove {
+					fmt.Printf("\nRemoving %s\n", name)
+					if err := uninstallMCP(stateManager, step.State); err != nil {
+						return fmt.Errorf("removing %s: %w", name, err)
+					}
+					delete(lock.MCPs, name)
+					continue
+				}
+
+				fmt.Printf("\nApplying %s\n", name)
+				if err := applyMCP(stateManager, hostManager, step, m.SecretStore); err != nil {
+					return fmt.Errorf("applying %s: %w", name, err)
+				}
+				lock.MCPs[name] = lockEntry(step.Config, step.State)
+			}
+
+			// Entries of MCPs removed from the manifest are stale even when not pruned
+			for name := range lock.MCPs {
+				if m.Get(name) == nil {
+					delete(lock.MCPs, name)
+				}
+			}
+
+			if err := lock.Save(lockPath); err != nil {
+				return err
+			}
+
+			fmt.Printf("\nApplied %s, versions locked in %s\n", manifestPath, lockPath)
+			return nil
+		},
+	}
+}
+
+// applyPlan works out what each MCP needs to match the manifest. With project,
+// MCPs that aren't installed yet may come from the project definitions of the
+// current directory.
+func applyPlan(stateManager *state.Store, m *manifest.Manifest, lock *manifest.Lock, update, prune, project bool) ([]applyStep, error) {
+	var steps []applyStep
+
+	for i := range m.MCPs {
+		entry := &m.MCPs[i]
+
+		mcpState, err := stateManager.Load(entry.Name)
+		if err != nil {
+			return nil, fmt.Errorf("loading MCP state: %w", err)
+		}
+
+		repo := definitionRepository(mcpState)
+		if project && !mcpState.Installed() {
+			if err := repo.AddProject(); err != nil {
+				return nil, err
+			}
+		}
+		mcpConfig, err := repo.MCPConfig(entry.Name)
+		if err != nil {
+			return nil, fmt.Errorf("getting MCP configuration: %w", err)
+		}
+
+		var locked *manifest.LockedMCP
+		if lockedMCP, exists := lock.MCPs[entry.Name]; exists && !update {
+			locked = &lockedMCP
+		}
+
+		version, err := pinVersion(repo, mcpConfig, entry, locked, update)
+		if err != nil {
+			return nil, fmt.Errorf("resolving version of %s: %w", entry.Name, err)
+		}
+
+		step := applyStep{
+			Entry:     entry,
+			Config:    mcpConfig,
+			State:     mcpState,
+			Repo:      repo,
+			Version:   version,
+			Installed: installedVersion(mcpConfig, mcpState),
+		}
+
+		switch {
+		case !mcpState.Installed():
+			step.Action = actionInstall
+		case version != "" && version != step.Installed:
+			step.Action = actionUpgrade
+		default:
+			step.Action = actionConfigure
+		}
+
+		steps = append(steps, step)
+	}
+
+	if !prune {
+		return steps, nil
+	}
+
+	states, err := stateManager.List()
+	if err != nil {
+		return nil, fmt.Errorf("listing installed MCPs: %w", err)
+	}
+	for _, mcpState := range states {
+		if mcpState.Installed() && m.Get(mcpState.Name) == nil {
+			steps = append(steps, applyStep{Action: actionRemove, State: mcpState})
+		}
+	}
+
+	return steps, nil
+}
+
+// pinVersion points the MCP's configuration at the version the manifest, the lock
+// or, with update, the latest release asks for and returns that commit or digest.
+// An empty version means any installed version is fine.
+func pinVersion(repo *definitions.MCPRepository, mcpConfig *config.MCPConfig, entry *manifest.MCP, locked *manifest.LockedMCP, update bool) (string, error) {
+	switch mcpConfig.Strategy() {
+	case config.StrategyRepository:
+		commit := entry.Commit
+		if commit == "" && locked != nil && locked.Repository == mcpConfig.Repository {
+			commit = locked.Commit
+		}
+		if commit == "" && update {
+			builder, err := build.NewBuilder(repo, mcpConfig)
+			if err != nil {
+				return "", fmt.Errorf("creating builder: %w", err)
+			}
+			defer builder.CleanUp()
+
+			commit, err = builder.LatestCommit()
+			if err != nil {
+				return "", err
+			}
+		}
+		if commit != "" {
+			mcpConfig.Commit = commit
+		}
+		return commit, nil
+
+	case config.StrategyImage:
+		repository := docker.Repository(mcpConfig.Image)
+		digest := entry.Digest
+		if digest == "" && locked != nil && locked.Image == repository {
+			digest = locked.Digest
+		}
+		if digest == "" && update {
+			// Asked of the registry, so planning pulls nothing, not even for --dry-run
+			var err error
+			digest, err = docker.RemoteDigest(mcpConfig.Image)
+			if err != nil {
+				return "", fmt.Errorf("failed to resolve digest of %s: %w", mcpConfig.Image, err)
+			}
+		}
+		if digest != "" {
+			mcpConfig.Image = repository + "@" + digest
+		}
+		return digest, nil
+
+	case config.StrategyRegistry:
+		version := entry.Version
+		if version == "" && locked != nil && locked.Package == registryPackage(mcpConfig) {
+			version = locked.Version
+		}
+		if version == "" && update {
+			builder, err := build.NewBuilder(repo, mcpConfig)
+			if err != nil {
+				return "", fmt.Errorf("creating builder: %w", err)
+			}
+			defer builder.CleanUp()
+
+			version, err = builder.LatestVersion()
+			if err != nil {
+				return "", err
+			}
+		}
+		if version != "" {
+			mcpConfig.Version = version
+		}
+		return version, nil
+
+	case config.StrategyLocal, config.StrategyBuilder:
+		// Local sources are whatever is on disk and packages are versioned by
+		// their definition, there is no commit or digest to pin
+		return "", nil
+	}
+
+	return "", fmt.Errorf("not sure how to build the image for MCP '%s'", mcpConfig.Name)
+}
+
+// installedVersion returns the commit or digest an installed MCP runs
+func installedVersion(mcpConfig *config.MCPConfig, mcpState *state.MCPServer) string {
+	switch mcpConfig.Strategy() {
+	case config.StrategyRepository:
+		return mcpState.SourceCommit
+	case config.StrategyRegistry:
+		return mcpState.PackageVersion
+	}
+	return mcpState.ImageDigest
+}
+
+// applyMCP installs or upgrades an MCP as planned and applies the manifest's settings
+func applyMCP(stateManager *state.Store, hostManager *host.Manager, step applyStep, secretStore string) error {
+	mcpConfig, mcpState, entry := step.Config, step.State, step.Entry
+
+	switch step.Action {
+	case actionUpgrade:
+		keepPreviousImage(mcpState)
+		fallthrough
+	case actionInstall:
+		if err := installImage(step.Repo, mcpConfig, mcpState, false); err != nil {
+			return err
+		}
+	}
+
+	if mcpState.SecretStore == "" && secretStore != "" {
+		mcpState.SecretStore = secretStore
+	}
+
+	if err := applySettings(mcpConfig, mcpState, entry); err != nil {
+		return err
+	}
+
+	// Ask for whatever the manifest leaves open, such as personal tokens
+	if err := prompt.PromptEnvironmentVariables(mcpConfig, mcpState); err != nil {
+		return fmt.Errorf("getting environment variables: %w", err)
+	}
+
+	if err := applyHosts(hostManager, mcpState, entry.Hosts); err != nil {
+		return err
+	}
+
+	if err := stateManager.Save(mcpState); err != nil {
+		return fmt.Errorf("saving MCP state: %w", err)
+	}
+
+	return nil
+}
+
+// applySettings stores the features, environment variables, secrets and tool
+// policy the manifest declares for an MCP
+func applySettings(mcpConfig *config.MCPConfig, mcpState *state.MCPServer, entry *manifest.MCP) error {
+	if len(entry.Features) > 0 {
+		if err := mcpConfig.ValidateFeatures(entry.Features); err != nil {
+			return err
+		}
+		mcpState.Features = entry.Features
+	}
+
+	if entry.Tools != nil {
+		mcpState.Tools = entry.Tools
+	}
+
+	for _, name := range sortedKeys(entry.Env) {
+		envVar := findVariable(mcpConfig.EnvironmentVars, name)
+		if envVar == nil {
+			return fmt.Errorf("unknown environment variable %s", name)
+		}
+		if envVar.IsSecret() {
+			return fmt.Errorf("%s is a secret, declare it under secrets", name)
+		}
+		if err := envVar.Validate(entry.Env[name]); err != nil {
+			return err
+		}
+		mcpState.SetEnvironmentVariable(name, entry.Env[name])
+	}
+
+	for _, name := range sortedKeys(entry.Secrets) {
+		envVar := findVariable(mcpConfig.EnvironmentVars, name)
+		if envVar == nil {
+			return fmt.Errorf("unknown environment variable %s", name)
+		}
+		value, err := manifest.ResolveSecret(entry.Secrets[name])
+		if err != nil {
+			return fmt.Errorf("resolving secret %s: %w", name, err)
+		}
+		if err := envVar.Validate(value); err != nil {
+			return err
+		}
+		if err := prompt.StoreVariable(mcpConfig, mcpState, *envVar, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyHosts configures the MCP in exactly the given hosts, or in every available
+// host when none are given
+func applyHosts(hostManager *host.Manager, mcpState *state.MCPServer, hosts []string) error {
+	explicit := len(hosts) > 0
+	if !explicit {
+		var err error
+		hosts, err = hostManager.List()
+		if err != nil {
+			return fmt.Errorf("listing available hosts: %w", err)
+		}
+	}
+
+	var missing []string
+	for _, h := range hosts {
+		if !contains(mcpState.ConfiguredHosts, h) {
+			missing = append(missing, h)
+		}
+	}
+	connectHosts(hostManager, mcpState, missing)
+
+	if !explicit {
+		return nil
+	}
+
+	for _, h := range append([]string(nil), mcpState.ConfiguredHosts...) {
+		if contains(hosts, h) {
+			continue
+		}
+		fmt.Printf("  Removing from %s... ", h)
+		if _, err := hostManager.Disconnect(h, mcpState.Name); err != nil {
+			return fmt.Errorf("disconnecting from host %q: %w", h, err)
+		}
+		mcpState.RemoveConfiguredHost(h)
+		fmt.Println("done")
+	}
+
+	return nil
+}
+
+// lockEntry records the version an MCP was applied at
+func lockEntry(mcpConfig *config.MCPConfig, mcpState *state.MCPServer) manifest.LockedMCP {
+	switch mcpConfig.Strategy() {
+	case config.StrategyRepository:
+		return manifest.LockedMCP{
+			Repository: mcpConfig.Repository,
+			Commit:     mcpState.SourceCommit,
+		}
+	case config.StrategyImage:
+		return manifest.LockedMCP{
+			Image:  docker.Repository(mcpConfig.Image),
+			Digest: mcpState.ImageDigest,
+		}
+	case config.StrategyRegistry:
+		return manifest.LockedMCP{
+			Package: registryPackage(mcpConfig),
+			Version: mcpState.PackageVersion,
+		}
+	}
+	return manifest.LockedMCP{}
+}
+
+// registryPackage identifies a registry package in the lockfile, e.g. npm:@org/server
+func registryPackage(mcpConfig *config.MCPConfig) string {
+	kind, pkg := mcpConfig.RegistryPackage()
+	return kind + ":" + pkg
+}
+
+// describe summarises a plan step on one line
+func (s applyStep) describe() string {
+	name := s.State.Name
+	switch s.Action {
+	case actionInstall:
+		if s.Version == "" {
+			return fmt.Sprintf("+ %s: install latest", name)
+		}
+		return fmt.Sprintf("+ %s: install %s", name, shortVersion(s.Version))
+	case actionUpgrade:
+		return fmt.Sprintf("~ %s: upgrade %s -> %s", name, orDash(shortVersion(s.Installed)), shortVersion(s.Version))
+	case actionRemove:
+		return fmt.Sprintf("- %s: uninstall", name)
+	}
+	return fmt.Sprintf("  %s: configure (at %s)", name, orDash(shortVersion(s.Installed)))
+}
+
+// secrets returns the secret references of the manifest the step resolves
+func (s applyStep) secrets() map[string]string {
+	if s.Action == actionRemove || s.Entry == nil {
+		return nil
+	}
+	return s.Entry.Secrets
+}
+
+// shortVersion abbreviates a commit or digest for display
+func shortVersion(version string) string {
+	return shortCommit(shortDigest(version))
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
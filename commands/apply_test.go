@@ -0,0 +1,154 @@
+package commands
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lvrach/smp/internal/manifest"
+	"github.com/lvrach/smp/internal/state"
+)
+
+var (
+	digestA = "sha256:" + strings.Repeat("a", 64)
+	digestB = "sha256:" + strings.Repeat("b", 64)
+)
+
+// planFixture sets up a home with image definitions pulled from a local
+// registry whose tags point at digestB, and returns the state store
+func planFixture(t *testing.T) *state.Store {
+	t.Helper()
+
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead || !strings.HasSuffix(r.URL.Path, "/manifests/1.0") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", digestB)
+	}))
+	t.Cleanup(registry.Close)
+	host := strings.TrimPrefix(registry.URL, "http://")
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	// docker is not on the PATH, planning must not pull
+	t.Setenv("PATH", t.TempDir())
+
+	definitionsDir := filepath.Join(home, ".smp", "definitions")
+	if err := os.MkdirAll(definitionsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"fresh", "stale", "current", "gone"} {
+		definition := "name: " + name + "\nimage: " + host + "/org/" + name + ":1.0\n"
+		if err := os.WriteFile(filepath.Join(definitionsDir, name+".yaml"), []byte(definition), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stateManager, err := state.NewStore(filepath.Join(home, ".smp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, digest := range map[string]string{"stale": digestA, "current": digestB, "gone": digestA} {
+		if err := stateManager.Save(&state.MCPServer{Name: name, LocalImageTag: "mcp-" + name, ImageDigest: digest}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return stateManager
+}
+
+func TestApplyPlan(t *testing.T) {
+	stateManager := planFixture(t)
+	m := &manifest.Manifest{MCPs: []manifest.MCP{
+		{Name: "fresh", Secrets: map[string]string{"TOKEN": "file:~/.token"}},
+		{Name: "stale"},
+		{Name: "current"},
+	}}
+
+	tests := []struct {
+		name   string
+		update bool
+		prune  bool
+		want   map[string]applyAction
+	}{
+		{
+			name: "unpinned",
+			want: map[string]applyAction{"fresh": actionInstall, "stale": actionConfigure, "current": actionConfigure},
+		},
+		{
+			name:   "update",
+			update: true,
+			want:   map[string]applyAction{"fresh": actionInstall, "stale": actionUpgrade, "current": actionConfigure},
+		},
+		{
+			name:   "prune",
+			update: true,
+			prune:  true,
+			want:   map[string]applyAction{"fresh": actionInstall, "stale": actionUpgrade, "current": actionConfigure, "gone": actionRemove},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lock := &manifest.Lock{MCPs: map[string]manifest.LockedMCP{}}
+
+			steps, err := applyPlan(stateManager, m, lock, tt.update, tt.prune, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]applyAction)
+			for _, step := range steps {
+				got[step.State.Name] = step.Action
+				if step.Action != actionRemove && tt.update && step.Version != digestB {
+					t.Errorf("%s planned at %q, want the registry's digest %s", step.State.Name, step.Version, digestB)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("planned %v, want %v", got, tt.want)
+			}
+			for name, action := range tt.want {
+				if got[name] != action {
+					t.Errorf("%s planned to %s, want %s", name, got[name], action)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyPlanUsesLock(t *testing.T) {
+	stateManager := planFixture(t)
+	m := &manifest.Manifest{MCPs: []manifest.MCP{{Name: "current"}}}
+	lock := &manifest.Lock{MCPs: map[string]manifest.LockedMCP{}}
+
+	steps, err := applyPlan(stateManager, m, lock, false, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repository := strings.TrimSuffix(steps[0].Config.Image, ":1.0")
+	lock.MCPs["current"] = manifest.LockedMCP{Image: repository, Digest: digestA}
+
+	steps, err = applyPlan(stateManager, m, lock, false, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 1 || steps[0].Action != actionUpgrade || steps[0].Version != digestA {
+		t.Errorf("planned %+v, want an upgrade to the locked digest", steps[0])
+	}
+	if steps[0].Config.Image != repository+"@"+digestA {
+		t.Errorf("image %s not pinned to the locked digest", steps[0].Config.Image)
+	}
+}
+
+func TestApplyStepSecrets(t *testing.T) {
+	entry := &manifest.MCP{Name: "fresh", Secrets: map[string]string{"TOKEN": "file:~/.token"}}
+
+	if got := (applyStep{Action: actionInstall, Entry: entry}).secrets(); got["TOKEN"] != "file:~/.token" {
+		t.Errorf("install step secrets %v, want the manifest's references", got)
+	}
+	if got := (applyStep{Action: actionRemove, State: &state.MCPServer{Name: "gone"}}).secrets(); got != nil {
+		t.Errorf("remove step secrets %v, want none", got)
+	}
+}
@@ -0,0 +1,83 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/lvrach/smp/internal/pin"
+	"github.com/lvrach/smp/internal/state"
+	"github.com/urfave/cli/v2"
+)
+
+// ApproveCommand returns the command for approving changed tool definitions of an MCP
+func ApproveCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "approve",
+		Usage:     "Approve the changed tools, prompts and resources of an MCP",
+		ArgsUsage: "[name]",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "mode",
+				Usage: "Only set what smp run does with unapproved changes from now on: block or warn",
+			},
+			&cli.BoolFlag{
+				Name:  "reset",
+				Usage: "Forget all pins, the next run pins the definitions it sees",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.NArg() < 1 {
+				return fmt.Errorf("missing required argument: name")
+			}
+
+			name := c.Args().Get(0)
+
+			stateManager, err := state.NewHomeStore()
+			if err != nil {
+				return fmt.Errorf("creating state manager: %w", err)
+			}
+
+			mcpState, err := stateManager.Load(name)
+			if err != nil {
+				return fmt.Errorf("loading MCP state: %w", err)
+			}
+
+			if !mcpState.Installed() {
+				return fmt.Errorf("MCP '%s' is not installed", name)
+			}
+
+			switch mode := c.String("mode"); mode {
+			case "":
+			case pin.ModeBlock, pin.ModeWarn:
+				mcpState.PinMode = mode
+				fmt.Printf("Changes to the definitions of '%s' will %s from now on\n", name, map[string]string{
+					pin.ModeBlock: "be blocked until approved",
+					pin.ModeWarn:  "only be reported",
+				}[mode])
+			default:
+				return fmt.Errorf("unknown mode %q, expected block or warn", mode)
+			}
+
+			switch changes := pin.Pending(mcpState); {
+			case c.Bool("reset"):
+				mcpState.Pins = nil
+				mcpState.PendingPins = nil
+				fmt.Printf("Forgot the pins of '%s', the next run pins its definitions again\n", name)
+			case c.String("mode") != "":
+				// Only the mode changes
+			case len(changes) > 0:
+				for _, change := range changes {
+					fmt.Printf("  %s\n", change)
+				}
+				pin.Approve(mcpState)
+				fmt.Printf("Approved %d change(s) of '%s'\n", len(changes), name)
+			default:
+				fmt.Printf("No changes of '%s' await approval\n", name)
+			}
+
+			if err := stateManager.Save(mcpState); err != nil {
+				return fmt.Errorf("saving MCP state: %w", err)
+			}
+			return nil
+		},
+	}
+}
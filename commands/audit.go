@@ -0,0 +1,190 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lvrach/smp/internal/docker"
+	"github.com/lvrach/smp/internal/paths"
+	"github.com/lvrach/smp/internal/sbom"
+	"github.com/lvrach/smp/internal/state"
+	"github.com/lvrach/smp/internal/vulndb"
+	"github.com/urfave/cli/v2"
+)
+
+// defaultVulnDB is the offline vulnerability database smp audit reads
+const defaultVulnDB = "~/.smp/vulndb"
+
+// auditFinding is a vulnerability as printed by smp audit --output json
+type auditFinding struct {
+	ID        string   `json:"id"`
+	Aliases   []string `json:"aliases,omitempty"`
+	Severity  string   `json:"severity,omitempty"`
+	Package   string   `json:"package"`
+	Ecosystem string   `json:"ecosystem"`
+	Version   string   `json:"version"`
+	Fixed     string   `json:"fixed,omitempty"`
+	Location  string   `json:"location,omitempty"`
+	Summary   string   `json:"summary,omitempty"`
+}
+
+// AuditCommand returns the command for auditing the image of an installed MCP
+func AuditCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "audit",
+		Usage:     "Match the SBOM of an installed MCP against a vulnerability database",
+		ArgsUsage: "[name]",
+		Subcommands: []*cli.Command{
+			auditLogCommand(),
+		},
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "db",
+				Usage:   "OSV vulnerability database: a JSON file, a directory or a zip exported by osv.dev",
+				Value:   defaultVulnDB,
+				EnvVars: []string{"SMP_VULN_DB"},
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "Output format: table or json",
+				Value:   "table",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.NArg() < 1 {
+				return fmt.Errorf("missing required argument: name")
+			}
+			name := c.Args().Get(0)
+
+			stateManager, err := state.NewHomeStore()
+			if err != nil {
+				return fmt.Errorf("failed to create state manager: %w", err)
+			}
+			mcpState, err := stateManager.Load(name)
+			if err != nil {
+				return fmt.Errorf("failed to load MCP state: %w", err)
+			}
+			if mcpState.LocalImageTag == "" {
+				return fmt.Errorf("MCP '%s' is not installed", name)
+			}
+
+			doc, err := loadSBOM(mcpState)
+			if err != nil {
+				return err
+			}
+
+			db, err := vulndb.Load(paths.ExpandHome(c.String("db")))
+			if errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("%w, download advisories from https://osv-vulnerabilities.storage.googleapis.com/<ecosystem>/all.zip and pass them with --db", err)
+			}
+			if err != nil {
+				return err
+			}
+
+			findings := db.Match(doc.Packages)
+
+			switch c.String("output") {
+			case "table":
+				printFindings(doc, db, findings)
+			case "json":
+				entries := []auditFinding{}
+				for _, f := range findings {
+					entries = append(entries, auditFinding{
+						ID:        f.Vulnerability.ID,
+						Aliases:   f.Vulnerability.Aliases,
+						Severity:  f.Vulnerability.DatabaseSpecific.Severity,
+						Package:   f.Package.Name,
+						Ecosystem: f.Package.OSVEcosystem(),
+						Version:   f.Package.Version,
+						Fixed:     f.Fixed,
+						Location:  f.Package.Location,
+						Summary:   f.Vulnerability.Summary,
+					})
+				}
+				data, err := json.MarshalIndent(entries, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to encode findings: %w", err)
+				}
+				fmt.Println(string(data))
+			default:
+				return fmt.Errorf("unknown output format %q, expected table or json", c.String("output"))
+			}
+
+			return nil
+		},
+	}
+}
+
+// loadSBOM returns the SBOM of the image an MCP runs, generating it if the image
+// was installed before SBOMs were recorded or the scan failed on install
+func loadSBOM(mcpState *state.MCPServer) (*sbom.SBOM, error) {
+	store, err := sbom.NewHomeStore()
+	if err != nil {
+		return nil, err
+	}
+
+	digest := mcpState.ImageDigest
+	if digest == "" {
+		digest = mcpState.LocalImageTag
+	}
+
+	doc, err := store.Load(mcpState.Name, digest)
+	if err == nil {
+		return doc, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	fmt.Fprintf(os.Stderr, "Generating SBOM of %s...\n", mcpState.LocalImageTag)
+	doc, err = sbom.Generate(mcpState.Name, docker.ImageReference(mcpState), digest)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.Save(doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func printFindings(doc *sbom.SBOM, db *vulndb.Database, findings []vulndb.Finding) {
+	fmt.Printf("Image:    %s\n", doc.Image)
+	if doc.OS != "" {
+		fmt.Printf("OS:       %s\n", doc.OS)
+	}
+	fmt.Printf("Packages: %d, checked against %d advisories\n\n", len(doc.Packages), db.Len())
+
+	if len(findings) == 0 {
+		fmt.Println("No known vulnerabilities found")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSEVERITY\tPACKAGE\tVERSION\tFIXED\tSUMMARY")
+	for _, f := range findings {
+		summary := f.Vulnerability.Summary
+		if len(summary) > 60 {
+			summary = summary[:57] + "..."
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			f.Vulnerability.ID,
+			strings.ToLower(f.Vulnerability.DatabaseSpecific.Severity),
+			f.Package.Name,
+			f.Package.Version,
+			f.Fixed,
+			summary,
+		)
+	}
+	w.Flush()
+
+	if len(findings) == 1 {
+		fmt.Println("\n1 vulnerability found")
+	} else {
+		fmt.Printf("\n%d vulnerabilities found\n", len(findings))
+	}
+}
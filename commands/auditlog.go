@@ -0,0 +1,126 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lvrach/smp/internal/auditlog"
+	"github.com/urfave/cli/v2"
+)
+
+// auditLogCommand returns the command for querying the tool calls smp run recorded
+func auditLogCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "log",
+		Usage: "Show the tool calls recorded by smp run",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "mcp",
+				Usage: "Only show calls to this MCP",
+			},
+			&cli.StringFlag{
+				Name:  "since",
+				Usage: "Only show calls since a time: a duration like 24h or 7d, a date or an RFC 3339 timestamp",
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "Output format: table or json (JSON lines)",
+				Value:   "table",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			filter := auditlog.Filter{MCP: c.String("mcp")}
+			if since := c.String("since"); since != "" {
+				t, err := parseSince(since, time.Now())
+				if err != nil {
+					return err
+				}
+				filter.Since = t
+			}
+
+			auditLog, err := auditlog.NewHomeLog()
+			if err != nil {
+				return err
+			}
+			records, err := auditLog.Read(filter)
+			if err != nil {
+				return err
+			}
+			records = auditlog.Calls(records)
+
+			switch c.String("output") {
+			case "table":
+				printAuditRecords(records)
+			case "json":
+				for _, record := range records {
+					data, err := json.Marshal(record)
+					if err != nil {
+						return fmt.Errorf("failed to encode audit record: %w", err)
+					}
+					fmt.Println(string(data))
+				}
+			default:
+				return fmt.Errorf("unknown output format %q, expected table or json", c.String("output"))
+			}
+			return nil
+		},
+	}
+}
+
+// parseSince parses the --since flag of smp audit log relative to now
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q, expected a duration like 24h or 7d, a date like 2006-01-02 or an RFC 3339 timestamp", value)
+}
+
+func printAuditRecords(records []auditlog.Record) {
+	if len(records) == 0 {
+		fmt.Println("No tool calls recorded")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tMCP\tHOST\tTOOL\tSTATUS\tDURATION\tARGS")
+	for _, record := range records {
+		args := string(record.Args)
+		if args == "" {
+			args = record.ArgsDigest
+		}
+		if len(args) > 60 {
+			args = args[:57] + "..."
+		}
+		status := record.Status
+		if record.Error != "" {
+			status += ": " + record.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			record.Time.Local().Format("2006-01-02 15:04:05"),
+			record.MCP,
+			record.Host,
+			record.Tool,
+			status,
+			time.Duration(record.DurationMS)*time.Millisecond,
+			args,
+		)
+	}
+	w.Flush()
+}
@@ -2,9 +2,11 @@ package commands
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 
-	"github.com/lvrach/smp/definitions"
 	"github.com/lvrach/smp/internal/build"
+	"github.com/lvrach/smp/internal/config"
 	"github.com/lvrach/smp/internal/docker"
 	"github.com/lvrach/smp/internal/prompt"
 	"github.com/lvrach/smp/internal/state"
@@ -22,6 +24,14 @@ func BuildCommand() *cli.Command {
 				Name:  "test-run",
 				Usage: "Test run the container after building",
 			},
+			&cli.StringFlag{
+				Name:  "from",
+				Usage: "Build from a local directory or tarball instead of the definition's source",
+			},
+			&cli.BoolFlag{
+				Name:  "no-cache",
+				Usage: "Rebuild the image even if one was built from the same source",
+			},
 		},
 		Action: func(c *cli.Context) error {
 			if c.NArg() < 1 {
@@ -30,21 +40,33 @@ func BuildCommand() *cli.Command {
 
 			name := c.Args().Get(0)
 
-			repo := definitions.NewRepository()
+			repo, err := catalogRepository(c)
+			if err != nil {
+				return err
+			}
 			mcpConfig, err := repo.MCPConfig(name)
 			if err != nil {
 				return fmt.Errorf("failed to get MCP configuration: %w", err)
 			}
 
+			if from := c.String("from"); from != "" {
+				src, err := localSource(from)
+				if err != nil {
+					return err
+				}
+				mcpConfig.Source = src
+			}
+
 			// Create a new builder with a temporary directory
-			builder, err := build.NewBuilder(mcpConfig)
+			builder, err := build.NewBuilder(repo, mcpConfig)
 			if err != nil {
 				return fmt.Errorf("failed to create builder: %w", err)
 			}
 			defer builder.CleanUp() // Clean up temporary directory when done
+			builder.NoCache = c.Bool("no-cache")
 
 			// Build the image from the repository
-			tag, err := builder.DockerImage()
+			image, err := builder.DockerImage()
 			if err != nil {
 				return err
 			}
@@ -54,7 +76,11 @@ func BuildCommand() *cli.Command {
 				// Create a new state for the test run
 				mcpState := &state.MCPServer{
 					Name:                 name,
-					LocalImageTag:        tag,
+					LocalImageTag:        image.Tag,
+					ImageDigest:          image.Digest,
+					SourceCommit:         image.Commit,
+					PackageVersion:       image.Version,
+					BuiltAt:              image.BuiltAt,
 					EnvironmentVariables: make(map[string]string),
 				}
 
@@ -74,3 +100,20 @@ func BuildCommand() *cli.Command {
 		},
 	}
 }
+
+// localSource returns the source for building from a local directory or tarball
+func localSource(from string) (*config.Source, error) {
+	abs, err := filepath.Abs(from)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", from, err)
+	}
+
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", from, err)
+	}
+	if info.IsDir() {
+		return &config.Source{Path: abs}, nil
+	}
+	return &config.Source{Archive: abs}, nil
+}
@@ -0,0 +1,97 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/lvrach/smp/internal/config"
+	"github.com/lvrach/smp/internal/prompt"
+	"github.com/lvrach/smp/internal/state"
+	"github.com/lvrach/smp/keystore"
+	"github.com/urfave/cli/v2"
+)
+
+// ConfigureCommand returns the command for changing the settings of an installed MCP
+func ConfigureCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "configure",
+		Usage:     "Change the environment variables of an installed MCP",
+		ArgsUsage: "[name] [VAR...]",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "unset",
+				Usage: "Remove the given variables instead of prompting for them",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.NArg() < 1 {
+				return fmt.Errorf("missing required argument: name")
+			}
+
+			name := c.Args().Get(0)
+			names := c.Args().Tail()
+
+			stateManager, err := state.NewHomeStore()
+			if err != nil {
+				return fmt.Errorf("creating state manager: %w", err)
+			}
+
+			mcpState, err := stateManager.Load(name)
+			if err != nil {
+				return fmt.Errorf("loading MCP state: %w", err)
+			}
+
+			if !mcpState.Installed() {
+				return fmt.Errorf("MCP '%s' is not installed", name)
+			}
+
+			repo := definitionRepository(mcpState)
+			mcpConfig, err := repo.MCPConfig(name)
+			if err != nil {
+				return fmt.Errorf("getting MCP configuration: %w", err)
+			}
+
+			for _, n := range names {
+				if findVariable(mcpConfig.EnvironmentVars, n) == nil {
+					return fmt.Errorf("MCP '%s' has no environment variable %q", name, n)
+				}
+			}
+
+			if c.Bool("unset") {
+				if len(names) == 0 {
+					return fmt.Errorf("missing required argument: variables to unset")
+				}
+
+				kc := keystore.KeyChain{}
+				for _, n := range names {
+					if accountKey, inKeychain := mcpState.UnsetEnvironmentVariable(n); inKeychain {
+						if err := kc.Delete(keystore.AccountType(accountKey)); err != nil {
+							return fmt.Errorf("deleting %s from keychain: %w", n, err)
+						}
+					}
+					fmt.Printf("Unset %s\n", n)
+					if envVar := findVariable(mcpConfig.EnvironmentVars, n); envVar.Required && envVar.Default == "" {
+						fmt.Printf("Warning: %s is required, 'smp run %s' will fail until it is configured again\n", n, name)
+					}
+				}
+			} else if err := prompt.ConfigureEnvironmentVariables(mcpConfig, mcpState, names); err != nil {
+				return fmt.Errorf("getting environment variables: %w", err)
+			}
+
+			if err := stateManager.Save(mcpState); err != nil {
+				return fmt.Errorf("saving MCP state: %w", err)
+			}
+
+			fmt.Printf("MCP '%s' configured successfully\n", name)
+			return nil
+		},
+	}
+}
+
+func findVariable(envVars []config.EnvironmentVariable, name string) *config.EnvironmentVariable {
+	for i := range envVars {
+		if envVars[i].Name == name {
+			return &envVars[i]
+		}
+	}
+	return nil
+}
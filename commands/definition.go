@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lvrach/smp/definitions"
+	"github.com/urfave/cli/v2"
+)
+
+// DefinitionCommand returns the command for working with MCP definitions
+func DefinitionCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "definition",
+		Usage: "Work with MCP definitions",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "lint",
+				Usage:     "Check MCP definitions for errors",
+				ArgsUsage: "[path...]",
+				Description: "Checks the given definition files, or the definitions in the given directories. " +
+					"Without arguments, checks every available definition.",
+				Action: func(c *cli.Context) error {
+					var problems []definitions.Problem
+					checked := 0
+
+					if c.NArg() == 0 {
+						// Linting only reads definitions, so project ones are checked too
+						repo := definitions.NewRepository()
+						if err := repo.AddProject(); err != nil {
+							return err
+						}
+						names, err := repo.ListMCPs()
+						if err != nil {
+							return fmt.Errorf("listing MCPs: %w", err)
+						}
+
+						for _, name := range names {
+							file, data, err := repo.ReadDefinition(name)
+							if err != nil {
+								return fmt.Errorf("reading definition %q: %w", name, err)
+							}
+							problems = append(problems, repo.Lint(file, data)...)
+							checked++
+						}
+					}
+
+					for _, path := range c.Args().Slice() {
+						files, err := definitionFiles(path)
+						if err != nil {
+							return err
+						}
+
+						for _, file := range files {
+							data, err := os.ReadFile(file)
+							if err != nil {
+								return fmt.Errorf("reading definition: %w", err)
+							}
+
+							// Resolve Dockerfiles next to the definition first
+							repo := definitions.NewRepository()
+							repo.PrependDirectory("lint", filepath.Dir(file))
+							problems = append(problems, repo.Lint(file, data)...)
+							checked++
+						}
+					}
+
+					for _, p := range problems {
+						fmt.Println(p)
+					}
+
+					if len(problems) > 0 {
+						return fmt.Errorf("found %d problem(s) in %d definition(s)", len(problems), checked)
+					}
+
+					fmt.Printf("%d definition(s) OK\n", checked)
+					return nil
+				},
+			},
+		},
+	}
+}
+
+// definitionFiles returns the definition file at path, or the definition files in
+// the directory at path
+func definitionFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %q: %w", path, err)
+	}
+
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(path, "*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("listing definitions in %q: %w", path, err)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,170 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lvrach/smp/internal/git"
+	"github.com/lvrach/smp/internal/prompt"
+	"github.com/lvrach/smp/internal/state"
+	"github.com/urfave/cli/v2"
+)
+
+// GitCommand returns the command for managing the credentials smp clones private
+// repositories with
+func GitCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "git",
+		Usage: "Manage credentials for private git repositories",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "login",
+				Usage:     "Store a token or SSH key for repositories under a host or path",
+				ArgsUsage: "[prefix]",
+				Description: "The prefix is a host, e.g. github.com, or a host and path, e.g. github.com/acme,\n" +
+					"and applies to MCP repositories and definition sources under it. The longest\n" +
+					"matching prefix wins, so a single source can use its own SSH key.",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "username",
+						Usage: "Username sent with the token (defaults to x-access-token)",
+					},
+					&cli.BoolFlag{
+						Name:  "token-stdin",
+						Usage: "Read the HTTPS token from stdin instead of prompting",
+					},
+					&cli.StringFlag{
+						Name:  "ssh-key",
+						Usage: "Private key for SSH URLs instead of the SSH agent's keys",
+					},
+					&cli.BoolFlag{
+						Name:  "https-instead-of-ssh",
+						Usage: "Clone SSH URLs over HTTPS, with the token if there is one",
+					},
+					&cli.StringFlag{
+						Name:  "secret-store",
+						Usage: "Where to keep the token: state or keychain",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.NArg() < 1 {
+						return fmt.Errorf("missing required argument: prefix")
+					}
+
+					cred := git.Credential{
+						Prefix:            c.Args().Get(0),
+						Username:          c.String("username"),
+						SSHKey:            c.String("ssh-key"),
+						HTTPSInsteadOfSSH: c.Bool("https-instead-of-ssh"),
+						SecretStore:       c.String("secret-store"),
+					}
+
+					switch cred.SecretStore {
+					case "":
+						cred.SecretStore = state.SecretStoreState
+						if runtime.GOOS == "darwin" {
+							cred.SecretStore = state.SecretStoreKeychain
+						}
+					case state.SecretStoreState, state.SecretStoreKeychain:
+					default:
+						return fmt.Errorf("unknown secret store %q, expected state or keychain", cred.SecretStore)
+					}
+
+					var token string
+					var err error
+					switch {
+					case c.Bool("token-stdin"):
+						token, err = bufio.NewReader(os.Stdin).ReadString('\n')
+						if err != nil && token == "" {
+							return fmt.Errorf("reading token from stdin: %w", err)
+						}
+						token = strings.TrimSpace(token)
+					case cred.SSHKey == "":
+						token, err = prompt.Password(fmt.Sprintf("Token for %s (empty for none):", cred.Prefix))
+						if err != nil {
+							return err
+						}
+					}
+
+					if token == "" && cred.SSHKey == "" && !cred.HTTPSInsteadOfSSH {
+						return fmt.Errorf("nothing to store: give a token, --ssh-key or --https-instead-of-ssh")
+					}
+
+					credentialStore, err := git.NewHomeCredentialStore()
+					if err != nil {
+						return fmt.Errorf("creating credential store: %w", err)
+					}
+
+					if err := credentialStore.Save(cred, token); err != nil {
+						return fmt.Errorf("saving credential: %w", err)
+					}
+
+					fmt.Printf("Credential for '%s' saved\n", cred.Prefix)
+					return nil
+				},
+			},
+			{
+				Name:      "logout",
+				Usage:     "Remove the stored credential for a prefix",
+				ArgsUsage: "[prefix]",
+				Action: func(c *cli.Context) error {
+					if c.NArg() < 1 {
+						return fmt.Errorf("missing required argument: prefix")
+					}
+
+					credentialStore, err := git.NewHomeCredentialStore()
+					if err != nil {
+						return fmt.Errorf("creating credential store: %w", err)
+					}
+
+					if err := credentialStore.Remove(c.Args().Get(0)); err != nil {
+						return err
+					}
+
+					fmt.Printf("Credential for '%s' removed\n", c.Args().Get(0))
+					return nil
+				},
+			},
+			{
+				Name:    "list",
+				Aliases: []string{"ls"},
+				Usage:   "List stored credentials, without their tokens",
+				Action: func(c *cli.Context) error {
+					credentialStore, err := git.NewHomeCredentialStore()
+					if err != nil {
+						return fmt.Errorf("creating credential store: %w", err)
+					}
+
+					creds, err := credentialStore.List()
+					if err != nil {
+						return err
+					}
+
+					if len(creds) == 0 {
+						fmt.Println("No git credentials stored")
+						return nil
+					}
+
+					w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+					fmt.Fprintln(w, "PREFIX\tTOKEN\tSSH KEY\tHTTPS FOR SSH")
+					for _, cred := range creds {
+						token := "-"
+						if cred.HasToken() {
+							token = cred.SecretStore
+						}
+						https := "no"
+						if cred.HTTPSInsteadOfSSH {
+							https = "yes"
+						}
+						fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", cred.Prefix, token, orDash(cred.SSHKey), https)
+					}
+					return w.Flush()
+				},
+			},
+		},
+	}
+}
@@ -5,9 +5,11 @@ import (
 
 	"github.com/lvrach/smp/definitions"
 	"github.com/lvrach/smp/internal/build"
+	"github.com/lvrach/smp/internal/config"
 	"github.com/lvrach/smp/internal/host"
 	"github.com/lvrach/smp/internal/prompt"
 	"github.com/lvrach/smp/internal/state"
+	"github.com/lvrach/smp/internal/verify"
 	"github.com/urfave/cli/v2"
 )
 
@@ -15,22 +17,30 @@ import (
 func InstallCommand() *cli.Command {
 	return &cli.Command{
 		Name:      "install",
-		Usage:     "Install an MCP from an embedded definition",
+		Usage:     "Install an MCP from a definition",
 		ArgsUsage: "[name]",
-		Flags:     []cli.Flag{},
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "no-cache",
+				Usage: "Rebuild the image even if one was built from the same source",
+			},
+		},
 		Action: func(c *cli.Context) error {
 
 			if c.NArg() < 1 {
-				return fmt.Errorf("missing required argument: name of embedded MCP")
+				return fmt.Errorf("missing required argument: name of MCP")
 			}
 
 			name := c.Args().Get(0)
 
-			repo := definitions.NewRepository()
-			// Get the embedded MCP configuration
+			repo, err := catalogRepository(c)
+			if err != nil {
+				return err
+			}
+			// Get the MCP configuration
 			mcpConfig, err := repo.MCPConfig(name)
 			if err != nil {
-				return fmt.Errorf("getting embedded MCP configuration: %w", err)
+				return fmt.Errorf("getting MCP configuration: %w", err)
 			}
 
 			stateManager, err := state.NewHomeStore()
@@ -38,25 +48,16 @@ func InstallCommand() *cli.Command {
 				return fmt.Errorf("creating state manager: %w", err)
 			}
 
-			builder, err := build.NewBuilder(mcpConfig)
-			if err != nil {
-				return fmt.Errorf("creating builder: %w", err)
-			}
-			defer builder.CleanUp() // Clean up temporary directory when done
-
-			// Build the image from the repository
-			tag, err := builder.DockerImage()
-			if err != nil {
-				return fmt.Errorf("building image: %w", err)
-			}
-
 			// Load or create MCP state
 			mcpState, err := stateManager.Load(name)
 			if err != nil {
 				return fmt.Errorf("loading MCP state: %w", err)
 			}
 
-			mcpState.LocalImageTag = tag
+			// Build the image from the repository
+			if err := installImage(repo, mcpConfig, mcpState, c.Bool("no-cache")); err != nil {
+				return err
+			}
 
 			// Prompt for environment variables
 			if err := prompt.PromptEnvironmentVariables(mcpConfig, mcpState); err != nil {
@@ -89,15 +90,7 @@ func InstallCommand() *cli.Command {
 
 				if len(selected) > 0 {
 					fmt.Println("\nConfiguring server in selected hosts:")
-					for _, h := range selected {
-						fmt.Printf("  Configuring in %s... ", h)
-						if err := hostManager.Connect(h, name); err != nil {
-							fmt.Printf("failed: %v\n", err)
-							continue
-						}
-						mcpState.ConfiguredHosts = append(mcpState.ConfiguredHosts, h)
-						fmt.Println("done")
-					}
+					connectHosts(hostManager, mcpState, selected)
 				} else {
 					fmt.Println("\nNo hosts selected for configuration")
 				}
@@ -113,3 +106,66 @@ func InstallCommand() *cli.Command {
 		},
 	}
 }
+
+// installImage builds or pulls the image of an MCP and records it in the MCP's state
+func installImage(repo *definitions.MCPRepository, mcpConfig *config.MCPConfig, mcpState *state.MCPServer, noCache bool) error {
+	// The image is verified against the copy of the policy that is recorded
+	policy, err := verify.Pin(mcpConfig.Verify)
+	if err != nil {
+		return err
+	}
+	mcpConfig.Verify = policy
+
+	builder, err := build.NewBuilder(repo, mcpConfig)
+	if err != nil {
+		return fmt.Errorf("creating builder: %w", err)
+	}
+	defer builder.CleanUp() // Clean up temporary directory when done
+	builder.NoCache = noCache
+
+	// Show where the definition comes from, as it decides what gets built and run
+	if layer, err := repo.Layer(mcpConfig.Name); err == nil {
+		if layer.Dir != "" {
+			fmt.Printf("Using the %s definition of '%s' from %s\n", layer.Name, mcpConfig.Name, layer.Dir)
+		} else {
+			fmt.Printf("Using the %s definition of '%s'\n", layer.Name, mcpConfig.Name)
+		}
+	}
+
+	image, err := builder.DockerImage()
+	if err != nil {
+		return fmt.Errorf("building image: %w", err)
+	}
+
+	mcpState.SetImageVersion(state.ImageVersion{
+		LocalImageTag:  image.Tag,
+		ImageDigest:    image.Digest,
+		SourceCommit:   image.Commit,
+		PackageVersion: image.Version,
+		BuiltAt:        image.BuiltAt,
+	})
+	mcpState.Verify = policy
+	if image.Verified {
+		mcpState.VerifiedDigest = image.Digest
+	}
+
+	// Remember project definitions so hosts can run the MCP from any directory
+	if layer, err := repo.Layer(mcpConfig.Name); err == nil && layer.Name == definitions.LayerProject {
+		mcpState.DefinitionDir = layer.Dir
+	}
+
+	return nil
+}
+
+// connectHosts configures the MCP in the given hosts and records them in its state
+func connectHosts(hostManager *host.Manager, mcpState *state.MCPServer, hosts []string) {
+	for _, h := range hosts {
+		fmt.Printf("  Configuring in %s... ", h)
+		if err := hostManager.Connect(h, mcpState.Name); err != nil {
+			fmt.Printf("failed: %v\n", err)
+			continue
+		}
+		mcpState.AddConfiguredHost(h)
+		fmt.Println("done")
+	}
+}
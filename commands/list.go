@@ -1,30 +1,226 @@
 package commands
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/lvrach/smp/definitions"
+	"github.com/lvrach/smp/internal/state"
 	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
 )
 
-// ListCommand returns the command for listing installed MCPs
+// listEntry is an MCP as reported by smp list
+type listEntry struct {
+	Name        string     `json:"name" yaml:"name"`
+	Description string     `json:"description,omitempty" yaml:"description,omitempty"`
+	Available   bool       `json:"available" yaml:"available"`
+	Installed   bool       `json:"installed" yaml:"installed"`
+	Image       string     `json:"image,omitempty" yaml:"image,omitempty"`
+	ImageDigest string     `json:"image_digest,omitempty" yaml:"image_digest,omitempty"`
+	Commit      string     `json:"source_commit,omitempty" yaml:"source_commit,omitempty"`
+	Version     string     `json:"package_version,omitempty" yaml:"package_version,omitempty"`
+	Hosts       []string   `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+	SecretStore string     `json:"secret_store,omitempty" yaml:"secret_store,omitempty"`
+	BuiltAt     *time.Time `json:"built_at,omitempty" yaml:"built_at,omitempty"`
+}
+
+// ListCommand returns the command for listing available and installed MCPs
 func ListCommand() *cli.Command {
 	return &cli.Command{
 		Name:    "list",
 		Aliases: []string{"ls"},
-		Usage:   "List installed MCPs",
+		Usage:   "List available and installed MCPs",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "available",
+				Usage: "Only list MCPs that are available but not installed",
+			},
+			&cli.BoolFlag{
+				Name:  "installed",
+				Usage: "Only list installed MCPs",
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "Output format: table, json or yaml",
+				Value:   "table",
+			},
+		},
 		Action: func(c *cli.Context) error {
-			repo := definitions.NewRepository()
-			mcpConfigs, err := repo.ListMCPs()
+			if c.Bool("available") && c.Bool("installed") {
+				return fmt.Errorf("--available and --installed are mutually exclusive")
+			}
+
+			repo, err := catalogRepository(c)
 			if err != nil {
-				return fmt.Errorf("failed to list MCPs: %w", err)
+				return err
+			}
+			entries, err := listEntries(repo)
+			if err != nil {
+				return err
 			}
 
-			for _, mcpConfig := range mcpConfigs {
-				fmt.Printf("  %s\n", mcpConfig)
+			var filtered []listEntry
+			for _, entry := range entries {
+				if c.Bool("installed") && !entry.Installed {
+					continue
+				}
+				if c.Bool("available") && entry.Installed {
+					continue
+				}
+				filtered = append(filtered, entry)
 			}
 
-			return nil
+			switch c.String("output") {
+			case "table":
+				return printListTable(filtered)
+			case "json":
+				if filtered == nil {
+					filtered = []listEntry{}
+				}
+				data, err := json.MarshalIndent(filtered, "", "  ")
+				if err != nil {
+					return fmt.Errorf("marshaling MCPs: %w", err)
+				}
+				fmt.Println(string(data))
+				return nil
+			case "yaml":
+				if filtered == nil {
+					filtered = []listEntry{}
+				}
+				data, err := yaml.Marshal(filtered)
+				if err != nil {
+					return fmt.Errorf("marshaling MCPs: %w", err)
+				}
+				fmt.Print(string(data))
+				return nil
+			default:
+				return fmt.Errorf("unknown output format %q, expected table, json or yaml", c.String("output"))
+			}
 		},
 	}
 }
+
+// listEntries merges the catalog with the installed MCPs
+func listEntries(repo *definitions.MCPRepository) ([]listEntry, error) {
+	names, err := repo.ListMCPs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list MCPs: %w", err)
+	}
+
+	stateManager, err := state.NewHomeStore()
+	if err != nil {
+		return nil, fmt.Errorf("creating state manager: %w", err)
+	}
+
+	states, err := stateManager.List()
+	if err != nil {
+		return nil, fmt.Errorf("listing installed MCPs: %w", err)
+	}
+
+	entries := make(map[string]*listEntry)
+	for _, name := range names {
+		entry := &listEntry{Name: name, Available: true}
+		// A broken definition is still listed, smp definition lint explains why
+		if mcpConfig, err := repo.MCPConfig(name); err == nil {
+			entry.Description = mcpConfig.Description
+		}
+		entries[name] = entry
+	}
+
+	for _, mcpState := range states {
+		if !mcpState.Installed() {
+			continue
+		}
+
+		entry, exists := entries[mcpState.Name]
+		if !exists {
+			entry = &listEntry{Name: mcpState.Name}
+			entries[mcpState.Name] = entry
+		}
+
+		// MCPs installed from project definitions resolve through them
+		if mcpState.DefinitionDir != "" || !exists {
+			if mcpConfig, err := definitionRepository(mcpState).MCPConfig(mcpState.Name); err == nil {
+				entry.Available = true
+				entry.Description = mcpConfig.Description
+			}
+		}
+
+		entry.Installed = true
+		entry.Image = mcpState.LocalImageTag
+		entry.ImageDigest = mcpState.ImageDigest
+		entry.Commit = mcpState.SourceCommit
+		entry.Version = mcpState.PackageVersion
+		entry.Hosts = mcpState.ConfiguredHosts
+		entry.SecretStore = mcpState.SecretBackend()
+		if !mcpState.BuiltAt.IsZero() {
+			builtAt := mcpState.BuiltAt
+			entry.BuiltAt = &builtAt
+		}
+	}
+
+	result := make([]listEntry, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, *entry)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+func printListTable(entries []listEntry) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATUS\tIMAGE\tDIGEST\tHOSTS\tSECRETS\tBUILT")
+
+	for _, entry := range entries {
+		status := "available"
+		if entry.Installed {
+			status = "installed"
+			if !entry.Available {
+				status = "installed (no definition)"
+			}
+		}
+
+		builtAt := ""
+		if entry.BuiltAt != nil {
+			builtAt = entry.BuiltAt.Local().Format(time.DateTime)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.Name,
+			status,
+			orDash(entry.Image),
+			orDash(shortDigest(entry.ImageDigest)),
+			orDash(strings.Join(entry.Hosts, ",")),
+			orDash(entry.SecretStore),
+			orDash(builtAt),
+		)
+	}
+
+	return w.Flush()
+}
+
+// shortDigest abbreviates a sha256 digest for display
+func shortDigest(digest string) string {
+	digest = strings.TrimPrefix(digest, "sha256:")
+	if len(digest) > 12 {
+		return digest[:12]
+	}
+	return digest
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
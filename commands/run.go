@@ -3,21 +3,59 @@ package commands
 import (
 	"fmt"
 	"os"
+	"time"
 
-	"github.com/lvrach/smp/definitions"
+	"github.com/lvrach/smp/internal/auditlog"
+	"github.com/lvrach/smp/internal/config"
 	"github.com/lvrach/smp/internal/docker"
+	"github.com/lvrach/smp/internal/pin"
+	"github.com/lvrach/smp/internal/policy"
+	"github.com/lvrach/smp/internal/proxy"
+	"github.com/lvrach/smp/internal/redact"
 	"github.com/lvrach/smp/internal/state"
+	"github.com/lvrach/smp/internal/verify"
 	"github.com/lvrach/smp/keystore"
 	"github.com/urfave/cli/v2"
 )
 
+// What smp run records of tool calls in the audit log
+const (
+	auditArgs   = "args"
+	auditDigest = "digest"
+	auditOff    = "off"
+)
+
 // RunCommand returns the command for running an MCP container
 func RunCommand() *cli.Command {
 	return &cli.Command{
 		Name:      "run",
 		Usage:     "Run a container for an MCP",
 		ArgsUsage: "[name]",
-		Flags:     []cli.Flag{},
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "trace",
+				Usage:   "Append every JSON-RPC message between host and MCP to a file",
+				EnvVars: []string{"SMP_TRACE"},
+			},
+			&cli.StringFlag{
+				Name:    "confirm",
+				Usage:   "How to ask for confirmation of tools marked with smp tools confirm: auto, dialog, tty or web",
+				Value:   policy.AskAuto,
+				EnvVars: []string{"SMP_CONFIRM"},
+			},
+			&cli.DurationFlag{
+				Name:    "confirm-timeout",
+				Usage:   "How long to wait for a confirmation before denying the call",
+				Value:   2 * time.Minute,
+				EnvVars: []string{"SMP_CONFIRM_TIMEOUT"},
+			},
+			&cli.StringFlag{
+				Name:    "audit",
+				Usage:   "What the audit log records of tool calls: args (redacted), digest (of the args only) or off",
+				Value:   auditArgs,
+				EnvVars: []string{"SMP_AUDIT"},
+			},
+		},
 		Action: func(c *cli.Context) error {
 			if c.NArg() < 1 {
 				fmt.Fprintf(os.Stderr, "Error: missing required argument: name\n")
@@ -26,13 +64,6 @@ func RunCommand() *cli.Command {
 
 			name := c.Args().Get(0)
 
-			repo := definitions.NewRepository()
-			mcpConfig, err := repo.MCPConfig(name)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error: failed to get MCP configuration: %v\n", err)
-				return fmt.Errorf("failed to get MCP configuration: %w", err)
-			}
-
 			stateManager, err := state.NewHomeStore()
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error: failed to create state manager: %v\n", err)
@@ -45,6 +76,18 @@ func RunCommand() *cli.Command {
 				return fmt.Errorf("failed to load MCP state: %w", err)
 			}
 
+			repo := definitionRepository(mcpState)
+			mcpConfig, err := repo.MCPConfig(name)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: failed to get MCP configuration: %v\n", err)
+				return fmt.Errorf("failed to get MCP configuration: %w", err)
+			}
+
+			if err := verifyImage(stateManager, mcpConfig, mcpState); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return err
+			}
+
 			kc := keystore.KeyChain{}
 
 			for accountKey, env := range mcpState.KeyChainEnvVars {
@@ -57,7 +100,60 @@ func RunCommand() *cli.Command {
 				mcpState.SetEnvironmentVariable(env, secret)
 			}
 
+			// Installs from before the definition had groups have no features recorded
+			mcpState.Features = mcpConfig.EnabledFeatures(mcpState.Features, mcpState.GetEnvironmentVariable)
+			if err := mcpConfig.ValidateEnvironment(mcpState.Features, mcpState.GetEnvironmentVariable); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return err
+			}
+
+			// Keep the MCP's secrets and common tokens from reaching the host, its
+			// model and the audit log
+			redactor := redact.New(secretValues(mcpConfig, mcpState))
+			stderr := redact.NewWriter(redactor, os.Stderr)
+			defer stderr.Flush()
+
 			runner := docker.NewRunner(mcpConfig, mcpState)
+			runner.Stderr = stderr
+			// The pin guard sees messages first, so it pins the lists the MCP sent
+			// rather than what the tool policy and redaction left of them
+			runner.Interceptors = append(runner.Interceptors, pin.NewGuard(mcpState, savePins(stateManager, name), os.Stderr))
+			runner.Interceptors = append(runner.Interceptors, redact.NewInterceptor(redactor))
+			switch mode := c.String("audit"); mode {
+			case auditOff:
+			case auditArgs, auditDigest:
+				auditLog, err := auditlog.NewHomeLog()
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					return err
+				}
+				recorder := auditlog.NewRecorder(name, auditLog, mode == auditArgs, redactor, os.Stderr)
+				defer recorder.Close()
+				runner.Interceptors = append(runner.Interceptors, recorder)
+			default:
+				fmt.Fprintf(os.Stderr, "Error: unknown audit mode %q, expected args, digest or off\n", mode)
+				return fmt.Errorf("unknown audit mode %q, expected args, digest or off", mode)
+			}
+			if filter := policy.NewToolFilter(mcpState, os.Stderr); filter != nil {
+				runner.Interceptors = append(runner.Interceptors, filter)
+			}
+			ask, err := policy.NewAsker(c.String("confirm"), os.Stderr)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return err
+			}
+			if confirmer := policy.NewConfirmer(mcpState, ask, c.Duration("confirm-timeout"), os.Stderr); confirmer != nil {
+				runner.Interceptors = append(runner.Interceptors, confirmer)
+			}
+			if trace := c.String("trace"); trace != "" {
+				f, err := os.OpenFile(trace, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: failed to open trace file: %v\n", err)
+					return fmt.Errorf("failed to open trace file: %w", err)
+				}
+				defer f.Close()
+				runner.Interceptors = append(runner.Interceptors, proxy.NewTrace(f))
+			}
 			if err := runner.Run(); err != nil {
 				fmt.Fprintf(os.Stderr, "Error: failed to run container: %v\n", err)
 				return fmt.Errorf("failed to run container: %w", err)
@@ -67,3 +163,77 @@ func RunCommand() *cli.Command {
 		},
 	}
 }
+
+// secretValues returns the values of an MCP's secret variables
+func secretValues(mcpConfig *config.MCPConfig, mcpState *state.MCPServer) []string {
+	var secrets []string
+	for _, envVar := range mcpConfig.EnvironmentVars {
+		if !envVar.IsSecret() {
+			continue
+		}
+		if value, exists := mcpState.GetEnvironmentVariable(envVar.Name); exists && value != "" {
+			secrets = append(secrets, value)
+		}
+	}
+	return secrets
+}
+
+// installedPolicy returns the signature policy an installed MCP's images must
+// satisfy: the copy recorded at install, or the definition's for MCPs installed
+// before smp recorded it
+func installedPolicy(mcpConfig *config.MCPConfig, mcpState *state.MCPServer) (*config.VerifyPolicy, error) {
+	if mcpState.Verify != nil {
+		return mcpState.Verify, nil
+	}
+	return verify.Pin(mcpConfig.Verify)
+}
+
+// verifyImage checks the signature of an MCP's image against the policy
+// recorded at install before it runs, unless the same image was verified on
+// install or by an earlier run. Messages go to stderr so they never mix with MCP
+// stdio.
+func verifyImage(stateManager *state.Store, mcpConfig *config.MCPConfig, mcpState *state.MCPServer) error {
+	policy, err := installedPolicy(mcpConfig, mcpState)
+	if err != nil {
+		return err
+	}
+	if policy == nil || (mcpState.ImageDigest != "" && mcpState.VerifiedDigest == mcpState.ImageDigest) {
+		return nil
+	}
+
+	if mcpState.ImageDigest == "" {
+		err = fmt.Errorf("%w: no digest recorded for %s, reinstall the MCP", verify.ErrUnverified, mcpState.LocalImageTag)
+	} else {
+		err = verify.Image(policy, docker.ImageReference(mcpState))
+	}
+	if err != nil {
+		if policy.Enforced() {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return nil
+	}
+
+	// Installs from before the policy was recorded keep the one verified now
+	mcpState.Verify = policy
+	mcpState.VerifiedDigest = mcpState.ImageDigest
+	if err := stateManager.Save(mcpState); err != nil {
+		return fmt.Errorf("failed to save MCP state: %w", err)
+	}
+	return nil
+}
+
+// savePins returns a function recording the pins and pending changes a session
+// saw. The state is loaded again, as the running copy holds secrets from the
+// keychain that must not be written to the state file.
+func savePins(stateManager *state.Store, name string) func(pins, pending map[string]state.PinnedList) error {
+	return func(pins, pending map[string]state.PinnedList) error {
+		mcpState, err := stateManager.Load(name)
+		if err != nil {
+			return err
+		}
+		mcpState.Pins = pins
+		mcpState.PendingPins = pending
+		return stateManager.Save(mcpState)
+	}
+}
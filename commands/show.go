@@ -0,0 +1,255 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lvrach/smp/internal/config"
+	"github.com/lvrach/smp/internal/docker"
+	"github.com/lvrach/smp/internal/pin"
+	"github.com/lvrach/smp/internal/state"
+	"github.com/urfave/cli/v2"
+)
+
+// SearchCommand returns the command for searching the MCP catalog
+func SearchCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "search",
+		Usage:     "Search available MCPs by name, description and tags",
+		ArgsUsage: "[term]",
+		Action: func(c *cli.Context) error {
+			if c.NArg() < 1 {
+				return fmt.Errorf("missing required argument: term")
+			}
+
+			repo, err := catalogRepository(c)
+			if err != nil {
+				return err
+			}
+			results, err := repo.Search(strings.Join(c.Args().Slice(), " "))
+			if err != nil {
+				return fmt.Errorf("searching MCPs: %w", err)
+			}
+
+			if len(results) == 0 {
+				fmt.Println("No MCPs found")
+				return nil
+			}
+
+			for _, mcpConfig := range results {
+				fmt.Printf("  %s\t%s\n", mcpConfig.Name, mcpConfig.Description)
+			}
+
+			return nil
+		},
+	}
+}
+
+// ShowCommand returns the command for showing the details of an MCP
+func ShowCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "show",
+		Usage:     "Show the details of an MCP",
+		ArgsUsage: "[name]",
+		Action: func(c *cli.Context) error {
+			if c.NArg() < 1 {
+				return fmt.Errorf("missing required argument: name")
+			}
+
+			name := c.Args().Get(0)
+
+			stateManager, err := state.NewHomeStore()
+			if err != nil {
+				return fmt.Errorf("creating state manager: %w", err)
+			}
+
+			mcpState, err := stateManager.Load(name)
+			if err != nil {
+				return fmt.Errorf("loading MCP state: %w", err)
+			}
+
+			repo := definitionRepository(mcpState)
+			if c.Bool("project") && !mcpState.Installed() {
+				if err := repo.AddProject(); err != nil {
+					return err
+				}
+			}
+			mcpConfig, err := repo.MCPConfig(name)
+			if err != nil {
+				return fmt.Errorf("getting MCP configuration: %w", err)
+			}
+
+			layer, err := repo.Layer(name)
+			if err != nil {
+				return fmt.Errorf("getting MCP source: %w", err)
+			}
+
+			fmt.Printf("Name:         %s\n", mcpConfig.Name)
+			printField("Description:", mcpConfig.Description)
+			printField("Homepage:", mcpConfig.Homepage)
+			printField("Tags:", strings.Join(mcpConfig.Tags, ", "))
+			printField("Maintainer:", mcpConfig.Maintainer)
+
+			if layer.Dir != "" {
+				fmt.Printf("Source:       %s (%s)\n", layer.Name, layer.Dir)
+			} else {
+				fmt.Printf("Source:       %s\n", layer.Name)
+			}
+
+			fmt.Printf("Build:        %s\n", buildDescription(mcpConfig))
+			fmt.Printf("Sandbox:      %s\n", docker.SandboxProfile)
+			policy := mcpConfig.Verify
+			if mcpState.Verify != nil {
+				// Installed MCPs are verified against the policy recorded at install
+				policy = mcpState.Verify
+			}
+			printField("Signature:", verifyDescription(policy))
+
+			if mcpState.Installed() {
+				fmt.Printf("Installed:    yes (%s)\n", mcpState.LocalImageTag)
+				printField("Digest:", mcpState.ImageDigest)
+				printField("Commit:", mcpState.SourceCommit)
+				printField("Version:", mcpState.PackageVersion)
+				if policy != nil && mcpState.VerifiedDigest != "" && mcpState.VerifiedDigest == mcpState.ImageDigest {
+					fmt.Printf("Verified:     yes\n")
+				} else if policy != nil {
+					fmt.Printf("Verified:     no\n")
+				}
+				printField("Hosts:", strings.Join(mcpState.ConfiguredHosts, ", "))
+				var unapproved []string
+				for _, change := range pin.Pending(mcpState) {
+					unapproved = append(unapproved, change.String())
+				}
+				printField("Unapproved:", strings.Join(unapproved, ", "))
+				if mcpState.Tools != nil {
+					printField("Tools:", toolPolicyDescription(mcpState.Tools))
+				}
+			} else {
+				fmt.Printf("Installed:    no\n")
+			}
+
+			if len(mcpConfig.Groups) > 0 {
+				fmt.Println("\nFeatures:")
+				for _, group := range mcpConfig.Groups {
+					mode := "any of"
+					if len(group.OneOf) > 0 {
+						mode = "one of"
+					}
+					fmt.Printf("  %s (%s): %s\n", group.Name, mode, strings.Join(group.Features(), ", "))
+				}
+			}
+
+			if len(mcpConfig.EnvironmentVars) > 0 {
+				fmt.Println("\nVariables:")
+				for _, envVar := range mcpConfig.EnvironmentVars {
+					fmt.Printf("  %s\n", variableDescription(envVar))
+				}
+			}
+
+			return nil
+		},
+	}
+}
+
+// verifyDescription summarises a definition's signature verification policy
+func verifyDescription(policy *config.VerifyPolicy) string {
+	if policy == nil {
+		return ""
+	}
+
+	var desc string
+	switch {
+	case policy.Key != "" && strings.HasPrefix(policy.Key, "-----BEGIN"):
+		desc = "cosign key (inline)"
+	case policy.Key != "":
+		desc = "cosign key " + policy.Key
+	case policy.IdentityRegexp != "":
+		desc = fmt.Sprintf("keyless, identity matching %s from %s", policy.IdentityRegexp, policy.Issuer)
+	default:
+		desc = fmt.Sprintf("keyless, identity %s from %s", policy.Identity, policy.Issuer)
+	}
+	if policy.Attestation != "" {
+		desc += ", " + policy.Attestation + " attestation"
+	}
+	if policy.Enforced() {
+		return desc + ", enforced"
+	}
+	return desc + ", warn only"
+}
+
+func printField(label, value string) {
+	if value != "" {
+		fmt.Printf("%-13s %s\n", label, value)
+	}
+}
+
+// buildDescription describes how the image of an MCP is obtained
+func buildDescription(mcpConfig *config.MCPConfig) string {
+	switch mcpConfig.Strategy() {
+	case config.StrategyImage:
+		return fmt.Sprintf("pull image %s", mcpConfig.Image)
+	case config.StrategyRepository:
+		description := fmt.Sprintf("build from %s", mcpConfig.Repository)
+		if mcpConfig.Commit != "" {
+			description += fmt.Sprintf(" (commit %s)", mcpConfig.Commit)
+		} else if mcpConfig.Ref != "" {
+			description += fmt.Sprintf(" (ref %s)", mcpConfig.Ref)
+		} else if mcpConfig.Branch != "" {
+			description += fmt.Sprintf(" (branch %s)", mcpConfig.Branch)
+		}
+		if mcpConfig.Subdir != "" {
+			description += fmt.Sprintf(" in %s", mcpConfig.Subdir)
+		}
+		if mcpConfig.Submodules {
+			description += " with submodules"
+		}
+		if mcpConfig.Dockerfile != "" {
+			description += fmt.Sprintf(" with Dockerfile %s", mcpConfig.Dockerfile)
+		}
+		return description
+	case config.StrategyRegistry:
+		kind, pkg := mcpConfig.RegistryPackage()
+		if mcpConfig.Version != "" {
+			pkg += " " + mcpConfig.Version
+		}
+		return fmt.Sprintf("build %s package %s", kind, pkg)
+	case config.StrategyBuilder:
+		pkg := mcpConfig.Package
+		if mcpConfig.Version != "" {
+			pkg += " " + mcpConfig.Version
+		}
+		return fmt.Sprintf("build package %s with the %s builder", pkg, mcpConfig.Builder)
+	case config.StrategyLocal:
+		description := fmt.Sprintf("build from directory %s", mcpConfig.Source.Path)
+		if mcpConfig.Source.Archive != "" {
+			description = fmt.Sprintf("build from archive %s", mcpConfig.Source.Archive)
+		}
+		if mcpConfig.Dockerfile != "" {
+			description += fmt.Sprintf(" with Dockerfile %s", mcpConfig.Dockerfile)
+		}
+		return description
+	}
+	return "unknown"
+}
+
+// variableDescription summarises a variable on one line,
+// e.g. "JIRA_URL (url, required, when jira): Jira URL"
+func variableDescription(envVar config.EnvironmentVariable) string {
+	attributes := []string{envVar.Type}
+	if envVar.Required {
+		attributes = append(attributes, "required")
+	} else {
+		attributes = append(attributes, "optional")
+	}
+	if envVar.Default != "" {
+		attributes = append(attributes, fmt.Sprintf("default %s", envVar.Default))
+	}
+	if len(envVar.Enum) > 0 {
+		attributes = append(attributes, fmt.Sprintf("one of %s", strings.Join(envVar.Enum, "|")))
+	}
+	if envVar.When != "" {
+		attributes = append(attributes, fmt.Sprintf("when %s", envVar.When))
+	}
+
+	return fmt.Sprintf("%s (%s): %s", envVar.Name, strings.Join(attributes, ", "), envVar.Description)
+}
@@ -0,0 +1,198 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/lvrach/smp/definitions"
+	"github.com/lvrach/smp/internal/source"
+	"github.com/lvrach/smp/internal/state"
+	"github.com/urfave/cli/v2"
+)
+
+// SourceCommand returns the command for managing git repositories of MCP definitions
+func SourceCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "source",
+		Usage: "Manage git repositories of MCP definitions",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "add",
+				Usage:     "Register a git repository of MCP definitions",
+				ArgsUsage: "[git-url]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "name",
+						Usage: "Name of the source (defaults to the repository name)",
+					},
+					&cli.StringFlag{
+						Name:  "branch",
+						Usage: "Branch to track (defaults to the remote's default branch)",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.NArg() < 1 {
+						return fmt.Errorf("missing required argument: git-url")
+					}
+
+					url := c.Args().Get(0)
+					name := c.String("name")
+					if name == "" {
+						name = source.NameFromURL(url)
+					}
+
+					if err := source.ValidateName(name); err != nil {
+						return fmt.Errorf("%w, choose another with --name", err)
+					}
+
+					switch name {
+					case definitions.LayerProject, definitions.LayerUser, definitions.LayerEmbedded:
+						return fmt.Errorf("source name %q is reserved, use --name", name)
+					}
+
+					sourceStore, err := source.NewHomeStore()
+					if err != nil {
+						return fmt.Errorf("creating source store: %w", err)
+					}
+
+					if err := sourceStore.Add(source.Source{
+						Name:   name,
+						URL:    url,
+						Branch: c.String("branch"),
+					}); err != nil {
+						return fmt.Errorf("adding source %q: %w", name, err)
+					}
+
+					fmt.Printf("Source '%s' added successfully\n", name)
+					return nil
+				},
+			},
+			{
+				Name:    "list",
+				Aliases: []string{"ls"},
+				Usage:   "List definition layers in order of precedence",
+				Action: func(c *cli.Context) error {
+					sourceStore, err := source.NewHomeStore()
+					if err != nil {
+						return fmt.Errorf("creating source store: %w", err)
+					}
+
+					sources, err := sourceStore.List()
+					if err != nil {
+						return fmt.Errorf("listing sources: %w", err)
+					}
+
+					urls := make(map[string]string)
+					for _, src := range sources {
+						urls[src.Name] = src.URL
+					}
+
+					repo, err := catalogRepository(c)
+					if err != nil {
+						return err
+					}
+					for _, layer := range repo.Layers() {
+						switch {
+						case urls[layer.Name] != "":
+							fmt.Printf("  %s\t%s\n", layer.Name, urls[layer.Name])
+						case layer.Dir != "":
+							fmt.Printf("  %s\t%s\n", layer.Name, layer.Dir)
+						default:
+							fmt.Printf("  %s\n", layer.Name)
+						}
+					}
+
+					return nil
+				},
+			},
+			{
+				Name:      "update",
+				Usage:     "Fetch the latest definitions of registered sources",
+				ArgsUsage: "[name...]",
+				Action: func(c *cli.Context) error {
+					sourceStore, err := source.NewHomeStore()
+					if err != nil {
+						return fmt.Errorf("creating source store: %w", err)
+					}
+
+					names := c.Args().Slice()
+					if len(names) == 0 {
+						sources, err := sourceStore.List()
+						if err != nil {
+							return fmt.Errorf("listing sources: %w", err)
+						}
+						for _, src := range sources {
+							names = append(names, src.Name)
+						}
+					}
+
+					for _, name := range names {
+						fmt.Printf("Updating source %s...\n", name)
+						if err := sourceStore.Update(name); err != nil {
+							return fmt.Errorf("updating source %q: %w", name, err)
+						}
+					}
+
+					return nil
+				},
+			},
+			{
+				Name:      "remove",
+				Aliases:   []string{"rm"},
+				Usage:     "Unregister a git repository of MCP definitions",
+				ArgsUsage: "[name]",
+				Action: func(c *cli.Context) error {
+					if c.NArg() < 1 {
+						return fmt.Errorf("missing required argument: name")
+					}
+
+					name := c.Args().Get(0)
+
+					sourceStore, err := source.NewHomeStore()
+					if err != nil {
+						return fmt.Errorf("creating source store: %w", err)
+					}
+
+					if err := sourceStore.Remove(name); err != nil {
+						return fmt.Errorf("removing source %q: %w", name, err)
+					}
+
+					fmt.Printf("Source '%s' removed successfully\n", name)
+					return nil
+				},
+			},
+		},
+	}
+}
+
+// GlobalFlags returns the flags of every smp command
+func GlobalFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "project",
+			Usage:   "Trust the definitions in .smp/definitions of the current directory",
+			EnvVars: []string{"SMP_PROJECT"},
+		},
+	}
+}
+
+// catalogRepository returns the definition repository, including the project
+// definitions of the current directory only when --project trusts them
+func catalogRepository(c *cli.Context) (*definitions.MCPRepository, error) {
+	repo := definitions.NewRepository()
+	if c.Bool("project") {
+		if err := repo.AddProject(); err != nil {
+			return nil, err
+		}
+	}
+	return repo, nil
+}
+
+// definitionRepository returns the definition repository for an installed MCP,
+// including the project definitions it was installed from
+func definitionRepository(mcpState *state.MCPServer) *definitions.MCPRepository {
+	repo := definitions.NewRepository()
+	if mcpState.DefinitionDir != "" {
+		repo.PrependDirectory(definitions.LayerProject, mcpState.DefinitionDir)
+	}
+	return repo
+}
@@ -0,0 +1,202 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lvrach/smp/internal/state"
+	"github.com/urfave/cli/v2"
+)
+
+// ToolsCommand returns the command for managing which tools of an MCP hosts can use
+func ToolsCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "tools",
+		Usage: "Manage which tools of an MCP hosts can see and call, and which need confirmation",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "allow",
+				Usage:     "Only allow the given tools, glob patterns like 'get_*' match several",
+				ArgsUsage: "<name> <tool>...",
+				Action: func(c *cli.Context) error {
+					return updateToolPolicy(c, func(policy *state.ToolPolicy, tools []string) {
+						policy.Allow = addPatterns(policy.Allow, tools)
+						policy.Deny = removePatterns(policy.Deny, tools)
+					})
+				},
+			},
+			{
+				Name:      "deny",
+				Usage:     "Deny the given tools, glob patterns like 'delete_*' match several",
+				ArgsUsage: "<name> <tool>...",
+				Action: func(c *cli.Context) error {
+					// Allow entries are left alone, as removing the last one
+					// would allow every tool. Deny wins over them anyway.
+					return updateToolPolicy(c, func(policy *state.ToolPolicy, tools []string) {
+						policy.Deny = addPatterns(policy.Deny, tools)
+					})
+				},
+			},
+			{
+				Name:      "confirm",
+				Usage:     "Ask the user to confirm every call to the given tools during smp run",
+				ArgsUsage: "<name> <tool>...",
+				Action: func(c *cli.Context) error {
+					return updateToolPolicy(c, func(policy *state.ToolPolicy, tools []string) {
+						policy.Confirm = addPatterns(policy.Confirm, tools)
+					})
+				},
+			},
+			{
+				Name:      "unconfirm",
+				Usage:     "Stop asking to confirm calls to the given tools, given as they were marked",
+				ArgsUsage: "<name> <tool>...",
+				Action: func(c *cli.Context) error {
+					return updateToolPolicy(c, func(policy *state.ToolPolicy, tools []string) {
+						policy.Confirm = removePatterns(policy.Confirm, tools)
+					})
+				},
+			},
+			{
+				Name:      "reset",
+				Usage:     "Allow all tools again without confirmation",
+				ArgsUsage: "<name>",
+				Action: func(c *cli.Context) error {
+					if c.NArg() < 1 {
+						return fmt.Errorf("missing required argument: name")
+					}
+					stateManager, mcpState, err := loadInstalled(c.Args().Get(0))
+					if err != nil {
+						return err
+					}
+					mcpState.Tools = nil
+					if err := stateManager.Save(mcpState); err != nil {
+						return fmt.Errorf("saving MCP state: %w", err)
+					}
+					fmt.Printf("All tools of '%s' are allowed without confirmation\n", mcpState.Name)
+					return nil
+				},
+			},
+			{
+				Name:      "show",
+				Usage:     "Show the tool policy of an MCP",
+				ArgsUsage: "<name>",
+				Action: func(c *cli.Context) error {
+					if c.NArg() < 1 {
+						return fmt.Errorf("missing required argument: name")
+					}
+					_, mcpState, err := loadInstalled(c.Args().Get(0))
+					if err != nil {
+						return err
+					}
+					printToolPolicy(mcpState.Tools)
+					return nil
+				},
+			},
+		},
+	}
+}
+
+// updateToolPolicy applies a change to the tool policy of the MCP named by the
+// first argument, with the remaining arguments as tool patterns
+func updateToolPolicy(c *cli.Context, update func(policy *state.ToolPolicy, tools []string)) error {
+	if c.NArg() < 2 {
+		return fmt.Errorf("missing required arguments: name and at least one tool")
+	}
+
+	stateManager, mcpState, err := loadInstalled(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+
+	policy := &state.ToolPolicy{}
+	if mcpState.Tools != nil {
+		*policy = *mcpState.Tools
+	}
+	update(policy, c.Args().Slice()[1:])
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+
+	if policy.Empty() {
+		mcpState.Tools = nil
+	} else {
+		mcpState.Tools = policy
+	}
+	if err := stateManager.Save(mcpState); err != nil {
+		return fmt.Errorf("saving MCP state: %w", err)
+	}
+
+	printToolPolicy(mcpState.Tools)
+	return nil
+}
+
+// loadInstalled loads the state of an installed MCP
+func loadInstalled(name string) (*state.Store, *state.MCPServer, error) {
+	stateManager, err := state.NewHomeStore()
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating state manager: %w", err)
+	}
+
+	mcpState, err := stateManager.Load(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading MCP state: %w", err)
+	}
+
+	if !mcpState.Installed() {
+		return nil, nil, fmt.Errorf("MCP '%s' is not installed", name)
+	}
+	return stateManager, mcpState, nil
+}
+
+func printToolPolicy(policy *state.ToolPolicy) {
+	if policy == nil {
+		fmt.Println("All tools are allowed without confirmation")
+		return
+	}
+	if len(policy.Allow) > 0 {
+		fmt.Printf("Allowed: %s\n", strings.Join(policy.Allow, ", "))
+	} else {
+		fmt.Println("Allowed: all tools not denied")
+	}
+	if len(policy.Deny) > 0 {
+		fmt.Printf("Denied:  %s\n", strings.Join(policy.Deny, ", "))
+	}
+	if len(policy.Confirm) > 0 {
+		fmt.Printf("Confirm: %s\n", strings.Join(policy.Confirm, ", "))
+	}
+}
+
+func addPatterns(patterns, add []string) []string {
+	for _, pattern := range add {
+		if !contains(patterns, pattern) {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+func removePatterns(patterns, remove []string) []string {
+	var kept []string
+	for _, pattern := range patterns {
+		if !contains(remove, pattern) {
+			kept = append(kept, pattern)
+		}
+	}
+	return kept
+}
+
+// toolPolicyDescription summarizes a tool policy on one line
+func toolPolicyDescription(policy *state.ToolPolicy) string {
+	var parts []string
+	if len(policy.Allow) > 0 {
+		parts = append(parts, "allow "+strings.Join(policy.Allow, ", "))
+	}
+	if len(policy.Deny) > 0 {
+		parts = append(parts, "deny "+strings.Join(policy.Deny, ", "))
+	}
+	if len(policy.Confirm) > 0 {
+		parts = append(parts, "confirm "+strings.Join(policy.Confirm, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
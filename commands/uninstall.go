@@ -5,6 +5,7 @@ import (
 
 	"github.com/lvrach/smp/internal/docker"
 	"github.com/lvrach/smp/internal/host"
+	"github.com/lvrach/smp/internal/sbom"
 	"github.com/lvrach/smp/internal/state"
 	"github.com/urfave/cli/v2"
 )
@@ -32,26 +33,8 @@ func UninstallCommand() *cli.Command {
 				return fmt.Errorf("loading MCP state: %w", err)
 			}
 
-			if mcpState.LocalImageTag != "" {
-				if err := docker.DeleteImage(mcpState.LocalImageTag); err != nil {
-					return fmt.Errorf("deleting Docker image %q: %w", mcpState.LocalImageTag, err)
-				}
-			}
-
-			hostManager := host.DefaultManager()
-			for _, h := range mcpState.ConfiguredHosts {
-				wasConfigured, err := hostManager.Disconnect(h, name)
-				if err != nil {
-					return fmt.Errorf("disconnecting from host %q: %w", h, err)
-				}
-				if !wasConfigured {
-					fmt.Printf("Warning: server %q was not configured in host %q\n", name, h)
-				}
-			}
-
-			// Delete the state
-			if err := stateManager.Delete(name); err != nil {
-				return fmt.Errorf("deleting MCP state: %w", err)
+			if err := uninstallMCP(stateManager, mcpState); err != nil {
+				return err
 			}
 
 			fmt.Printf("MCP '%s' uninstalled successfully\n", name)
@@ -59,3 +42,44 @@ func UninstallCommand() *cli.Command {
 		},
 	}
 }
+
+// uninstallMCP removes an MCP's images, disconnects it from its hosts and deletes its state
+func uninstallMCP(stateManager *state.Store, mcpState *state.MCPServer) error {
+	name := mcpState.Name
+
+	if mcpState.LocalImageTag != "" {
+		if err := docker.DeleteImage(mcpState.LocalImageTag); err != nil {
+			return fmt.Errorf("deleting Docker image %q: %w", mcpState.LocalImageTag, err)
+		}
+	}
+
+	if mcpState.PreviousImage != nil {
+		if err := docker.DeleteImage(docker.PreviousTag(name)); err != nil {
+			return fmt.Errorf("deleting previous Docker image: %w", err)
+		}
+	}
+
+	hostManager := host.DefaultManager()
+	for _, h := range mcpState.ConfiguredHosts {
+		wasConfigured, err := hostManager.Disconnect(h, name)
+		if err != nil {
+			return fmt.Errorf("disconnecting from host %q: %w", h, err)
+		}
+		if !wasConfigured {
+			fmt.Printf("Warning: server %q was not configured in host %q\n", name, h)
+		}
+	}
+
+	if store, err := sbom.NewHomeStore(); err == nil {
+		if err := store.Remove(name); err != nil {
+			return err
+		}
+	}
+
+	// Delete the state
+	if err := stateManager.Delete(name); err != nil {
+		return fmt.Errorf("deleting MCP state: %w", err)
+	}
+
+	return nil
+}
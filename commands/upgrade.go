@@ -0,0 +1,360 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/lvrach/smp/internal/build"
+	"github.com/lvrach/smp/internal/config"
+	"github.com/lvrach/smp/internal/docker"
+	"github.com/lvrach/smp/internal/git"
+	"github.com/lvrach/smp/internal/prompt"
+	"github.com/lvrach/smp/internal/state"
+	"github.com/urfave/cli/v2"
+)
+
+// changelogLimit is the maximum number of commits shown before an upgrade
+const changelogLimit = 50
+
+// UpgradeCommand returns the command for upgrading installed MCPs
+func UpgradeCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "upgrade",
+		Usage:     "Upgrade installed MCPs to the latest image or commit",
+		ArgsUsage: "[name...]",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "all",
+				Usage: "Upgrade all installed MCPs",
+			},
+			&cli.BoolFlag{
+				Name:  "check",
+				Usage: "Only report available upgrades",
+			},
+			&cli.BoolFlag{
+				Name:    "yes",
+				Aliases: []string{"y"},
+				Usage:   "Upgrade without asking for confirmation",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.NArg() < 1 && !c.Bool("all") {
+				return fmt.Errorf("missing required argument: name, or --all")
+			}
+
+			stateManager, err := state.NewHomeStore()
+			if err != nil {
+				return fmt.Errorf("creating state manager: %w", err)
+			}
+
+			var states []*state.MCPServer
+			if c.Bool("all") {
+				all, err := stateManager.List()
+				if err != nil {
+					return fmt.Errorf("listing installed MCPs: %w", err)
+				}
+				for _, mcpState := range all {
+					if mcpState.Installed() {
+						states = append(states, mcpState)
+					}
+				}
+			} else {
+				for _, name := range c.Args().Slice() {
+					mcpState, err := stateManager.Load(name)
+					if err != nil {
+						return fmt.Errorf("loading MCP state: %w", err)
+					}
+					if !mcpState.Installed() {
+						return fmt.Errorf("MCP '%s' is not installed", name)
+					}
+					states = append(states, mcpState)
+				}
+			}
+
+			failed := 0
+			for _, mcpState := range states {
+				if err := upgradeMCP(stateManager, mcpState, c.Bool("check"), c.Bool("yes")); err != nil {
+					fmt.Printf("Upgrading %s failed: %v\n", mcpState.Name, err)
+					failed++
+				}
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d of %d upgrade(s) failed", failed, len(states))
+			}
+			return nil
+		},
+	}
+}
+
+// upgradeMCP checks an installed MCP for a newer image or commit and, unless only
+// checking, upgrades it while keeping the current image for rollback
+func upgradeMCP(stateManager *state.Store, mcpState *state.MCPServer, check, yes bool) error {
+	name := mcpState.Name
+
+	repo := definitionRepository(mcpState)
+	mcpConfig, err := repo.MCPConfig(name)
+	if err != nil {
+		return fmt.Errorf("getting MCP configuration: %w", err)
+	}
+
+	// New images must satisfy the policy recorded at install
+	policy, err := installedPolicy(mcpConfig, mcpState)
+	if err != nil {
+		return err
+	}
+	mcpConfig.Verify = policy
+
+	builder, err := build.NewBuilder(repo, mcpConfig)
+	if err != nil {
+		return fmt.Errorf("creating builder: %w", err)
+	}
+	defer builder.CleanUp() // Clean up temporary directory when done
+
+	var image *build.Image
+
+	switch mcpConfig.Strategy() {
+	case config.StrategyRepository:
+		latest, err := builder.LatestCommit()
+		if err != nil {
+			return err
+		}
+		if latest == mcpState.SourceCommit {
+			fmt.Printf("%s is up to date (commit %s)\n", name, shortCommit(latest))
+			return nil
+		}
+
+		fmt.Printf("%s: commit %s -> %s\n", name, orDash(shortCommit(mcpState.SourceCommit)), shortCommit(latest))
+		if check {
+			return nil
+		}
+
+		dir, commit, err := builder.Source()
+		if err != nil {
+			return err
+		}
+
+		changelog, err := git.Log(dir, mcpState.SourceCommit, changelogLimit)
+		if err != nil {
+			return err
+		}
+		fmt.Println("\nChanges:")
+		for _, line := range changelog {
+			fmt.Printf("  %s\n", line)
+		}
+		fmt.Println()
+
+		if ok, err := confirmUpgrade(name, yes); err != nil || !ok {
+			return err
+		}
+
+		keepPreviousImage(mcpState)
+
+		image, err = builder.CachedImage(commit)
+		if err != nil {
+			return err
+		}
+		if image == nil {
+			image, err = builder.BuildSource(dir, commit)
+			if err != nil {
+				return fmt.Errorf("building image: %w", err)
+			}
+		}
+
+	case config.StrategyImage:
+		// The registry is asked for the digest, so checking pulls nothing
+		latest, err := builder.LatestDigest()
+		if err != nil {
+			return err
+		}
+		if mcpConfig.Image == mcpState.LocalImageTag && latest == mcpState.ImageDigest {
+			fmt.Printf("%s is up to date (digest %s)\n", name, shortDigest(latest))
+			return nil
+		}
+
+		fmt.Printf("%s: image %s@%s -> %s@%s\n", name,
+			orDash(mcpState.LocalImageTag), orDash(shortDigest(mcpState.ImageDigest)),
+			mcpConfig.Image, shortDigest(latest))
+		if check {
+			return nil
+		}
+
+		if ok, err := confirmUpgrade(name, yes); err != nil || !ok {
+			return err
+		}
+
+		keepPreviousImage(mcpState)
+
+		image, err = builder.PullImage()
+		if err != nil {
+			return err
+		}
+
+	case config.StrategyRegistry:
+		latest, err := builder.LatestVersion()
+		if err != nil {
+			return err
+		}
+		if latest == mcpState.PackageVersion {
+			fmt.Printf("%s is up to date (version %s)\n", name, latest)
+			return nil
+		}
+
+		fmt.Printf("%s: version %s -> %s\n", name, orDash(mcpState.PackageVersion), latest)
+		if check {
+			return nil
+		}
+
+		if ok, err := confirmUpgrade(name, yes); err != nil || !ok {
+			return err
+		}
+
+		keepPreviousImage(mcpState)
+
+		builder.PackageVersion = latest
+		image, err = builder.BuildFromRegistry()
+		if err != nil {
+			return fmt.Errorf("building image: %w", err)
+		}
+
+	case config.StrategyLocal, config.StrategyBuilder:
+		// Local sources and packages have no commit to compare, upgrading rebuilds them
+		fmt.Printf("%s: rebuild (%s)\n", name, buildDescription(mcpConfig))
+		if check {
+			return nil
+		}
+
+		if ok, err := confirmUpgrade(name, yes); err != nil || !ok {
+			return err
+		}
+
+		keepPreviousImage(mcpState)
+
+		image, err = builder.DockerImage()
+		if err != nil {
+			return fmt.Errorf("building image: %w", err)
+		}
+
+	default:
+		return fmt.Errorf("not sure how to build the image for MCP '%s'", name)
+	}
+
+	mcpState.SetImageVersion(state.ImageVersion{
+		LocalImageTag:  image.Tag,
+		ImageDigest:    image.Digest,
+		SourceCommit:   image.Commit,
+		PackageVersion: image.Version,
+		BuiltAt:        image.BuiltAt,
+	})
+	mcpState.Verify = policy
+	if image.Verified {
+		mcpState.VerifiedDigest = image.Digest
+	}
+
+	if err := stateManager.Save(mcpState); err != nil {
+		return fmt.Errorf("saving MCP state: %w", err)
+	}
+
+	fmt.Printf("MCP '%s' upgraded successfully, 'smp rollback %s' switches back\n", name, name)
+	return nil
+}
+
+func confirmUpgrade(name string, yes bool) (bool, error) {
+	if yes {
+		return true, nil
+	}
+
+	ok, err := prompt.Confirm(fmt.Sprintf("Upgrade %s?", name), true)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		fmt.Printf("Skipped %s\n", name)
+	}
+	return ok, nil
+}
+
+// keepPreviousImage tags the image the MCP currently runs so it survives the upgrade
+// and records it for rollback
+func keepPreviousImage(mcpState *state.MCPServer) {
+	if err := docker.Tag(docker.ImageReference(mcpState), docker.PreviousTag(mcpState.Name)); err != nil {
+		fmt.Printf("Warning: keeping the current image failed, rollback will not be possible: %v\n", err)
+		mcpState.PreviousImage = nil
+		return
+	}
+
+	previous := mcpState.ImageVersion()
+	mcpState.PreviousImage = &previous
+}
+
+// RollbackCommand returns the command for switching an MCP back to its previous image
+func RollbackCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "rollback",
+		Usage:     "Switch an MCP back to the image it ran before the last upgrade",
+		ArgsUsage: "[name]",
+		Action: func(c *cli.Context) error {
+			if c.NArg() < 1 {
+				return fmt.Errorf("missing required argument: name")
+			}
+
+			name := c.Args().Get(0)
+
+			stateManager, err := state.NewHomeStore()
+			if err != nil {
+				return fmt.Errorf("creating state manager: %w", err)
+			}
+
+			mcpState, err := stateManager.Load(name)
+			if err != nil {
+				return fmt.Errorf("loading MCP state: %w", err)
+			}
+
+			if !mcpState.Installed() {
+				return fmt.Errorf("MCP '%s' is not installed", name)
+			}
+			if mcpState.PreviousImage == nil {
+				return fmt.Errorf("MCP '%s' has no previous image to roll back to", name)
+			}
+
+			current := mcpState.ImageVersion()
+			currentRef := docker.ImageReference(mcpState)
+
+			// Point the tag at the image being restored, and keep the current image
+			// as the previous one so the rollback can be undone
+			mcpState.SetImageVersion(*mcpState.PreviousImage)
+			if err := docker.Tag(docker.ImageReference(mcpState), mcpState.LocalImageTag); err != nil {
+				return fmt.Errorf("restoring previous image: %w", err)
+			}
+			if err := docker.Tag(currentRef, docker.PreviousTag(name)); err != nil {
+				return fmt.Errorf("keeping current image: %w", err)
+			}
+			mcpState.PreviousImage = &current
+
+			if err := stateManager.Save(mcpState); err != nil {
+				return fmt.Errorf("saving MCP state: %w", err)
+			}
+
+			fmt.Printf("MCP '%s' rolled back to %s\n", name, describeVersion(mcpState.ImageVersion()))
+			return nil
+		},
+	}
+}
+
+// describeVersion summarises an image version, e.g. "mcp-x:latest (commit 1a2b3c4d5e6f)"
+func describeVersion(v state.ImageVersion) string {
+	if v.PackageVersion != "" {
+		return fmt.Sprintf("%s (version %s)", v.LocalImageTag, v.PackageVersion)
+	}
+	if v.SourceCommit != "" {
+		return fmt.Sprintf("%s (commit %s)", v.LocalImageTag, shortCommit(v.SourceCommit))
+	}
+	return fmt.Sprintf("%s (digest %s)", v.LocalImageTag, shortDigest(v.ImageDigest))
+}
+
+// shortCommit abbreviates a commit SHA for display
+func shortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
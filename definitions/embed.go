@@ -3,76 +3,237 @@ package definitions
 import (
 	"embed"
 	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/lvrach/smp/internal/config"
-	"gopkg.in/yaml.v3"
+	"github.com/lvrach/smp/internal/source"
 )
 
 //go:embed *.yaml
 //go:embed */Dockerfile
+//go:embed builders/*/Dockerfile.tmpl
 var content embed.FS
 
-// MCPRepository provides access to embedded MCP definitions and Dockerfiles
+// Names of the definition layers that are not git sources
+const (
+	LayerProject  = "project"
+	LayerUser     = "user"
+	LayerEmbedded = "embedded"
+)
+
+// Layer is a set of MCP definitions and Dockerfiles
+type Layer struct {
+	// Name of the layer: project, user, embedded or the name of a git source
+	Name string
+
+	// Directory the layer is read from, empty for embedded definitions
+	Dir string
+
+	fs fs.FS
+}
+
+// MCPRepository provides access to MCP definitions and Dockerfiles merged from
+// several layers. Earlier layers take precedence: project-local definitions in
+// .smp/definitions when added with AddProject, user definitions in
+// ~/.smp/definitions, registered git sources in registration order, and finally
+// the definitions embedded in smp.
 type MCPRepository struct {
-	fs embed.FS
+	layers []Layer
 }
 
-// NewRepository creates a new MCPRepository instance
+// NewRepository creates a new MCPRepository instance with the user, source and
+// embedded definition layers. Project definitions are left out, as any directory
+// smp runs in could provide them.
 func NewRepository() *MCPRepository {
-	return &MCPRepository{
-		fs: content,
+	r := &MCPRepository{}
+
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		r.addDir(LayerUser, filepath.Join(homeDir, ".smp", "definitions"))
 	}
+
+	if sourceStore, err := source.NewHomeStore(); err == nil {
+		// A broken sources file should not hide the other layers
+		sources, _ := sourceStore.List()
+		for _, src := range sources {
+			r.addDir(src.Name, sourceStore.DefinitionsDir(src.Name))
+		}
+	}
+
+	r.layers = append(r.layers, Layer{Name: LayerEmbedded, fs: content})
+
+	return r
+}
+
+// ProjectDir returns the project definitions directory of the current directory
+func ProjectDir() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+	return filepath.Join(cwd, ".smp", "definitions"), nil
+}
+
+// AddProject adds the project definitions of the current directory with the
+// highest precedence, if there are any
+func (r *MCPRepository) AddProject() error {
+	dir, err := ProjectDir()
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil
+	}
+	r.PrependDirectory(LayerProject, dir)
+	return nil
+}
+
+// PrependDirectory adds a directory of definitions with the highest precedence,
+// e.g. the project directory an MCP was installed from
+func (r *MCPRepository) PrependDirectory(name, dir string) {
+	r.layers = append([]Layer{{Name: name, Dir: dir, fs: os.DirFS(dir)}}, r.layers...)
+}
+
+// Layers returns the definition layers in order of precedence
+func (r *MCPRepository) Layers() []Layer {
+	return r.layers
 }
 
 // ListMCPs returns a list of all available MCP names
 func (r *MCPRepository) ListMCPs() ([]string, error) {
+	seen := make(map[string]bool)
 	var mcps []string
 
-	entries, err := r.fs.ReadDir(".")
-	if err != nil {
-		return nil, fmt.Errorf("failed to read embedded definitions: %w", err)
-	}
+	for _, layer := range r.layers {
+		entries, err := fs.ReadDir(layer.fs, ".")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s definitions: %w", layer.Name, err)
+		}
 
-	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".yaml") {
-			// Remove .yaml extension to get MCP name
-			mcpName := strings.TrimSuffix(entry.Name(), ".yaml")
-			mcps = append(mcps, mcpName)
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".yaml") {
+				// Remove .yaml extension to get MCP name
+				mcpName := strings.TrimSuffix(entry.Name(), ".yaml")
+				if !seen[mcpName] {
+					seen[mcpName] = true
+					mcps = append(mcps, mcpName)
+				}
+			}
 		}
 	}
 
+	sort.Strings(mcps)
 	return mcps, nil
 }
 
+// Layer returns the layer that provides the definition of a specific MCP
+func (r *MCPRepository) Layer(name string) (*Layer, error) {
+	yamlPath := fmt.Sprintf("%s.yaml", name)
+
+	for i, layer := range r.layers {
+		if _, err := fs.Stat(layer.fs, yamlPath); err == nil {
+			return &r.layers[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("MCP '%s' not found", name)
+}
+
 // MCPConfig returns the configuration for a specific MCP
 func (r *MCPRepository) MCPConfig(name string) (*config.MCPConfig, error) {
-	// Construct the path to the YAML file
+	file, data, err := r.ReadDefinition(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse and validate the YAML data
+	mcpConfig, err := r.Decode(file, data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Local sources are relative to the definition, wherever smp runs from
+	if mcpConfig.Source != nil && filepath.IsAbs(file) {
+		resolveSource(mcpConfig.Source, filepath.Dir(file))
+	}
+	if mcpConfig.Verify != nil && filepath.IsAbs(file) {
+		resolveKey(mcpConfig.Verify, filepath.Dir(file))
+	}
+
+	return mcpConfig, nil
+}
+
+// resolveSource makes the paths of a local source absolute
+func resolveSource(src *config.Source, dir string) {
+	if src.Path != "" && !filepath.IsAbs(src.Path) {
+		src.Path = filepath.Join(dir, src.Path)
+	}
+	if src.Archive != "" && !filepath.IsAbs(src.Archive) {
+		src.Archive = filepath.Join(dir, src.Archive)
+	}
+}
+
+// resolveKey makes the path of a verification key file absolute
+func resolveKey(policy *config.VerifyPolicy, dir string) {
+	if policy.Key != "" && !strings.HasPrefix(policy.Key, "-----BEGIN") && !filepath.IsAbs(policy.Key) {
+		policy.Key = filepath.Join(dir, policy.Key)
+	}
+}
+
+// ReadDefinition returns the path and raw content of the definition of a specific MCP
+func (r *MCPRepository) ReadDefinition(name string) (string, []byte, error) {
+	layer, err := r.Layer(name)
+	if err != nil {
+		return "", nil, err
+	}
+
 	yamlPath := fmt.Sprintf("%s.yaml", name)
 
 	// Read the YAML file
-	data, err := r.fs.ReadFile(yamlPath)
+	data, err := fs.ReadFile(layer.fs, yamlPath)
 	if err != nil {
-		return nil, fmt.Errorf("MCP '%s' not found: %w", name, err)
+		return "", nil, fmt.Errorf("MCP '%s' not found: %w", name, err)
 	}
 
-	// Parse the YAML data
-	var mcpConfig config.MCPConfig
-	if err := yaml.Unmarshal(data, &mcpConfig); err != nil {
-		return nil, fmt.Errorf("failed to parse MCP configuration: %w", err)
+	if layer.Dir == "" {
+		return path.Join(layer.Name, yamlPath), data, nil
 	}
-
-	return &mcpConfig, nil
+	return filepath.Join(layer.Dir, yamlPath), data, nil
 }
 
 // Dockerfile returns the Dockerfile content for a specific MCP
 func (r *MCPRepository) Dockerfile(dockerfilePath string) ([]byte, error) {
+	for _, layer := range r.layers {
+		// Read the Dockerfile
+		data, err := fs.ReadFile(layer.fs, dockerfilePath)
+		if err == nil {
+			return data, nil
+		}
+	}
 
-	// Read the Dockerfile
-	data, err := r.fs.ReadFile(dockerfilePath)
-	if err != nil {
-		return nil, fmt.Errorf("Dockerfile '%s' not found: %w", dockerfilePath, err)
+	return nil, fmt.Errorf("Dockerfile '%s' not found", dockerfilePath)
+}
+
+// BuilderTemplate returns the Dockerfile template of a builder, e.g. node-npx
+func (r *MCPRepository) BuilderTemplate(name string) ([]byte, error) {
+	templatePath := path.Join("builders", name, "Dockerfile.tmpl")
+	for _, layer := range r.layers {
+		data, err := fs.ReadFile(layer.fs, templatePath)
+		if err == nil {
+			return data, nil
+		}
 	}
 
-	return data, nil
+	return nil, fmt.Errorf("builder '%s' not found", name)
+}
+
+func (r *MCPRepository) addDir(name, dir string) {
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return
+	}
+	r.layers = append(r.layers, Layer{Name: name, Dir: dir, fs: os.DirFS(dir)})
 }
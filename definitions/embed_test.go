@@ -0,0 +1,25 @@
+package definitions_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/lvrach/smp/definitions"
+)
+
+func TestNewRepositoryLeavesHomeAlone(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	if _, err := definitions.NewRepository().ListMCPs(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		t.Errorf("NewRepository created %s", entry.Name())
+	}
+}
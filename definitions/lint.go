@@ -0,0 +1,445 @@
+package definitions
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lvrach/smp/internal/config"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// schemaJSON is the JSON Schema every MCP definition must satisfy
+//
+//go:embed schema.json
+var schemaJSON string
+
+var definitionSchema = jsonschema.MustCompileString("schema.json", schemaJSON)
+
+// quotedName matches the property names quoted in additionalProperties errors
+var quotedName = regexp.MustCompile(`'((?:[^'\\]|\\.)*)'`)
+
+// reservedNames are names an MCP cannot have because they are subcommands of
+// commands that take an MCP name, such as smp audit log
+var reservedNames = []string{"log"}
+
+// Problem is an issue found in an MCP definition
+type Problem struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", p.File, p.Line, p.Column, p.Message)
+}
+
+// ValidationError lists the problems that make an MCP definition invalid
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		lines[i] = p.String()
+	}
+	return "invalid MCP definition:\n  " + strings.Join(lines, "\n  ")
+}
+
+// Decode strictly decodes an MCP definition, rejecting it if Lint finds any problem
+func (r *MCPRepository) Decode(file string, data []byte) (*config.MCPConfig, error) {
+	if problems := r.Lint(file, data); len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	var mcpConfig config.MCPConfig
+	if err := decoder.Decode(&mcpConfig); err != nil {
+		return nil, fmt.Errorf("failed to parse MCP configuration: %w", err)
+	}
+
+	return &mcpConfig, nil
+}
+
+// Lint checks an MCP definition against the definition schema, then checks that its
+// name matches the file name, that referenced Dockerfiles exist in the repository and
+// that variables, groups and conditions are consistent
+func (r *MCPRepository) Lint(file string, data []byte) []Problem {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return []Problem{{File: file, Line: yamlErrorLine(err), Column: 1, Message: err.Error()}}
+	}
+	if len(root.Content) == 0 {
+		return []Problem{{File: file, Line: 1, Column: 1, Message: "definition is empty"}}
+	}
+
+	l := &linter{file: file, nodes: make(map[string]*yaml.Node)}
+	doc := root.Content[0]
+
+	value, err := l.value(doc, "")
+	if err != nil {
+		return []Problem{{File: file, Line: doc.Line, Column: doc.Column, Message: err.Error()}}
+	}
+
+	if err := definitionSchema.Validate(value); err != nil {
+		if verr, ok := err.(*jsonschema.ValidationError); ok {
+			l.schemaProblems(verr)
+		} else {
+			l.add("", err.Error())
+		}
+	}
+
+	// Semantic checks run on whatever decodes, so all problems are reported at once
+	var mcpConfig config.MCPConfig
+	if err := doc.Decode(&mcpConfig); err == nil {
+		l.check(r, &mcpConfig)
+	}
+
+	sort.SliceStable(l.problems, func(i, j int) bool {
+		if l.problems[i].Line != l.problems[j].Line {
+			return l.problems[i].Line < l.problems[j].Line
+		}
+		return l.problems[i].Column < l.problems[j].Column
+	})
+	return l.problems
+}
+
+// linter collects problems and maps JSON pointers into the definition to YAML nodes
+type linter struct {
+	file     string
+	nodes    map[string]*yaml.Node
+	problems []Problem
+}
+
+// add reports a problem at the node found at a JSON pointer into the definition
+func (l *linter) add(ptr string, format string, args ...interface{}) {
+	line, column := 1, 1
+	if node, ok := l.nodes[ptr]; ok {
+		line, column = node.Line, node.Column
+	}
+	l.problems = append(l.problems, Problem{
+		File:    l.file,
+		Line:    line,
+		Column:  column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// value converts a YAML node into a JSON value for schema validation, recording
+// the node of every value and of every mapping key by JSON pointer
+func (l *linter) value(node *yaml.Node, ptr string) (interface{}, error) {
+	l.nodes[ptr] = node
+
+	switch node.Kind {
+	case yaml.AliasNode:
+		return l.value(node.Alias, ptr)
+	case yaml.MappingNode:
+		object := make(map[string]interface{})
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, val := node.Content[i], node.Content[i+1]
+			childPtr := ptr + "/" + escapePointer(key.Value)
+			v, err := l.value(val, childPtr)
+			if err != nil {
+				return nil, err
+			}
+			object[key.Value] = v
+			l.nodes[childPtr+"#key"] = key
+		}
+		return object, nil
+	case yaml.SequenceNode:
+		array := make([]interface{}, len(node.Content))
+		for i, item := range node.Content {
+			v, err := l.value(item, ptr+"/"+strconv.Itoa(i))
+			if err != nil {
+				return nil, err
+			}
+			array[i] = v
+		}
+		return array, nil
+	default:
+		var v interface{}
+		if err := node.Decode(&v); err != nil {
+			return nil, err
+		}
+		if t, ok := v.(time.Time); ok {
+			return t.Format(time.RFC3339), nil
+		}
+		return v, nil
+	}
+}
+
+// schemaProblems reports the leaf errors of a schema validation error
+func (l *linter) schemaProblems(verr *jsonschema.ValidationError) {
+	if len(verr.Causes) > 0 {
+		for _, cause := range verr.Causes {
+			l.schemaProblems(cause)
+		}
+		return
+	}
+
+	// Report unknown fields one by one, at their keys
+	if strings.HasSuffix(verr.KeywordLocation, "/additionalProperties") {
+		for _, match := range quotedName.FindAllStringSubmatch(verr.Message, -1) {
+			name := strings.ReplaceAll(match[1], `\'`, `'`)
+			l.add(verr.InstanceLocation+"/"+escapePointer(name)+"#key", "%s: unknown field %q", displayPath(verr.InstanceLocation), name)
+		}
+		return
+	}
+
+	l.add(verr.InstanceLocation, "%s: %s", displayPath(verr.InstanceLocation), verr.Message)
+}
+
+// check reports problems the schema cannot express
+func (l *linter) check(r *MCPRepository, mcpConfig *config.MCPConfig) {
+	expected := strings.TrimSuffix(filepath.Base(l.file), filepath.Ext(l.file))
+	if mcpConfig.Name != expected {
+		l.add("/name", "name %q does not match file name %q", mcpConfig.Name, expected)
+	}
+	for _, reserved := range reservedNames {
+		if mcpConfig.Name == reserved {
+			l.add("/name", "name %q is reserved by smp", mcpConfig.Name)
+		}
+	}
+
+	// Exactly one way of obtaining the image
+	var origins []string
+	for _, origin := range []struct {
+		field string
+		set   bool
+	}{
+		{"repository", mcpConfig.Repository != ""},
+		{"image", mcpConfig.Image != ""},
+		{"source", mcpConfig.Source != nil},
+		{"builder", mcpConfig.Builder != ""},
+		{"npm", mcpConfig.NPM != ""},
+		{"pypi", mcpConfig.PyPI != ""},
+	} {
+		if origin.set {
+			origins = append(origins, origin.field)
+		}
+	}
+	switch {
+	case len(origins) == 0:
+		l.add("", "one of repository, image, source, builder, npm or pypi is required")
+	case len(origins) > 1:
+		l.add("/"+origins[1], "%s cannot be combined with %s", origins[1], origins[0])
+	}
+
+	packaged := mcpConfig.Builder != "" || mcpConfig.NPM != "" || mcpConfig.PyPI != ""
+	if mcpConfig.Builder != "" {
+		if mcpConfig.Package == "" {
+			l.add("/builder", "builder requires a package")
+		}
+		if _, err := r.BuilderTemplate(mcpConfig.Builder); err != nil {
+			l.add("/builder", "builder %q not found in definitions", mcpConfig.Builder)
+		}
+	} else if mcpConfig.Package != "" {
+		l.add("/package", "package requires a builder, use npm or pypi for registry packages")
+	}
+	if !packaged {
+		if mcpConfig.Version != "" {
+			l.add("/version", "version requires a builder, npm or pypi")
+		}
+		if mcpConfig.Entrypoint != "" {
+			l.add("/entrypoint", "entrypoint requires a builder, npm or pypi")
+		}
+	}
+	if mcpConfig.Source != nil && (mcpConfig.Source.Path != "") == (mcpConfig.Source.Archive != "") {
+		l.add("/source", "source must have exactly one of path or archive")
+	}
+	if mcpConfig.Build != nil {
+		if mcpConfig.Image != "" {
+			l.add("/build", "build options require an image that is built, not pulled")
+		}
+		ids := make(map[string]bool)
+		for i, secret := range mcpConfig.Build.Secrets {
+			ptr := fmt.Sprintf("/build/secrets/%d", i)
+			if (secret.Env != "") == (secret.File != "") {
+				l.add(ptr, "build secret %q must have exactly one of env or file", secret.ID)
+			}
+			if ids[secret.ID] {
+				l.add(ptr, "build secret %q is declared more than once", secret.ID)
+			}
+			ids[secret.ID] = true
+		}
+	}
+	for _, field := range []struct {
+		ptr string
+		set bool
+	}{
+		{"/branch", mcpConfig.Branch != ""},
+		{"/ref", mcpConfig.Ref != ""},
+		{"/commit", mcpConfig.Commit != ""},
+		{"/subdir", mcpConfig.Subdir != ""},
+		{"/submodules", mcpConfig.Submodules},
+	} {
+		if field.set && mcpConfig.Repository == "" {
+			l.add(field.ptr, "%s requires a repository to build", strings.TrimPrefix(field.ptr, "/"))
+		}
+	}
+	if mcpConfig.Branch != "" && mcpConfig.Ref != "" {
+		l.add("/ref", "ref cannot be combined with branch, ref names a branch or tag")
+	}
+	if mcpConfig.Subdir != "" {
+		if cleaned := filepath.Clean(mcpConfig.Subdir); cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+			l.add("/subdir", "subdir must stay inside the repository")
+		}
+	}
+	if mcpConfig.Dockerfile != "" {
+		if mcpConfig.Repository == "" && mcpConfig.Source == nil {
+			l.add("/dockerfile", "dockerfile requires a repository or source to build")
+		}
+		if _, err := r.Dockerfile(mcpConfig.Dockerfile); err != nil {
+			l.add("/dockerfile", "dockerfile %q not found in definitions", mcpConfig.Dockerfile)
+		}
+	}
+	if policy := mcpConfig.Verify; policy != nil {
+		keyless := policy.Identity != "" || policy.IdentityRegexp != ""
+		switch {
+		case mcpConfig.Image == "":
+			l.add("/verify", "verify requires an image that is pulled, built images are not signed")
+		case policy.Key == "" && !keyless:
+			l.add("/verify", "verify requires a key or a keyless identity")
+		case policy.Key != "" && keyless:
+			l.add("/verify/key", "key cannot be combined with a keyless identity")
+		case keyless && policy.Issuer == "":
+			l.add("/verify", "keyless verification requires an issuer")
+		}
+		if policy.Identity != "" && policy.IdentityRegexp != "" {
+			l.add("/verify/identity_regexp", "identity_regexp cannot be combined with identity")
+		}
+		if policy.Issuer != "" && !keyless {
+			l.add("/verify/issuer", "issuer requires an identity or identity_regexp")
+		}
+		if policy.IdentityRegexp != "" {
+			if _, err := regexp.Compile(policy.IdentityRegexp); err != nil {
+				l.add("/verify/identity_regexp", "invalid identity_regexp: %v", err)
+			}
+		}
+	}
+
+	features := make(map[string]bool)
+	for i, group := range mcpConfig.Groups {
+		ptr := fmt.Sprintf("/groups/%d", i)
+		if (len(group.OneOf) > 0) == (len(group.AnyOf) > 0) {
+			l.add(ptr, "group %q must have exactly one of one_of or any_of", group.Name)
+		}
+		for _, feature := range group.Features() {
+			if features[feature] {
+				l.add(ptr, "feature %q is declared more than once", feature)
+			}
+			features[feature] = true
+		}
+	}
+
+	variables := make(map[string]bool)
+	for _, envVar := range mcpConfig.EnvironmentVars {
+		variables[envVar.Name] = true
+	}
+
+	seen := make(map[string]bool)
+	for i, envVar := range mcpConfig.EnvironmentVars {
+		ptr := fmt.Sprintf("/environment/%d", i)
+
+		if seen[envVar.Name] {
+			l.add(ptr+"/name", "variable %s is declared more than once", envVar.Name)
+		}
+		seen[envVar.Name] = true
+
+		if envVar.Type == config.TypeEnum && len(envVar.Enum) == 0 {
+			l.add(ptr+"/type", "variable %s of type enum needs enum values", envVar.Name)
+		}
+		if envVar.Type != config.TypeEnum && len(envVar.Enum) > 0 {
+			l.add(ptr+"/enum", "variable %s has enum values but type %s", envVar.Name, envVar.Type)
+		}
+
+		if envVar.Pattern != "" {
+			if _, err := regexp.Compile(envVar.Pattern); err != nil {
+				l.add(ptr+"/pattern", "variable %s has invalid pattern: %v", envVar.Name, err)
+				continue
+			}
+		}
+
+		if envVar.Default != "" {
+			if err := envVar.Validate(envVar.Default); err != nil {
+				l.add(ptr+"/default", "invalid default: %v", err)
+			}
+		}
+		if envVar.Example != "" && !envVar.IsSecret() {
+			if err := envVar.Validate(envVar.Example); err != nil {
+				l.add(ptr+"/example", "invalid example: %v", err)
+			}
+		}
+
+		if envVar.When != "" {
+			name := conditionSubject(envVar.When)
+			if !features[name] && !variables[name] {
+				l.add(ptr+"/when", "condition %q references unknown feature or variable %q", envVar.When, name)
+			}
+		}
+	}
+}
+
+// conditionSubject returns the feature or variable a when: condition refers to
+func conditionSubject(condition string) string {
+	condition = strings.TrimSpace(condition)
+	if name, _, ok := strings.Cut(condition, "!="); ok {
+		return strings.TrimSpace(name)
+	}
+	if name, _, ok := strings.Cut(condition, "="); ok {
+		return strings.TrimSpace(name)
+	}
+	return strings.TrimSpace(strings.TrimPrefix(condition, "!"))
+}
+
+// escapePointer escapes a JSON pointer token the way the schema validator does
+func escapePointer(token string) string {
+	token = strings.ReplaceAll(token, "~", "~0")
+	token = strings.ReplaceAll(token, "/", "~1")
+	return url.PathEscape(token)
+}
+
+// displayPath renders a JSON pointer as a field path, e.g. environment[0].type
+func displayPath(ptr string) string {
+	if ptr == "" {
+		return "definition"
+	}
+
+	var b strings.Builder
+	for _, token := range strings.Split(strings.TrimPrefix(ptr, "/"), "/") {
+		if _, err := strconv.Atoi(token); err == nil {
+			fmt.Fprintf(&b, "[%s]", token)
+			continue
+		}
+		if unescaped, err := url.PathUnescape(token); err == nil {
+			token = unescaped
+		}
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		if b.Len() > 0 {
+			b.WriteString(".")
+		}
+		b.WriteString(token)
+	}
+	return b.String()
+}
+
+// yamlErrorLine extracts the line number from a YAML syntax error
+func yamlErrorLine(err error) int {
+	var line int
+	if _, scanErr := fmt.Sscanf(err.Error(), "yaml: line %d:", &line); scanErr == nil {
+		return line
+	}
+	return 1
+}
@@ -0,0 +1,150 @@
+package definitions_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lvrach/smp/definitions"
+)
+
+// embedded returns a repository of the definitions embedded in smp only
+func embedded(t *testing.T) *definitions.MCPRepository {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	return definitions.NewRepository()
+}
+
+func TestLintEmbeddedDefinitions(t *testing.T) {
+	repo := embedded(t)
+
+	names, err := repo.ListMCPs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) == 0 {
+		t.Fatal("no embedded definitions")
+	}
+
+	for _, name := range names {
+		file, data, err := repo.ReadDefinition(name)
+		if err != nil {
+			t.Fatalf("reading %s: %v", name, err)
+		}
+		for _, problem := range repo.Lint(file, data) {
+			t.Errorf("%s", problem)
+		}
+		if _, err := repo.MCPConfig(name); err != nil {
+			t.Errorf("loading %s: %v", name, err)
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name       string
+		definition string
+		want       []string
+	}{
+		{
+			name:       "valid",
+			definition: "name: fixture\nimage: ghcr.io/org/mcp:1.0\n",
+		},
+		{
+			name:       "empty",
+			definition: "",
+			want:       []string{"fixture.yaml:1:1: definition is empty"},
+		},
+		{
+			name:       "not YAML",
+			definition: "name: [fixture\n",
+			want:       []string{"fixture.yaml:"},
+		},
+		{
+			name:       "unknown field",
+			definition: "name: fixture\nimage: ghcr.io/org/mcp:1.0\nenviroment: []\n",
+			want:       []string{"fixture.yaml:3:1:", "enviroment"},
+		},
+		{
+			name:       "misspelled variable field",
+			definition: "name: fixture\nimage: ghcr.io/org/mcp:1.0\nenvironment:\n  - name: TOKEN\n    type: secret\n    requred: true\n",
+			want:       []string{"fixture.yaml:6:", "requred"},
+		},
+		{
+			name:       "name mismatch",
+			definition: "name: other\nimage: ghcr.io/org/mcp:1.0\n",
+			want:       []string{`fixture.yaml:1:7: name "other" does not match file name "fixture"`},
+		},
+		{
+			name:       "reserved name",
+			definition: "name: log\nimage: ghcr.io/org/mcp:1.0\n",
+			want:       []string{`fixture.yaml:1:7: name "log" is reserved by smp`},
+		},
+		{
+			name:       "no origin",
+			definition: "name: fixture\n",
+			want:       []string{"one of repository, image, source, builder, npm or pypi is required"},
+		},
+		{
+			name:       "image and repository",
+			definition: "name: fixture\nrepository: https://github.com/org/mcp.git\ndockerfile: bun-builder/Dockerfile\nimage: ghcr.io/org/mcp:1.0\n",
+			want:       []string{"fixture.yaml:4:8: image cannot be combined with repository"},
+		},
+		{
+			name:       "missing Dockerfile",
+			definition: "name: fixture\nrepository: https://github.com/org/mcp.git\ndockerfile: missing/Dockerfile\n",
+			want:       []string{`fixture.yaml:3:13: dockerfile "missing/Dockerfile" not found in definitions`},
+		},
+		{
+			name:       "unknown variable type",
+			definition: "name: fixture\nimage: ghcr.io/org/mcp:1.0\nenvironment:\n  - name: PORT\n    type: float\n",
+			want:       []string{"fixture.yaml:5:11:"},
+		},
+		{
+			name:       "invalid default",
+			definition: "name: fixture\nimage: ghcr.io/org/mcp:1.0\nenvironment:\n  - name: PORT\n    type: integer\n    default: eighty\n",
+			want:       []string{"fixture.yaml:6:14: invalid default: PORT must be an integer"},
+		},
+		{
+			name:       "unknown condition",
+			definition: "name: fixture\nimage: ghcr.io/org/mcp:1.0\nenvironment:\n  - name: JIRA_URL\n    when: jira\n",
+			want:       []string{`fixture.yaml:5:11: condition "jira" references unknown feature or variable "jira"`},
+		},
+		{
+			name:       "file secret without file",
+			definition: "name: fixture\nrepository: https://github.com/org/mcp.git\nbuild:\n  secrets:\n    - id: npmrc\n",
+			want:       []string{`build secret "npmrc" must have exactly one of env or file`},
+		},
+	}
+
+	repo := embedded(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := repo.Lint("fixture.yaml", []byte(tt.definition))
+
+			var lines []string
+			for _, problem := range problems {
+				lines = append(lines, problem.String())
+			}
+			got := strings.Join(lines, "\n")
+
+			if len(tt.want) == 0 {
+				if len(problems) > 0 {
+					t.Errorf("got problems:\n%s", got)
+				}
+				return
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("problems lack %q:\n%s", want, got)
+				}
+			}
+
+			_, err := repo.Decode("fixture.yaml", []byte(tt.definition))
+			var verr *definitions.ValidationError
+			if !errors.As(err, &verr) {
+				t.Errorf("Decode() = %v, want a ValidationError", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package definitions
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/lvrach/smp/internal/config"
+)
+
+// Search returns the definitions matching a term, best matches first. The term is
+// matched fuzzily against the name, description and tags; definitions that fail to
+// load are skipped.
+func (r *MCPRepository) Search(term string) ([]*config.MCPConfig, error) {
+	names, err := r.ListMCPs()
+	if err != nil {
+		return nil, err
+	}
+
+	term = strings.ToLower(strings.TrimSpace(term))
+
+	type match struct {
+		config *config.MCPConfig
+		score  int
+	}
+	var matches []match
+
+	for _, name := range names {
+		mcpConfig, err := r.MCPConfig(name)
+		if err != nil {
+			continue
+		}
+
+		if score := searchScore(mcpConfig, term); score > 0 {
+			matches = append(matches, match{config: mcpConfig, score: score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	results := make([]*config.MCPConfig, len(matches))
+	for i, m := range matches {
+		results[i] = m.config
+	}
+	return results, nil
+}
+
+// searchScore rates how well a definition matches a lower-case term, 0 meaning no match
+func searchScore(mcpConfig *config.MCPConfig, term string) int {
+	if term == "" {
+		return 1
+	}
+
+	name := strings.ToLower(mcpConfig.Name)
+	score := 0
+
+	switch {
+	case name == term:
+		score = 100
+	case strings.HasPrefix(name, term):
+		score = 80
+	case strings.Contains(name, term):
+		score = 60
+	case isSubsequence(term, name):
+		score = 30
+	}
+
+	for _, tag := range mcpConfig.Tags {
+		tag = strings.ToLower(tag)
+		switch {
+		case tag == term:
+			score = max(score, 70)
+		case strings.Contains(tag, term):
+			score = max(score, 40)
+		}
+	}
+
+	if strings.Contains(strings.ToLower(mcpConfig.Description), term) {
+		score = max(score, 20)
+	}
+
+	return score
+}
+
+// isSubsequence reports whether the characters of term appear in s in order,
+// so that e.g. "atl" and "mcpatl" match "mcp-atlassian"
+func isSubsequence(term, s string) bool {
+	runes := []rune(term)
+	i := 0
+	for _, c := range s {
+		if i < len(runes) && runes[i] == c {
+			i++
+		}
+	}
+	return i == len(runes)
+}
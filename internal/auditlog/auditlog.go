@@ -0,0 +1,243 @@
+package auditlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Statuses of a tool call. A started record is written when the host makes
+// the call and one with its outcome when it ends, aborted if the session ended
+// before the MCP answered.
+const (
+	StatusStarted   = "started"
+	StatusOK        = "ok"
+	StatusToolError = "tool_error"
+	StatusError     = "error"
+	StatusAborted   = "aborted"
+)
+
+const (
+	// currentFile is the file records are appended to
+	currentFile = "audit.jsonl"
+
+	// lockName is the file smp processes lock to write the log
+	lockName = "audit.lock"
+
+	// maxSize is the size at which the current file is rotated
+	maxSize = 10 << 20
+
+	// keep is the number of rotated files kept
+	keep = 10
+)
+
+// Record is a tool call the host made, or its outcome: the MCP's answer, smp's
+// answer on its behalf, or the end of the session
+type Record struct {
+	// ID links the records of a call
+	ID string `json:"id,omitempty"`
+
+	Time time.Time `json:"time"`
+	MCP  string    `json:"mcp"`
+
+	// Host is the client name the host sent in its initialize request
+	Host string `json:"host,omitempty"`
+	Tool string `json:"tool"`
+
+	// ArgsDigest is the SHA-256 of the canonical JSON arguments
+	ArgsDigest string `json:"args_digest"`
+
+	// Args are the arguments with the values of sensitive keys redacted, empty
+	// if only the digest is recorded
+	Args json.RawMessage `json:"args,omitempty"`
+
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Log is an append-only log of tool calls in JSON lines, rotated by size
+type Log struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// New creates a log of tool calls in dir
+func New(dir string) *Log {
+	return &Log{dir: dir}
+}
+
+// NewHomeLog operates the audit log in the user's home directory
+func NewHomeLog() (*Log, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+	}
+
+	return New(filepath.Join(homeDir, ".smp", "audit")), nil
+}
+
+// Dir returns the directory of the log
+func (l *Log) Dir() string {
+	return l.dir
+}
+
+// Write appends a record, rotating the current file first when it grew too
+// large. Concurrent runs of smp share the log, they take turns through a lock
+// file.
+func (l *Log) Write(record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(l.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create audit directory: %w", err)
+	}
+
+	unlock, err := lockFile(filepath.Join(l.dir, lockName))
+	if err != nil {
+		return fmt.Errorf("failed to lock audit log: %w", err)
+	}
+	defer unlock()
+
+	path := filepath.Join(l.dir, currentFile)
+	if info, err := os.Stat(path); err == nil && info.Size() >= maxSize {
+		if err := l.rotate(path); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// rotate renames the current file after the time of rotation and removes the
+// oldest rotated files
+func (l *Log) rotate(path string) error {
+	rotated := filepath.Join(l.dir, "audit-"+time.Now().UTC().Format("20060102T150405.000000000")+".jsonl")
+	if err := os.Rename(path, rotated); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+
+	files, err := l.rotatedFiles()
+	if err != nil {
+		return err
+	}
+	for len(files) > keep {
+		if err := os.Remove(files[0]); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove rotated audit log: %w", err)
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// rotatedFiles returns the rotated files, oldest first
+func (l *Log) rotatedFiles() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(l.dir, "audit-*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Filter selects records of a log
+type Filter struct {
+	// MCP only selects calls to this MCP
+	MCP string
+
+	// Since only selects calls at or after this time
+	Since time.Time
+}
+
+func (f Filter) match(record Record) bool {
+	if f.MCP != "" && record.MCP != f.MCP {
+		return false
+	}
+	return f.Since.IsZero() || !record.Time.Before(f.Since)
+}
+
+// Read returns the records matching the filter, oldest first. Lines that can't
+// be decoded, such as one cut short by a crash, are skipped.
+func (l *Log) Read(filter Filter) ([]Record, error) {
+	files, err := l.rotatedFiles()
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, filepath.Join(l.dir, currentFile))
+
+	var records []Record
+	for _, path := range files {
+		f, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), maxSize)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			var record Record
+			if json.Unmarshal([]byte(line), &record) != nil {
+				continue
+			}
+			if filter.match(record) {
+				records = append(records, record)
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit log %s: %w", path, err)
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+	return records, nil
+}
+
+// Calls returns the outcome of each call among records, and the started record
+// of calls without one, such as calls in flight when smp was killed
+func Calls(records []Record) []Record {
+	ended := make(map[string]bool)
+	for _, record := range records {
+		if record.ID != "" && record.Status != StatusStarted {
+			ended[record.ID] = true
+		}
+	}
+
+	var calls []Record
+	for _, record := range records {
+		if record.Status == StatusStarted && ended[record.ID] {
+			continue
+		}
+		calls = append(calls, record)
+	}
+	return calls
+}
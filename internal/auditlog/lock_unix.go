@@ -0,0 +1,25 @@
+//go:build darwin || linux
+
+package auditlog
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock on a file shared by every smp process, so
+// only one of them rotates or appends to the log at a time
+func lockFile(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
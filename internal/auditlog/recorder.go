@@ -0,0 +1,219 @@
+package auditlog
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lvrach/smp/internal/proxy"
+	"github.com/lvrach/smp/internal/redact"
+)
+
+// sensitiveKey matches argument names whose values are redacted
+var sensitiveKey = regexp.MustCompile(`(?i)(pass(word|wd)?|secret|token|api[_-]?key|private[_-]?key|credential|authorization|cookie|session)`)
+
+// Recorder is an interceptor writing every tools/call of a session to the audit
+// log when the host makes it, and again with its outcome
+type Recorder struct {
+	mcp      string
+	log      *Log
+	args     bool
+	redactor *redact.Redactor
+	errs     io.Writer
+
+	// session prefixes the IDs of the session's calls
+	session string
+
+	mu   sync.Mutex
+	host string
+
+	// calls are the started records of calls without an outcome, by request ID
+	calls map[string]Record
+}
+
+// NewRecorder creates a recorder of the tool calls to an MCP. With args the
+// arguments are recorded with sensitive keys and whatever redactor matches
+// masked, otherwise only their digest. Failures to write the log are reported
+// to errs.
+func NewRecorder(mcp string, log *Log, args bool, redactor *redact.Redactor, errs io.Writer) *Recorder {
+	session := make([]byte, 8)
+	rand.Read(session)
+	return &Recorder{
+		mcp:      mcp,
+		log:      log,
+		args:     args,
+		redactor: redactor,
+		errs:     errs,
+		session:  hex.EncodeToString(session),
+		calls:    make(map[string]Record),
+	}
+}
+
+// HostMessage notes the name of the host from its initialize request and
+// records the start of tools/call requests
+func (r *Recorder) HostMessage(msg *proxy.Message) *proxy.Message {
+	switch {
+	case msg.Method == "initialize":
+		var params struct {
+			ClientInfo struct {
+				Name string `json:"name"`
+			} `json:"clientInfo"`
+		}
+		if json.Unmarshal(msg.Params, &params) == nil {
+			r.mu.Lock()
+			r.host = params.ClientInfo.Name
+			r.mu.Unlock()
+		}
+	case msg.Method == "tools/call" && msg.IsRequest():
+		record := r.started(msg)
+		r.mu.Lock()
+		r.calls[string(msg.ID)] = record
+		r.mu.Unlock()
+		r.write(record)
+	}
+	return nil
+}
+
+// ServerMessage records the response to a tools/call request
+func (r *Recorder) ServerMessage(msg *proxy.Message, call *proxy.Call) {
+	if call == nil || call.Request.Method != "tools/call" {
+		return
+	}
+
+	r.mu.Lock()
+	record, ok := r.calls[string(msg.ID)]
+	delete(r.calls, string(msg.ID))
+	r.mu.Unlock()
+	if !ok {
+		record = r.started(call.Request)
+		record.Time = call.Start.UTC()
+	}
+
+	record.Status = StatusOK
+	record.DurationMS = time.Since(call.Start).Milliseconds()
+	switch {
+	case msg.Error != nil:
+		record.Status = StatusError
+		record.Error = r.redactor.String(msg.Error.Message)
+	case isToolError(msg.Result):
+		record.Status = StatusToolError
+	}
+	r.write(record)
+}
+
+// Close records the calls still waiting for an answer as aborted, it is called
+// when the session ends
+func (r *Recorder) Close() {
+	r.mu.Lock()
+	calls := r.calls
+	r.calls = make(map[string]Record)
+	r.mu.Unlock()
+
+	for _, record := range calls {
+		record.Status = StatusAborted
+		record.Error = "the session ended before the MCP answered"
+		record.DurationMS = time.Since(record.Time).Milliseconds()
+		r.write(record)
+	}
+}
+
+// started returns the started record of a tools/call request
+func (r *Recorder) started(request *proxy.Message) Record {
+	var params struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	json.Unmarshal(request.Params, &params)
+
+	r.mu.Lock()
+	host := r.host
+	r.mu.Unlock()
+
+	record := Record{
+		ID:         r.session + "-" + strings.Trim(string(request.ID), `"`),
+		Time:       time.Now().UTC(),
+		MCP:        r.mcp,
+		Host:       host,
+		Tool:       params.Name,
+		ArgsDigest: digest(params.Arguments),
+		Status:     StatusStarted,
+	}
+	if r.args && len(params.Arguments) > 0 {
+		record.Args = redactArgs(params.Arguments)
+		if masked, ok := r.redactor.JSON(record.Args); ok {
+			record.Args = masked
+		}
+	}
+	return record
+}
+
+func (r *Recorder) write(record Record) {
+	if err := r.log.Write(record); err != nil {
+		fmt.Fprintf(r.errs, "smp: %s: %v\n", r.mcp, err)
+	}
+}
+
+// isToolError reports whether a tools/call result reports a failure of the tool
+func isToolError(result json.RawMessage) bool {
+	var fields struct {
+		IsError bool `json:"isError"`
+	}
+	return json.Unmarshal(result, &fields) == nil && fields.IsError
+}
+
+// digest returns the SHA-256 of arguments in canonical JSON, with sorted keys
+// and no insignificant whitespace
+func digest(args json.RawMessage) string {
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(args, &value); err == nil {
+		if canonical, err := json.Marshal(value); err == nil {
+			args = canonical
+		}
+	}
+
+	sum := sha256.Sum256(args)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// redactArgs returns arguments with the values of sensitive keys replaced
+func redactArgs(args json.RawMessage) json.RawMessage {
+	var value interface{}
+	if err := json.Unmarshal(args, &value); err != nil {
+		return nil
+	}
+
+	data, err := json.Marshal(redactValue(value))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if sensitiveKey.MatchString(key) {
+				v[key] = redact.Placeholder
+			} else {
+				v[key] = redactValue(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+	}
+	return value
+}
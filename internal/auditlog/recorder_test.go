@@ -0,0 +1,93 @@
+package auditlog_test
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/lvrach/smp/internal/auditlog"
+	"github.com/lvrach/smp/internal/proxy"
+	"github.com/lvrach/smp/internal/redact"
+)
+
+func call(id, tool string) *proxy.Message {
+	return &proxy.Message{
+		JSONRPC: "2.0",
+		ID:      json.RawMessage(id),
+		Method:  "tools/call",
+		Params:  json.RawMessage(`{"name":"` + tool + `","arguments":{"key":"ABC-1","api_token":"s3cr3t"}}`),
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	log := auditlog.New(t.TempDir())
+	r := auditlog.NewRecorder("jira", log, true, redact.New(nil), io.Discard)
+
+	r.HostMessage(&proxy.Message{JSONRPC: "2.0", ID: json.RawMessage("1"), Method: "initialize", Params: json.RawMessage(`{"clientInfo":{"name":"claude-code"}}`)})
+
+	answered, failed, unanswered := call("2", "get_issue"), call(`"three"`, "update_issue"), call("4", "delete_issue")
+	for _, msg := range []*proxy.Message{answered, failed, unanswered} {
+		r.HostMessage(msg)
+	}
+
+	records, err := log.Read(auditlog.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records after the calls, want 3 started records", len(records))
+	}
+	for _, record := range records {
+		if record.Status != auditlog.StatusStarted || record.Host != "claude-code" {
+			t.Errorf("unexpected record %+v", record)
+		}
+	}
+
+	start := time.Now()
+	r.ServerMessage(&proxy.Message{JSONRPC: "2.0", ID: answered.ID, Result: json.RawMessage(`{"content":[]}`)}, &proxy.Call{Request: answered, Start: start})
+	r.ServerMessage(&proxy.Message{JSONRPC: "2.0", ID: failed.ID, Result: json.RawMessage(`{"isError":true}`)}, &proxy.Call{Request: failed, Start: start})
+	r.Close()
+
+	records, err = log.Read(auditlog.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 6 {
+		t.Fatalf("got %d records, want 3 started and 3 outcomes", len(records))
+	}
+
+	calls := auditlog.Calls(records)
+	want := map[string]string{
+		"get_issue":    auditlog.StatusOK,
+		"update_issue": auditlog.StatusToolError,
+		"delete_issue": auditlog.StatusAborted,
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("got %d calls, want %d: %+v", len(calls), len(want), calls)
+	}
+	for _, record := range calls {
+		if record.Status != want[record.Tool] {
+			t.Errorf("%s: status %q, want %q", record.Tool, record.Status, want[record.Tool])
+		}
+		if string(record.Args) != `{"api_token":"[REDACTED]","key":"ABC-1"}` {
+			t.Errorf("%s: args %s not redacted", record.Tool, record.Args)
+		}
+	}
+
+	// A call in flight when smp was killed keeps its started record
+	var killed []auditlog.Record
+	for _, record := range records {
+		if record.Status != auditlog.StatusAborted {
+			killed = append(killed, record)
+		}
+	}
+	for _, record := range auditlog.Calls(killed) {
+		if record.Tool == "delete_issue" && record.Status != auditlog.StatusStarted {
+			t.Errorf("unfinished call recorded as %q, want %q", record.Status, auditlog.StatusStarted)
+		}
+	}
+	if got := len(auditlog.Calls(killed)); got != 3 {
+		t.Errorf("got %d calls, want 3", got)
+	}
+}
@@ -5,11 +5,17 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"time"
 
 	"github.com/lvrach/smp/definitions"
 	"github.com/lvrach/smp/internal/config"
+	"github.com/lvrach/smp/internal/docker"
 	"github.com/lvrach/smp/internal/git"
-	"github.com/lvrach/smp/internal/state"
+	"github.com/lvrach/smp/internal/paths"
+	"github.com/lvrach/smp/internal/registry"
+	"github.com/lvrach/smp/internal/sbom"
+	"github.com/lvrach/smp/internal/verify"
 )
 
 const tagPrefix = "mcp-"
@@ -18,132 +24,518 @@ const tagPrefix = "mcp-"
 type Builder struct {
 	Config  *config.MCPConfig
 	TempDir string
-	State   *state.MCPServer
+
+	// Repository holds the definitions the MCP was resolved from, its Dockerfiles
+	// and builder templates are read from the same layers
+	Repository *definitions.MCPRepository
+
+	// NoCache rebuilds the image even if one was built from the same inputs
+	NoCache bool
+
+	// PackageVersion is the resolved version of the npm or PyPI package to build,
+	// resolved from the definition's version if empty
+	PackageVersion string
 }
 
-// NewBuilder creates a new builder for the given MCP config
-func NewBuilder(mcpConfig *config.MCPConfig) (*Builder, error) {
+// Image is the Docker image an MCP runs from
+type Image struct {
+	// Tag used to run the image
+	Tag string
+
+	// Digest identifying the image content: the image ID of built images and
+	// the registry digest of pulled images
+	Digest string
+
+	// Commit of the source repository the image was built from, empty for pulled images
+	Commit string
+
+	// Version of the npm or PyPI package the image was built from
+	Version string
+
+	// Time the image was built, zero for pulled images
+	BuiltAt time.Time
+
+	// Whether the image's signature was verified against the definition's policy
+	Verified bool
+}
+
+// NewBuilder creates a new builder for the given MCP config resolved from repo
+func NewBuilder(repo *definitions.MCPRepository, mcpConfig *config.MCPConfig) (*Builder, error) {
 	// Create a temporary directory for the build
 	tempDir, err := os.MkdirTemp("", fmt.Sprintf("mcp-%s-", mcpConfig.Name))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
 	}
 
-	// Initialize state manager
-	homeDir, err := os.UserHomeDir()
+	return &Builder{
+		Config:     mcpConfig,
+		TempDir:    tempDir,
+		Repository: repo,
+	}, nil
+}
+
+// CleanUp removes the temporary directory
+func (b *Builder) CleanUp() error {
+	return os.RemoveAll(b.TempDir)
+}
+
+// DockerImage builds or resolves the image the MCP runs from and records the
+// SBOM of the image
+func (b *Builder) DockerImage() (*Image, error) {
+	image, err := b.dockerImage()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+		return nil, err
+	}
+
+	b.recordSBOM(image)
+	return image, nil
+}
+
+func (b *Builder) dockerImage() (*Image, error) {
+	switch b.Config.Strategy() {
+	case config.StrategyRepository:
+		return b.BuildFromRepo()
+	case config.StrategyImage:
+		return b.PullImage()
+	case config.StrategyLocal:
+		return b.BuildFromLocal()
+	case config.StrategyBuilder:
+		return b.BuildFromTemplate()
+	case config.StrategyRegistry:
+		return b.BuildFromRegistry()
+	}
+
+	return nil, fmt.Errorf("not sure how to build the image for MCP '%s'", b.Config.Name)
+}
+
+// PullImage pulls the MCP's prebuilt image and resolves its registry digest.
+// Images pinned with @sha256: in the definition are pulled by that digest.
+func (b *Builder) PullImage() (*Image, error) {
+	fmt.Printf("Pulling image %s...\n", b.Config.Image)
+	if err := docker.Pull(b.Config.Image); err != nil {
+		return nil, fmt.Errorf("failed to pull image: %w", err)
+	}
+
+	digest := docker.Digest(b.Config.Image)
+	if digest == "" {
+		var err error
+		digest, err = docker.RepoDigest(b.Config.Image)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	image := &Image{
+		Tag:    b.Config.Image,
+		Digest: digest,
+	}
+
+	if policy := b.Config.Verify; policy != nil {
+		ref := docker.Repository(b.Config.Image) + "@" + digest
+		fmt.Printf("Verifying signature of %s...\n", ref)
+		if err := verify.Image(policy, ref); err != nil {
+			if policy.Enforced() {
+				return nil, err
+			}
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		} else {
+			image.Verified = true
+		}
 	}
 
-	stateManager, err := state.NewStore(filepath.Join(homeDir, ".mcp"))
+	return image, nil
+}
+
+// recordSBOM lists the packages of an image in the SBOM store, unless the image
+// was already scanned. A failed scan is only reported, smp audit retries it.
+func (b *Builder) recordSBOM(image *Image) {
+	store, err := sbom.NewHomeStore()
+	if err != nil || store.Exists(b.Config.Name, image.Digest) {
+		return
+	}
+
+	ref := image.Tag
+	if !image.BuiltAt.IsZero() && image.Digest != "" {
+		ref = image.Digest
+	}
+
+	fmt.Printf("Generating SBOM of %s...\n", image.Tag)
+	doc, err := sbom.Generate(b.Config.Name, ref, image.Digest)
+	if err == nil {
+		err = store.Save(doc)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize state manager: %w", err)
+		fmt.Fprintf(os.Stderr, "Warning: failed to record SBOM: %v\n", err)
 	}
+}
+
+// BuildFromRepo clones a repository and builds a Docker image, unless an image
+// was already built from the same commit and Dockerfile
+func (b *Builder) BuildFromRepo() (*Image, error) {
+	if !b.NoCache {
+		latest, err := b.LatestCommit()
+		if err != nil {
+			return nil, err
+		}
 
-	// Load or create MCP state
-	mcpState, err := stateManager.Load(mcpConfig.Name)
+		image, err := b.CachedImage(latest)
+		if err != nil {
+			return nil, err
+		}
+		if image != nil {
+			return image, nil
+		}
+	}
+
+	dir, commit, err := b.Source()
 	if err != nil {
-		return nil, fmt.Errorf("failed to load MCP state: %w", err)
+		return nil, err
 	}
 
-	return &Builder{
-		Config:  mcpConfig,
-		TempDir: tempDir,
-		State:   mcpState,
-	}, nil
+	// Build the Docker image
+	return b.BuildSource(dir, commit)
 }
 
-// CleanUp removes the temporary directory
-func (b *Builder) CleanUp() error {
-	return os.RemoveAll(b.TempDir)
+// BuildFromLocal builds a Docker image from the MCP's local directory or archive
+func (b *Builder) BuildFromLocal() (*Image, error) {
+	dir, err := b.LocalSource()
+	if err != nil {
+		return nil, err
+	}
+
+	return b.buildImage(dir, "")
 }
 
-func (b *Builder) DockerImage() (string, error) {
+// BuildFromTemplate builds a Docker image for an MCP package from the definition's
+// builder template, with an empty build context
+func (b *Builder) BuildFromTemplate() (*Image, error) {
+	contextDir := filepath.Join(b.TempDir, "context")
+	if err := os.MkdirAll(contextDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create build context: %w", err)
+	}
+
+	return b.buildImage(contextDir, "")
+}
 
-	if b.Config.Repository != "" && b.Config.Dockerfile == "" {
-		return b.BuildFromRepo()
-	} else if b.Config.Image != "" {
-		return b.Config.Image, nil
+// BuildFromRegistry resolves the version of the MCP's npm or PyPI package and builds
+// it with the registry's builder template, unless that version was built before
+func (b *Builder) BuildFromRegistry() (*Image, error) {
+	if b.PackageVersion == "" {
+		version, err := b.LatestVersion()
+		if err != nil {
+			return nil, err
+		}
+		b.PackageVersion = version
+	}
+
+	image, err := b.CachedImage("")
+	if err != nil || image != nil {
+		return image, err
+	}
+
+	image, err = b.BuildFromTemplate()
+	if err != nil {
+		return nil, err
 	}
+	image.Version = b.PackageVersion
 
-	return "", fmt.Errorf("not sure how to build the image for MCP '%s'", b.Config.Name)
+	return image, nil
 }
 
-// BuildFromRepo clones a repository and builds a Docker image
-func (b *Builder) BuildFromRepo() (string, error) {
-	// Clone the repository to a temporary directory
-	fmt.Printf("Cloning repository %s...\n", b.Config.Repository)
-	tempDir, err := git.CloneRepository(b.Config.Repository, b.Config.Branch)
+// LatestDigest returns the registry digest of the MCP's prebuilt image an
+// upgrade would pull, without pulling it
+func (b *Builder) LatestDigest() (string, error) {
+	digest, err := docker.RemoteDigest(b.Config.Image)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve digest of %s: %w", b.Config.Image, err)
+	}
+	return digest, nil
+}
+
+// LatestVersion returns the version of the MCP's package an upgrade would build:
+// the version or tag the definition asks for, or the latest release
+func (b *Builder) LatestVersion() (string, error) {
+	kind, pkg := b.Config.RegistryPackage()
+	reg, err := registry.New(kind)
 	if err != nil {
-		return "", fmt.Errorf("failed to clone repository: %w", err)
+		return "", err
 	}
-	// Clean up the temporary directory when done
-	defer os.RemoveAll(tempDir)
 
-	// Update the builder's path to use the cloned repository
-	b.TempDir = tempDir
+	version, err := reg.Resolve(pkg, b.Config.Version)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve version: %w", err)
+	}
+	return version, nil
+}
 
-	// Build the Docker image
-	return b.buildImage()
+// LocalSource returns the build context of an MCP built from a local source,
+// extracting archives into the build directory
+func (b *Builder) LocalSource() (string, error) {
+	src := b.Config.Source
+
+	if src.Path != "" {
+		info, err := os.Stat(src.Path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read source directory: %w", err)
+		}
+		if !info.IsDir() {
+			return "", fmt.Errorf("source path %s is not a directory", src.Path)
+		}
+		fmt.Printf("Using source directory %s...\n", src.Path)
+		return src.Path, nil
+	}
+
+	fmt.Printf("Extracting archive %s...\n", src.Archive)
+	contextDir := filepath.Join(b.TempDir, "src")
+	if err := extractArchive(src.Archive, contextDir); err != nil {
+		return "", err
+	}
+	return archiveRoot(contextDir)
+}
+
+// Source clones the MCP's repository into the build directory at the pinned commit,
+// or the tip of its branch or tag, and returns the checkout directory and commit
+func (b *Builder) Source() (string, string, error) {
+	// Clone the repository into the build directory
+	fmt.Printf("Cloning repository %s...\n", b.Config.Repository)
+	contextDir := filepath.Join(b.TempDir, "src")
+	if err := git.Clone(b.Config.Repository, b.Config.GitRef(), contextDir); err != nil {
+		return "", "", fmt.Errorf("failed to clone repository: %w", err)
+	}
+
+	// Check out the pinned commit instead of the branch tip
+	if b.Config.Commit != "" {
+		if err := git.Checkout(contextDir, b.Config.Commit); err != nil {
+			return "", "", err
+		}
+	}
+
+	if b.Config.Submodules {
+		if err := git.UpdateSubmodules(contextDir); err != nil {
+			return "", "", err
+		}
+	}
+
+	commit, err := git.HeadCommit(contextDir)
+	if err != nil {
+		return "", "", err
+	}
+
+	return contextDir, commit, nil
 }
 
-// BuildImage builds the Docker image using the Docker package
-func (b *Builder) buildImage() (string, error) {
-	// Get embedded repository
-	repo := definitions.NewRepository()
-	tag := fmt.Sprintf("mcp-%s:latest", b.Config.Name)
+// BuildSource builds the Docker image from a checkout made by Source, using the
+// definition's subdirectory of it as the build context
+func (b *Builder) BuildSource(dir, commit string) (*Image, error) {
+	contextDir := filepath.Join(dir, b.Config.Subdir)
+	if info, err := os.Stat(contextDir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("subdir %s not found in repository", b.Config.Subdir)
+	}
 
-	// Try to get Dockerfile from embedded definitions first
-	dockerfileContent, err := repo.Dockerfile(b.Config.Dockerfile)
+	image, err := b.buildImage(contextDir, commit)
 	if err != nil {
-		return tag, fmt.Errorf("failed to get Dockerfile from embedded definitions: %w", err)
+		return nil, err
 	}
+	image.Commit = commit
 
-	// Write Dockerfile to temporary directory
-	outputPath := filepath.Join(b.TempDir, "Dockerfile")
-	if err := os.WriteFile(outputPath, dockerfileContent, 0644); err != nil {
-		return tag, fmt.Errorf("failed to write Dockerfile to temp dir: %w", err)
+	return image, nil
+}
+
+// LatestCommit returns the commit an upgrade would build: the pinned commit, or
+// the commit the MCP's branch or tag currently points to
+func (b *Builder) LatestCommit() (string, error) {
+	if b.Config.Commit != "" {
+		return b.Config.Commit, nil
 	}
+	return git.RemoteCommit(b.Config.Repository, b.Config.GitRef())
+}
 
-	fmt.Println("overriding Dockerfile: ", outputPath)
+// buildImage builds the Docker image from a build context directory, labelling it
+// with the source repository and commit
+func (b *Builder) buildImage(contextDir, commit string) (*Image, error) {
+	tag := b.tag()
+
+	dockerfileContent, err := b.dockerfile()
+	if err != nil {
+		return nil, err
+	}
+
+	// Override the source's Dockerfile if the definition provides one
+	var dockerfilePath string
+	if dockerfileContent != nil {
+		// Write the Dockerfile next to, not into, the build context, which may be
+		// a local checkout that must not be modified
+		dockerfilePath = filepath.Join(b.TempDir, "Dockerfile")
+		if err := os.WriteFile(dockerfilePath, dockerfileContent, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write Dockerfile to temp dir: %w", err)
+		}
+
+		fmt.Println("overriding Dockerfile: ", dockerfilePath)
+	}
 
 	// Build the image
 	fmt.Printf("Building Docker image for MCP '%s'...\n", b.Config.Name)
 
 	// Prepare build args
-	args := []string{"build", "-t", tagPrefix + b.Config.Name}
+	args := []string{"build", "-t", tag}
+	if dockerfilePath != "" {
+		args = append(args, "-f", dockerfilePath)
+	}
+	if b.NoCache {
+		args = append(args, "--no-cache")
+	}
+	buildArgs, err := b.buildArgs()
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, buildArgs...)
+	// Only builds of a commit or package version can be reused, local sources
+	// and unresolved versions change without one
+	if commit != "" || b.PackageVersion != "" {
+		key, err := b.CacheKey(commit)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--label", CacheKeyLabel+"="+key)
+	}
+	if b.Config.Repository != "" {
+		args = append(args, "--label", "org.opencontainers.image.source="+b.Config.Repository)
+	}
+	if commit != "" {
+		args = append(args, "--label", "org.opencontainers.image.revision="+commit)
+	}
 
 	// Add Dockerfile path and context
-	args = append(args, b.TempDir)
+	args = append(args, contextDir)
 
 	// Execute docker build command
 	cmd := exec.Command("docker", args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	if b.Config.Build != nil && len(b.Config.Build.Secrets) > 0 {
+		// Secrets need BuildKit, which older Docker versions only use when asked
+		cmd.Env = append(os.Environ(), "DOCKER_BUILDKIT=1")
+	}
 
-	err = cmd.Run()
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to build Docker image: %w", err)
+	}
+
+	digest, err := docker.ImageID(tag)
 	if err != nil {
-		return tag, fmt.Errorf("failed to build Docker image: %w", err)
+		return nil, err
 	}
 
-	// Update state with the new image tag
-	b.State.SetLocalImageTag(fmt.Sprintf("mcp-%s:latest", b.Config.Name))
+	fmt.Printf("Docker image '%s' built successfully\n", b.Config.Name)
+	return &Image{
+		Tag:     tag,
+		Digest:  digest,
+		BuiltAt: time.Now().UTC(),
+	}, nil
+}
 
-	// Save the updated state
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return tag, fmt.Errorf("failed to get user home directory: %w", err)
+// dockerfile returns the Dockerfile the definition builds with: its rendered builder
+// template or its Dockerfile override, nil to use the source's own Dockerfile
+func (b *Builder) dockerfile() ([]byte, error) {
+	repo := b.Repository
+
+	switch {
+	case b.templateName() != "":
+		tmpl, err := repo.BuilderTemplate(b.templateName())
+		if err != nil {
+			return nil, err
+		}
+		return b.renderTemplate(tmpl)
+	case b.Config.Dockerfile != "":
+		dockerfile, err := repo.Dockerfile(b.Config.Dockerfile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Dockerfile from definitions: %w", err)
+		}
+		return dockerfile, nil
+	}
+
+	return nil, nil
+}
+
+// buildArgs returns the docker build arguments for the definition's build options
+func (b *Builder) buildArgs() ([]string, error) {
+	opts := b.Config.Build
+	if opts == nil {
+		return nil, nil
 	}
 
-	stateManager, err := state.NewStore(filepath.Join(homeDir, ".mcp"))
+	var args []string
+
+	for _, name := range sortedKeys(opts.Args) {
+		args = append(args, "--build-arg", name+"="+opts.Args[name])
+	}
+
+	if opts.Target != "" {
+		args = append(args, "--target", opts.Target)
+	}
+	if opts.Platform != "" {
+		args = append(args, "--platform", opts.Platform)
+	}
+
+	for _, secret := range opts.Secrets {
+		switch {
+		case secret.Env != "":
+			if _, exists := os.LookupEnv(secret.Env); !exists {
+				return nil, fmt.Errorf("build secret %s: environment variable %s is not set", secret.ID, secret.Env)
+			}
+			args = append(args, "--secret", fmt.Sprintf("id=%s,env=%s", secret.ID, secret.Env))
+		case secret.File != "":
+			if err := b.checkFileSecrets(); err != nil {
+				return nil, fmt.Errorf("build secret %s: %w", secret.ID, err)
+			}
+			file := paths.ExpandHome(secret.File)
+			if _, err := os.Stat(file); err != nil {
+				return nil, fmt.Errorf("build secret %s: %w", secret.ID, err)
+			}
+			args = append(args, "--secret", fmt.Sprintf("id=%s,src=%s", secret.ID, file))
+		}
+	}
+
+	return args, nil
+}
+
+// checkFileSecrets rejects file secrets of definitions the user didn't write.
+// Project and git source definitions come with other people's repositories and
+// could mount any of the user's files, such as SSH keys, into a build step.
+func (b *Builder) checkFileSecrets() error {
+	layer, err := b.Repository.Layer(b.Config.Name)
 	if err != nil {
-		return tag, fmt.Errorf("failed to initialize state manager: %w", err)
+		return err
+	}
+	if layer.Name != definitions.LayerUser && layer.Name != definitions.LayerEmbedded {
+		return fmt.Errorf("file secrets are only read for definitions in ~/.smp/definitions, not %s definitions", layer.Name)
 	}
+	return nil
+}
 
-	if err := stateManager.Save(b.State); err != nil {
-		return tag, fmt.Errorf("failed to save MCP state: %w", err)
+// templateName returns the builder template the MCP is built with, if any
+func (b *Builder) templateName() string {
+	switch kind, _ := b.Config.RegistryPackage(); kind {
+	case registry.NPM:
+		return "node-npx"
+	case registry.PyPI:
+		return "python-uv"
 	}
+	return b.Config.Builder
+}
 
-	fmt.Printf("Docker image '%s' built successfully\n", b.Config.Name)
-	return tag, nil
+// tag returns the tag of the image built for the MCP
+func (b *Builder) tag() string {
+	return tagPrefix + b.Config.Name + ":latest"
+}
+
+// sortedKeys returns the keys of a map in order, so the same options always
+// produce the same build
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
@@ -0,0 +1,66 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lvrach/smp/definitions"
+	"github.com/lvrach/smp/internal/config"
+)
+
+func TestFileSecrets(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	writeFile(t, filepath.Join(home, ".npmrc"), "//registry.npmjs.org/:_authToken=token\n")
+	writeFile(t, filepath.Join(home, ".smp", "definitions", "own.yaml"), "name: own\n")
+
+	project := t.TempDir()
+	writeFile(t, filepath.Join(project, "cloned.yaml"), "name: cloned\n")
+
+	repo := definitions.NewRepository()
+	repo.PrependDirectory(definitions.LayerProject, project)
+
+	build := &config.BuildOptions{
+		Secrets: []config.BuildSecret{{ID: "npmrc", File: "~/.npmrc"}},
+	}
+
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "own"},
+		{name: "cloned", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &Builder{Config: &config.MCPConfig{Name: tt.name, Build: build}, Repository: repo}
+			args, err := b.buildArgs()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want an error", args)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "id=npmrc,src=" + filepath.Join(home, ".npmrc")
+			if strings.Join(args, " ") != "--secret "+want {
+				t.Errorf("got %v, want --secret %s", args, want)
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
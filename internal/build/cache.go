@@ -0,0 +1,87 @@
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/lvrach/smp/internal/docker"
+)
+
+// CacheKeyLabel is the image label holding the cache key an image was built with
+const CacheKeyLabel = "dev.smp.cache-key"
+
+// CacheKey identifies the inputs of a build: the source repository, commit and
+// subdirectory or the package version, the Dockerfile override and the build options. Builds with the same key
+// produce the same image, so it can be reused instead of rebuilt.
+func (b *Builder) CacheKey(commit string) (string, error) {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "repository=%s\ncommit=%s\n", b.Config.Repository, commit)
+	fmt.Fprintf(hash, "subdir=%s\nsubmodules=%t\n", b.Config.Subdir, b.Config.Submodules)
+	if kind, pkg := b.Config.RegistryPackage(); kind != "" {
+		fmt.Fprintf(hash, "package=%s:%s@%s\n", kind, pkg, b.PackageVersion)
+	}
+
+	dockerfile, err := b.dockerfile()
+	if err != nil {
+		return "", err
+	}
+	if dockerfile != nil {
+		dockerfileHash := sha256.Sum256(dockerfile)
+		fmt.Fprintf(hash, "dockerfile=%s\n", hex.EncodeToString(dockerfileHash[:]))
+	}
+
+	// Secret values don't change the image, only which secrets are used does
+	if opts := b.Config.Build; opts != nil {
+		for _, name := range sortedKeys(opts.Args) {
+			fmt.Fprintf(hash, "arg=%s=%s\n", name, opts.Args[name])
+		}
+		fmt.Fprintf(hash, "target=%s\nplatform=%s\n", opts.Target, opts.Platform)
+		for _, secret := range opts.Secrets {
+			fmt.Fprintf(hash, "secret=%s\n", secret.ID)
+		}
+	}
+
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// CachedImage returns a previously built image for the commit or package version, tagged as the
+// MCP's image, or nil if there is none or the cache is disabled
+func (b *Builder) CachedImage(commit string) (*Image, error) {
+	if b.NoCache {
+		return nil, nil
+	}
+
+	key, err := b.CacheKey(commit)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := docker.FindImage(CacheKeyLabel, key)
+	if err != nil || id == "" {
+		return nil, err
+	}
+
+	tag := b.tag()
+	if err := docker.Tag(id, tag); err != nil {
+		return nil, err
+	}
+
+	builtAt, err := docker.ImageCreated(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if commit != "" {
+		fmt.Printf("Using cached image for MCP '%s' (commit %s)\n", b.Config.Name, commit)
+	} else {
+		fmt.Printf("Using cached image for MCP '%s' (version %s)\n", b.Config.Name, b.PackageVersion)
+	}
+	return &Image{
+		Tag:     tag,
+		Digest:  id,
+		Commit:  commit,
+		Version: b.PackageVersion,
+		BuiltAt: builtAt,
+	}, nil
+}
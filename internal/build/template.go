@@ -0,0 +1,83 @@
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/lvrach/smp/internal/registry"
+)
+
+var majorVersionSuffix = regexp.MustCompile(`^v[0-9]+$`)
+
+// templateData is what builder templates are rendered with
+type templateData struct {
+	// Package to install: an npm or PyPI package, a Go module path or a Deno specifier
+	Package string
+
+	// Version of the package, empty for the latest
+	Version string
+
+	// Command the container runs, empty for the builder's default
+	Entrypoint []string
+
+	// Registry to install the package from, empty for the package manager's default
+	Registry string
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"command": goCommand,
+}
+
+// renderTemplate renders a builder template into a Dockerfile for the MCP
+func (b *Builder) renderTemplate(tmpl []byte) ([]byte, error) {
+	name := b.templateName()
+	t, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(string(tmpl))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse builder template %s: %w", name, err)
+	}
+
+	data := templateData{
+		Package:    b.Config.Package,
+		Version:    b.Config.Version,
+		Entrypoint: strings.Fields(b.Config.Entrypoint),
+	}
+
+	// Registry packages are built at their resolved version, so the image is locked to it
+	if kind, pkg := b.Config.RegistryPackage(); kind != "" {
+		reg, err := registry.New(kind)
+		if err != nil {
+			return nil, err
+		}
+		if !registry.ValidVersion(b.PackageVersion) {
+			return nil, fmt.Errorf("invalid version %q of %s package %s", b.PackageVersion, kind, pkg)
+		}
+		data.Package = pkg
+		data.Version = b.PackageVersion
+		data.Registry = reg.InstallURL()
+	}
+
+	var out bytes.Buffer
+	if err := t.Execute(&out, data); err != nil {
+		return nil, fmt.Errorf("failed to render builder template %s: %w", name, err)
+	}
+	return out.Bytes(), nil
+}
+
+// goCommand returns the name of the command go install builds for a package path,
+// e.g. github.com/org/mcp/cmd/server/v2 builds server
+func goCommand(pkg string) string {
+	name := path.Base(pkg)
+	if majorVersionSuffix.MatchString(name) {
+		name = path.Base(path.Dir(pkg))
+	}
+	return name
+}
@@ -0,0 +1,60 @@
+package build
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lvrach/smp/definitions"
+	"github.com/lvrach/smp/internal/config"
+)
+
+func TestRenderDenoTemplate(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	tests := []struct {
+		name    string
+		config  config.MCPConfig
+		want    []string
+		notWant []string
+	}{
+		{
+			name:   "versioned",
+			config: config.MCPConfig{Name: "deno", Builder: "deno", Package: "jsr:@org/mcp", Version: "1.2.0"},
+			want: []string{
+				`RUN ["deno", "cache", "jsr:@org/mcp@1.2.0"]`,
+				`ENTRYPOINT ["deno", "run", "--allow-all", "jsr:@org/mcp@1.2.0"]`,
+			},
+		},
+		{
+			name:   "latest",
+			config: config.MCPConfig{Name: "deno", Builder: "deno", Package: "jsr:@org/mcp"},
+			want:   []string{`ENTRYPOINT ["deno", "run", "--allow-all", "jsr:@org/mcp"]`},
+		},
+		{
+			name:    "quotes",
+			config:  config.MCPConfig{Name: "deno", Builder: "deno", Package: `npm:mcp", "--allow-run`},
+			want:    []string{`ENTRYPOINT ["deno", "run", "--allow-all", "npm:mcp\", \"--allow-run"]`},
+			notWant: []string{`"npm:mcp", "--allow-run"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &Builder{Config: &tt.config, Repository: definitions.NewRepository()}
+			dockerfile, err := b.dockerfile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(dockerfile), want) {
+					t.Errorf("Dockerfile lacks %s:\n%s", want, dockerfile)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(string(dockerfile), notWant) {
+					t.Errorf("Dockerfile contains %s:\n%s", notWant, dockerfile)
+				}
+			}
+		})
+	}
+}
@@ -1,18 +1,269 @@
 package config
 
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Environment variable types supported in MCP definitions
+const (
+	TypeString  = "string"
+	TypeSecret  = "secret"
+	TypeBoolean = "boolean"
+	TypeInteger = "integer"
+	TypeURL     = "url"
+	TypeEnum    = "enum"
+	TypePath    = "path"
+)
+
+// Strategies for obtaining the image of an MCP
+const (
+	StrategyImage      = "image"
+	StrategyRepository = "repository"
+	StrategyLocal      = "local"
+	StrategyBuilder    = "builder"
+	StrategyRegistry   = "registry"
+)
+
 // MCPConfig represents the configuration for a Multi-Container Platform
 type MCPConfig struct {
 	Name            string                `yaml:"name"`
+	Description     string                `yaml:"description,omitempty"`
+	Homepage        string                `yaml:"homepage,omitempty"`
+	Tags            []string              `yaml:"tags,omitempty"`
+	Maintainer      string                `yaml:"maintainer,omitempty"`
 	Repository      string                `yaml:"repository,omitempty"`
 	Image           string                `yaml:"image,omitempty"`
 	Branch          string                `yaml:"branch,omitempty"`
+	Ref             string                `yaml:"ref,omitempty"`
+	Commit          string                `yaml:"commit,omitempty"`
+	Subdir          string                `yaml:"subdir,omitempty"`
+	Submodules      bool                  `yaml:"submodules,omitempty"`
 	Dockerfile      string                `yaml:"dockerfile,omitempty"`
+	Source          *Source               `yaml:"source,omitempty"`
+	Builder         string                `yaml:"builder,omitempty"`
+	NPM             string                `yaml:"npm,omitempty"`
+	PyPI            string                `yaml:"pypi,omitempty"`
+	Package         string                `yaml:"package,omitempty"`
+	Version         string                `yaml:"version,omitempty"`
+	Entrypoint      string                `yaml:"entrypoint,omitempty"`
+	Build           *BuildOptions         `yaml:"build,omitempty"`
+	Verify          *VerifyPolicy         `yaml:"verify,omitempty"`
+	Groups          []VariableGroup       `yaml:"groups,omitempty"`
 	EnvironmentVars []EnvironmentVariable `yaml:"environment,omitempty"`
 }
 
+// Source is a local directory or archive the image of an MCP is built from,
+// for developing an MCP or testing a fork without pushing it
+type Source struct {
+	// Directory to build, relative to the definition's directory
+	Path string `yaml:"path,omitempty"`
+
+	// Tarball to build (.tar, .tar.gz or .tgz), relative to the definition's directory
+	Archive string `yaml:"archive,omitempty"`
+}
+
+// BuildOptions customise the docker build of an MCP's image
+type BuildOptions struct {
+	// Build arguments passed with --build-arg
+	Args map[string]string `yaml:"args,omitempty"`
+
+	// Stage of a multi-stage Dockerfile to build
+	Target string `yaml:"target,omitempty"`
+
+	// Platform to build for, e.g. linux/amd64
+	Platform string `yaml:"platform,omitempty"`
+
+	// BuildKit secrets, e.g. a token for a private package registry
+	Secrets []BuildSecret `yaml:"secrets,omitempty"`
+}
+
+// BuildSecret is a BuildKit secret that RUN instructions mount with
+// --mount=type=secret,id=<id>. Its value never ends up in the image.
+type BuildSecret struct {
+	ID string `yaml:"id"`
+
+	// Environment variable of the caller holding the secret
+	Env string `yaml:"env,omitempty"`
+
+	// File holding the secret
+	File string `yaml:"file,omitempty"`
+}
+
+// Verification modes of a VerifyPolicy
+const (
+	VerifyEnforce = "enforce"
+	VerifyWarn    = "warn"
+)
+
+// VerifyPolicy describes how the signature of an MCP's image is checked with
+// cosign, either against a public key or a keyless signing identity
+type VerifyPolicy struct {
+	// Public key file, relative to the definition's directory, or a PEM encoded key
+	Key string `yaml:"key,omitempty" json:"key,omitempty"`
+
+	// Certificate identity of keyless signatures, e.g. the workflow that signed the image
+	Identity string `yaml:"identity,omitempty" json:"identity,omitempty"`
+
+	// Regular expression matching the certificate identity, instead of identity
+	IdentityRegexp string `yaml:"identity_regexp,omitempty" json:"identity_regexp,omitempty"`
+
+	// OIDC issuer of keyless signatures, e.g. https://token.actions.githubusercontent.com
+	Issuer string `yaml:"issuer,omitempty" json:"issuer,omitempty"`
+
+	// Predicate type of an attestation that must also be signed, e.g. slsaprovenance
+	Attestation string `yaml:"attestation,omitempty" json:"attestation,omitempty"`
+
+	// Whether unverified images are refused (enforce, the default) or only reported (warn)
+	Mode string `yaml:"mode,omitempty" json:"mode,omitempty"`
+}
+
+// Enforced reports whether images that fail verification must not run
+func (p *VerifyPolicy) Enforced() bool {
+	return p.Mode != VerifyWarn
+}
+
 type EnvironmentVariable struct {
-	Name        string `yaml:"name"`
-	Type        string `yaml:"type"`
-	Description string `yaml:"description"`
-	Required    bool   `yaml:"required"`
+	Name        string   `yaml:"name"`
+	Type        string   `yaml:"type"`
+	Description string   `yaml:"description"`
+	Required    bool     `yaml:"required"`
+	Default     string   `yaml:"default,omitempty"`
+	Pattern     string   `yaml:"pattern,omitempty"`
+	Enum        []string `yaml:"enum,omitempty"`
+	Example     string   `yaml:"example,omitempty"`
+	When        string   `yaml:"when,omitempty"`
+}
+
+// Strategy returns how the image of the MCP is obtained: built from a local
+// source, a registry package, a builder template or its repository, or pulled
+// as a prebuilt image
+func (c *MCPConfig) Strategy() string {
+	if c.Source != nil {
+		return StrategyLocal
+	}
+	if c.NPM != "" || c.PyPI != "" {
+		return StrategyRegistry
+	}
+	if c.Builder != "" {
+		return StrategyBuilder
+	}
+	if c.Repository != "" {
+		return StrategyRepository
+	}
+	if c.Image != "" {
+		return StrategyImage
+	}
+	return ""
+}
+
+// GitRef returns the branch or tag of the MCP's repository to build, empty for
+// the remote's default branch
+func (c *MCPConfig) GitRef() string {
+	if c.Ref != "" {
+		return c.Ref
+	}
+	return c.Branch
+}
+
+// RegistryPackage returns the registry, npm or pypi, and name of the package the
+// MCP is installed from, empty if it isn't installed from a package registry
+func (c *MCPConfig) RegistryPackage() (string, string) {
+	switch {
+	case c.NPM != "":
+		return "npm", c.NPM
+	case c.PyPI != "":
+		return "pypi", c.PyPI
+	}
+	return "", ""
+}
+
+// IsSecret reports whether the variable holds a secret value
+func (v EnvironmentVariable) IsSecret() bool {
+	return v.Type == TypeSecret
+}
+
+// Validate checks a value against the variable's type, pattern and enum values
+func (v EnvironmentVariable) Validate(value string) error {
+	switch v.Type {
+	case "", TypeString, TypeSecret:
+	case TypeBoolean:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%s must be a boolean (true or false), got %q", v.Name, value)
+		}
+	case TypeInteger:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("%s must be an integer, got %q", v.Name, value)
+		}
+	case TypeURL:
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("%s must be an absolute URL (e.g. https://example.com), got %q", v.Name, value)
+		}
+	case TypeEnum:
+		if !contains(v.Enum, value) {
+			return fmt.Errorf("%s must be one of [%s], got %q", v.Name, strings.Join(v.Enum, ", "), value)
+		}
+	case TypePath:
+		if strings.ContainsRune(value, 0) {
+			return fmt.Errorf("%s must be a valid path", v.Name)
+		}
+	default:
+		return fmt.Errorf("%s has unknown type %q", v.Name, v.Type)
+	}
+
+	if v.Pattern != "" {
+		re, err := regexp.Compile(v.Pattern)
+		if err != nil {
+			return fmt.Errorf("%s has invalid pattern %q: %w", v.Name, v.Pattern, err)
+		}
+		if !re.MatchString(value) {
+			if v.IsSecret() {
+				return fmt.Errorf("%s does not match pattern %q", v.Name, v.Pattern)
+			}
+			return fmt.Errorf("%s does not match pattern %q, got %q", v.Name, v.Pattern, value)
+		}
+	}
+
+	return nil
+}
+
+// ValidateEnvironment checks the selected features against the definition's groups,
+// that all required active variables are set and that every set active variable holds
+// a valid value. lookup returns the configured value of a variable.
+func (c *MCPConfig) ValidateEnvironment(features []string, lookup func(name string) (string, bool)) error {
+	if err := c.ValidateFeatures(features); err != nil {
+		return err
+	}
+
+	var errs []string
+	for _, envVar := range c.ActiveVariables(features, lookup) {
+		value, exists := lookup(envVar.Name)
+		if !exists || value == "" {
+			if envVar.Required && envVar.Default == "" {
+				errs = append(errs, fmt.Sprintf("%s is required but not set", envVar.Name))
+			}
+			continue
+		}
+		if err := envVar.Validate(value); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid environment for MCP '%s': %s", c.Name, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,156 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lvrach/smp/internal/config"
+)
+
+func TestStrategy(t *testing.T) {
+	tests := []struct {
+		name   string
+		config config.MCPConfig
+		want   string
+	}{
+		{
+			name:   "repository",
+			config: config.MCPConfig{Repository: "https://github.com/org/mcp.git"},
+			want:   config.StrategyRepository,
+		},
+		{
+			name:   "repository with Dockerfile",
+			config: config.MCPConfig{Repository: "https://github.com/org/mcp.git", Dockerfile: "bun-builder/Dockerfile"},
+			want:   config.StrategyRepository,
+		},
+		{
+			name:   "image",
+			config: config.MCPConfig{Image: "ghcr.io/org/mcp:1.0"},
+			want:   config.StrategyImage,
+		},
+		{
+			name:   "local source",
+			config: config.MCPConfig{Source: &config.Source{Path: "./mcp"}},
+			want:   config.StrategyLocal,
+		},
+		{
+			name:   "package",
+			config: config.MCPConfig{NPM: "@org/mcp"},
+			want:   config.StrategyRegistry,
+		},
+		{
+			name:   "builder template",
+			config: config.MCPConfig{Builder: "go-module"},
+			want:   config.StrategyBuilder,
+		},
+		{
+			name: "nothing to build",
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.Strategy(); got != tt.want {
+				t.Errorf("Strategy() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		envVar  config.EnvironmentVariable
+		value   string
+		wantErr bool
+	}{
+		{name: "string", envVar: config.EnvironmentVariable{Type: config.TypeString}, value: "anything"},
+		{name: "untyped", envVar: config.EnvironmentVariable{}, value: "anything"},
+		{name: "secret", envVar: config.EnvironmentVariable{Type: config.TypeSecret}, value: "s3cr3t"},
+		{name: "boolean", envVar: config.EnvironmentVariable{Type: config.TypeBoolean}, value: "true"},
+		{name: "boolean number", envVar: config.EnvironmentVariable{Type: config.TypeBoolean}, value: "0"},
+		{name: "invalid boolean", envVar: config.EnvironmentVariable{Type: config.TypeBoolean}, value: "yes", wantErr: true},
+		{name: "integer", envVar: config.EnvironmentVariable{Type: config.TypeInteger}, value: "-42"},
+		{name: "invalid integer", envVar: config.EnvironmentVariable{Type: config.TypeInteger}, value: "4.2", wantErr: true},
+		{name: "url", envVar: config.EnvironmentVariable{Type: config.TypeURL}, value: "https://example.atlassian.net"},
+		{name: "relative url", envVar: config.EnvironmentVariable{Type: config.TypeURL}, value: "example.atlassian.net", wantErr: true},
+		{name: "url without host", envVar: config.EnvironmentVariable{Type: config.TypeURL}, value: "https://", wantErr: true},
+		{name: "enum", envVar: config.EnvironmentVariable{Type: config.TypeEnum, Enum: []string{"cloud", "server"}}, value: "server"},
+		{name: "invalid enum", envVar: config.EnvironmentVariable{Type: config.TypeEnum, Enum: []string{"cloud", "server"}}, value: "Cloud", wantErr: true},
+		{name: "path", envVar: config.EnvironmentVariable{Type: config.TypePath}, value: "~/notes"},
+		{name: "path with NUL", envVar: config.EnvironmentVariable{Type: config.TypePath}, value: "notes\x00", wantErr: true},
+		{name: "unknown type", envVar: config.EnvironmentVariable{Type: "float"}, value: "1.5", wantErr: true},
+		{name: "pattern", envVar: config.EnvironmentVariable{Pattern: `^[A-Z]+-[0-9]+$`}, value: "ABC-1"},
+		{name: "pattern mismatch", envVar: config.EnvironmentVariable{Pattern: `^[A-Z]+-[0-9]+$`}, value: "abc-1", wantErr: true},
+		{name: "pattern and type", envVar: config.EnvironmentVariable{Type: config.TypeInteger, Pattern: `^[0-9]{4}$`}, value: "80", wantErr: true},
+		{name: "invalid pattern", envVar: config.EnvironmentVariable{Pattern: `[`}, value: "x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.envVar.Name = "VAR"
+			err := tt.envVar.Validate(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate(%q) = %v, want error: %v", tt.value, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSecretMismatchHidesValue(t *testing.T) {
+	envVar := config.EnvironmentVariable{Name: "TOKEN", Type: config.TypeSecret, Pattern: `^ghp_`}
+	err := envVar.Validate("s3cr3t-value")
+	if err == nil || strings.Contains(err.Error(), "s3cr3t-value") {
+		t.Errorf("Validate() = %v, want an error without the value", err)
+	}
+}
+
+func TestValidateEnvironment(t *testing.T) {
+	mcpConfig := &config.MCPConfig{
+		Name: "jira",
+		EnvironmentVars: []config.EnvironmentVariable{
+			{Name: "JIRA_URL", Type: config.TypeURL, Required: true},
+			{Name: "JIRA_TIMEOUT", Type: config.TypeInteger, Default: "30", Required: true},
+			{Name: "JIRA_MODE", Type: config.TypeEnum, Enum: []string{"cloud", "server"}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		values  map[string]string
+		wantErr []string
+	}{
+		{name: "valid", values: map[string]string{"JIRA_URL": "https://jira.example.com", "JIRA_MODE": "cloud"}},
+		{name: "missing required", values: map[string]string{}, wantErr: []string{"JIRA_URL is required"}},
+		{name: "empty required", values: map[string]string{"JIRA_URL": ""}, wantErr: []string{"JIRA_URL is required"}},
+		{
+			name:    "invalid values",
+			values:  map[string]string{"JIRA_URL": "jira", "JIRA_TIMEOUT": "soon", "JIRA_MODE": "hybrid"},
+			wantErr: []string{"JIRA_URL must be an absolute URL", "JIRA_TIMEOUT must be an integer", "JIRA_MODE must be one of"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := mcpConfig.ValidateEnvironment(nil, func(name string) (string, bool) {
+				value, ok := tt.values[name]
+				return value, ok
+			})
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("ValidateEnvironment() = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("ValidateEnvironment() succeeded, want %v", tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q lacks %q", err, want)
+				}
+			}
+		})
+	}
+}
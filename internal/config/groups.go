@@ -0,0 +1,155 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// VariableGroup groups optional features of an MCP, such as the Atlassian products
+// it talks to. Exactly one feature of a one_of group and at least one feature of an
+// any_of group must be enabled. Variables opt into a feature with a when: condition.
+type VariableGroup struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	OneOf       []string `yaml:"one_of,omitempty"`
+	AnyOf       []string `yaml:"any_of,omitempty"`
+}
+
+// Features returns the features that can be selected in this group
+func (g VariableGroup) Features() []string {
+	if len(g.OneOf) > 0 {
+		return g.OneOf
+	}
+	return g.AnyOf
+}
+
+// Features returns all features declared by the definition's groups
+func (c *MCPConfig) Features() []string {
+	var features []string
+	for _, group := range c.Groups {
+		features = append(features, group.Features()...)
+	}
+	return features
+}
+
+// EnabledFeatures returns the features enabled for an install. Installs made
+// before the definition had groups have none recorded: they get the features
+// whose variables are configured, or if none are, every feature of any_of groups
+// and the first of one_of groups.
+func (c *MCPConfig) EnabledFeatures(features []string, lookup func(name string) (string, bool)) []string {
+	if len(features) > 0 {
+		return features
+	}
+
+	var enabled []string
+	for _, group := range c.Groups {
+		var configured []string
+		for _, feature := range group.Features() {
+			if c.configures(feature, lookup) {
+				configured = append(configured, feature)
+			}
+		}
+
+		switch {
+		case len(group.OneOf) > 0 && len(configured) > 0:
+			enabled = append(enabled, configured[0])
+		case len(group.OneOf) > 0:
+			enabled = append(enabled, group.OneOf[0])
+		case len(configured) > 0:
+			enabled = append(enabled, configured...)
+		default:
+			enabled = append(enabled, group.AnyOf...)
+		}
+	}
+	return enabled
+}
+
+// configures reports whether a variable that a feature enables is set
+func (c *MCPConfig) configures(feature string, lookup func(name string) (string, bool)) bool {
+	for _, envVar := range c.EnvironmentVars {
+		if strings.TrimSpace(envVar.When) != feature {
+			continue
+		}
+		if value, exists := lookup(envVar.Name); exists && value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateFeatures checks the enabled features against the one_of and any_of groups
+func (c *MCPConfig) ValidateFeatures(features []string) error {
+	for _, feature := range features {
+		if !contains(c.Features(), feature) {
+			return fmt.Errorf("MCP '%s' has no feature %q", c.Name, feature)
+		}
+	}
+
+	for _, group := range c.Groups {
+		var enabled []string
+		for _, feature := range group.Features() {
+			if contains(features, feature) {
+				enabled = append(enabled, feature)
+			}
+		}
+
+		switch {
+		case len(group.OneOf) > 0 && len(enabled) != 1:
+			return fmt.Errorf("MCP '%s' requires exactly one of [%s] for %s, got %d",
+				c.Name, strings.Join(group.OneOf, ", "), group.Name, len(enabled))
+		case len(group.AnyOf) > 0 && len(enabled) == 0:
+			return fmt.Errorf("MCP '%s' requires at least one of [%s] for %s",
+				c.Name, strings.Join(group.AnyOf, ", "), group.Name)
+		}
+	}
+
+	return nil
+}
+
+// ActiveVariables returns the variables whose when: condition holds for the
+// enabled features and the currently configured values
+func (c *MCPConfig) ActiveVariables(features []string, lookup func(name string) (string, bool)) []EnvironmentVariable {
+	// Conditions compare against the effective value, so fall back to defaults
+	withDefaults := func(name string) (string, bool) {
+		if value, exists := lookup(name); exists {
+			return value, true
+		}
+		for _, envVar := range c.EnvironmentVars {
+			if envVar.Name == name && envVar.Default != "" {
+				return envVar.Default, true
+			}
+		}
+		return "", false
+	}
+
+	var active []EnvironmentVariable
+	for _, envVar := range c.EnvironmentVars {
+		if envVar.Active(features, withDefaults) {
+			active = append(active, envVar)
+		}
+	}
+	return active
+}
+
+// Active evaluates the variable's when: condition. Supported conditions are a
+// feature name ("jira"), a negated feature name ("!jira"), and comparisons against
+// another variable ("JIRA_SSL_VERIFY=false", "JIRA_SSL_VERIFY!=true").
+func (v EnvironmentVariable) Active(features []string, lookup func(name string) (string, bool)) bool {
+	condition := strings.TrimSpace(v.When)
+	if condition == "" {
+		return true
+	}
+
+	if name, value, ok := strings.Cut(condition, "!="); ok {
+		current, _ := lookup(strings.TrimSpace(name))
+		return current != strings.TrimSpace(value)
+	}
+	if name, value, ok := strings.Cut(condition, "="); ok {
+		current, _ := lookup(strings.TrimSpace(name))
+		return current == strings.TrimSpace(value)
+	}
+	if feature, ok := strings.CutPrefix(condition, "!"); ok {
+		return !contains(features, strings.TrimSpace(feature))
+	}
+	return contains(features, condition)
+}
@@ -0,0 +1,68 @@
+package config_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lvrach/smp/internal/config"
+)
+
+func TestEnabledFeatures(t *testing.T) {
+	mcpConfig := &config.MCPConfig{
+		Name: "atlassian",
+		Groups: []config.VariableGroup{
+			{Name: "products", AnyOf: []string{"confluence", "jira"}},
+			{Name: "auth", OneOf: []string{"token", "oauth"}},
+		},
+		EnvironmentVars: []config.EnvironmentVariable{
+			{Name: "CONFLUENCE_URL", When: "confluence"},
+			{Name: "JIRA_URL", When: "jira"},
+			{Name: "API_TOKEN", When: "token"},
+			{Name: "OAUTH_CLIENT_ID", When: "oauth"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		features  []string
+		variables map[string]string
+		want      []string
+	}{
+		{
+			name:      "recorded",
+			features:  []string{"jira", "oauth"},
+			variables: map[string]string{"CONFLUENCE_URL": "https://wiki.example.com"},
+			want:      []string{"jira", "oauth"},
+		},
+		{
+			name:      "configured",
+			variables: map[string]string{"JIRA_URL": "https://jira.example.com", "OAUTH_CLIENT_ID": "id"},
+			want:      []string{"jira", "oauth"},
+		},
+		{
+			name:      "empty values",
+			variables: map[string]string{"JIRA_URL": ""},
+			want:      []string{"confluence", "jira", "token"},
+		},
+		{
+			name: "nothing configured",
+			want: []string{"confluence", "jira", "token"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookup := func(name string) (string, bool) {
+				value, exists := tt.variables[name]
+				return value, exists
+			}
+			got := mcpConfig.EnabledFeatures(tt.features, lookup)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EnabledFeatures() = %q, want %q", got, tt.want)
+			}
+			if err := mcpConfig.ValidateFeatures(got); err != nil {
+				t.Errorf("enabled features are invalid: %v", err)
+			}
+		})
+	}
+}
@@ -2,19 +2,33 @@ package docker
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"strings"
+	"time"
 
 	"github.com/lvrach/smp/internal/config"
+	"github.com/lvrach/smp/internal/proxy"
 	"github.com/lvrach/smp/internal/state"
 )
 
 const tagPrefix = "mcp-"
 
+// SandboxProfile describes the isolation MCP containers run with
+const SandboxProfile = "docker container, default bridge network, no host mounts, removed on exit"
+
 // Runner handles Docker build operations
 type Runner struct {
 	Config *config.MCPConfig
 	State  *state.MCPServer
+
+	// Interceptors see and change the messages between host and MCP. Without
+	// any, the container's stdio is connected to the host directly.
+	Interceptors []proxy.Interceptor
+
+	// Stderr receives the container's stderr and the proxy's log, os.Stderr by default
+	Stderr io.Writer
 }
 
 // NewRunner creates a new Docker runner
@@ -22,6 +36,7 @@ func NewRunner(mcpConfig *config.MCPConfig, mcpState *state.MCPServer) *Runner {
 	return &Runner{
 		Config: mcpConfig,
 		State:  mcpState,
+		Stderr: os.Stderr,
 	}
 }
 
@@ -30,23 +45,146 @@ func (b *Runner) Run() error {
 	// Prepare run args
 	args := []string{"run", "--rm", "-i"}
 
-	// Add environment variables from state
-	for _, envVar := range b.Config.EnvironmentVars {
+	// Add environment variables from state, falling back to definition defaults
+	for _, envVar := range b.Config.ActiveVariables(b.State.Features, b.State.GetEnvironmentVariable) {
 		if value, exists := b.State.GetEnvironmentVariable(envVar.Name); exists {
 			args = append(args, "-e", fmt.Sprintf("%s=%s", envVar.Name, value))
+		} else if envVar.Default != "" {
+			args = append(args, "-e", fmt.Sprintf("%s=%s", envVar.Name, envVar.Default))
 		}
 	}
 
-	// Add image name
-	args = append(args, b.State.LocalImageTag)
+	// Add image reference, pinned to the recorded digest when known
+	args = append(args, ImageReference(b.State))
 
 	// Execute docker run command
 	cmd := exec.Command("docker", args...)
-	cmd.Stdout = os.Stdout
+	cmd.Stderr = b.Stderr
+	if len(b.Interceptors) == 0 {
+		cmd.Stdout = os.Stdout
+		cmd.Stdin = os.Stdin
+		return cmd.Run()
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// The proxy returns when the container closes its stdout, on exit
+	p := proxy.New(b.Stderr, b.Interceptors...)
+	if err := p.Run(os.Stdin, os.Stdout, stdin, stdout); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+
+	return cmd.Wait()
+}
+
+// ImageReference returns the reference to run an MCP's image by. Images built by
+// smp are run by image ID and pulled images by repository digest, so the recorded
+// image is run even if the tag moved since install.
+func ImageReference(mcpState *state.MCPServer) string {
+	switch {
+	case mcpState.ImageDigest == "":
+		return mcpState.LocalImageTag
+	case !mcpState.BuiltAt.IsZero():
+		return mcpState.ImageDigest
+	default:
+		return Repository(mcpState.LocalImageTag) + "@" + mcpState.ImageDigest
+	}
+}
+
+// Repository strips the tag and digest from an image reference,
+// e.g. ghcr.io/org/image:latest becomes ghcr.io/org/image
+func Repository(imageName string) string {
+	if i := strings.Index(imageName, "@"); i >= 0 {
+		imageName = imageName[:i]
+	}
+	if i := strings.LastIndex(imageName, ":"); i > strings.LastIndex(imageName, "/") {
+		imageName = imageName[:i]
+	}
+	return imageName
+}
+
+// Digest returns the digest pinned in an image reference, empty if it has none
+func Digest(imageName string) string {
+	if i := strings.Index(imageName, "@"); i >= 0 {
+		return imageName[i+1:]
+	}
+	return ""
+}
+
+// Pull pulls an image from its registry
+func Pull(imageName string) error {
+	// Progress goes to stderr so it never mixes with MCP stdio
+	cmd := exec.Command("docker", "pull", imageName)
+	cmd.Stdout = os.Stderr
 	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
 
-	return cmd.Run()
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running docker pull: %w", err)
+	}
+
+	return nil
+}
+
+// RepoDigest returns the registry digest of a pulled image
+func RepoDigest(imageName string) (string, error) {
+	out, err := exec.Command("docker", "image", "inspect", "--format", "{{range .RepoDigests}}{{println .}}{{end}}", imageName).Output()
+	if err != nil {
+		return "", fmt.Errorf("running docker image inspect: %w", err)
+	}
+
+	return matchRepoDigest(imageName, strings.Fields(string(out)))
+}
+
+// matchRepoDigest picks the digest of an image's repository among the repository
+// digests of a local image. An image pulled from several repositories has a
+// digest for each, only the one of its own repository identifies it.
+// Repositories are compared normalized, as Docker Hub images are listed without
+// their registry.
+func matchRepoDigest(imageName string, repoDigests []string) (string, error) {
+	registry, repository, _ := parseReference(imageName)
+	for _, repoDigest := range repoDigests {
+		if r, repo, _ := parseReference(repoDigest); r == registry && repo == repository {
+			return Digest(repoDigest), nil
+		}
+	}
+
+	return "", fmt.Errorf("no registry digest found for image %q in repository %s/%s", imageName, registry, repository)
+}
+
+// Tag adds a tag to a local image
+func Tag(imageName, tag string) error {
+	if out, err := exec.Command("docker", "tag", imageName, tag).CombinedOutput(); err != nil {
+		return fmt.Errorf("running docker tag: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// PreviousTag returns the tag that keeps the image an MCP was upgraded from
+func PreviousTag(mcpName string) string {
+	return tagPrefix + mcpName + ":previous"
+}
+
+// ImageID returns the content-addressed ID of a local image
+func ImageID(imageName string) (string, error) {
+	out, err := exec.Command("docker", "image", "inspect", "--format", "{{.Id}}", imageName).Output()
+	if err != nil {
+		return "", fmt.Errorf("running docker image inspect: %w", err)
+	}
+
+	return strings.TrimSpace(string(out)), nil
 }
 
 // DeleteImage removes the Docker image for this MCP
@@ -62,3 +200,66 @@ func DeleteImage(imageName string) error {
 
 	return nil
 }
+
+// FindImage returns the ID of a local image carrying the given label value,
+// empty if there is none
+func FindImage(label, value string) (string, error) {
+	out, err := exec.Command("docker", "image", "ls", "--quiet", "--no-trunc", "--filter", "label="+label+"="+value).Output()
+	if err != nil {
+		return "", fmt.Errorf("running docker image ls: %w", err)
+	}
+
+	ids := strings.Fields(string(out))
+	if len(ids) == 0 {
+		return "", nil
+	}
+	return ids[0], nil
+}
+
+// ImageCreated returns the time a local image was built
+func ImageCreated(imageName string) (time.Time, error) {
+	out, err := exec.Command("docker", "image", "inspect", "--format", "{{.Created}}", imageName).Output()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("running docker image inspect: %w", err)
+	}
+
+	created, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(out)))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parsing image creation time: %w", err)
+	}
+	return created.UTC(), nil
+}
+
+// ExportFilesystem streams the filesystem of an image as a tar archive to fn,
+// through a container that is created but never started
+func ExportFilesystem(imageName string, fn func(r io.Reader) error) error {
+	out, err := exec.Command("docker", "create", "--entrypoint", "true", imageName).Output()
+	if err != nil {
+		return fmt.Errorf("running docker create: %w", err)
+	}
+	container := strings.TrimSpace(string(out))
+	defer exec.Command("docker", "rm", "--force", container).Run()
+
+	cmd := exec.Command("docker", "export", container)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("running docker export: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("running docker export: %w", err)
+	}
+
+	if err := fn(stdout); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	// Drain what fn did not read so docker export can exit
+	io.Copy(io.Discard, stdout)
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("running docker export: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// manifestTypes are the manifest media types a registry may answer with,
+// multi-platform indexes first, as docker pull records their digest
+var manifestTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// challengeParam matches the parameters of a WWW-Authenticate challenge
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+var registryClient = &http.Client{Timeout: 30 * time.Second}
+
+// RemoteDigest returns the digest an image reference points to in its registry
+// without pulling the image, by asking for the manifest's headers. Registries
+// that require a token get an anonymous one, as public images on Docker Hub and
+// GHCR allow.
+func RemoteDigest(imageName string) (string, error) {
+	if digest := Digest(imageName); digest != "" {
+		return digest, nil
+	}
+
+	registry, repository, tag := parseReference(imageName)
+	scheme := "https"
+	if host, _, _ := strings.Cut(registry, ":"); host == "localhost" || host == "127.0.0.1" {
+		scheme = "http"
+	}
+	manifestURL := fmt.Sprintf("%s://%s/v2/%s/manifests/%s", scheme, registry, repository, tag)
+
+	resp, err := headManifest(manifestURL, "")
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		token, err := anonymousToken(resp.Header.Get("WWW-Authenticate"), repository)
+		if err != nil {
+			return "", err
+		}
+		if resp, err = headManifest(manifestURL, token); err != nil {
+			return "", err
+		}
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", fmt.Errorf("image %s not found in its registry", imageName)
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("registry returned %s for %s", resp.Status, imageName)
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("registry returned no digest for %s", imageName)
+	}
+	return digest, nil
+}
+
+func headManifest(manifestURL, token string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodHead, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestTypes, ", "))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := registryClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach registry: %w", err)
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// anonymousToken requests a pull token for a repository from the realm of a
+// Bearer challenge
+func anonymousToken(challenge, repository string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", fmt.Errorf("registry requires %s authentication, pull the image to check it", scheme)
+	}
+
+	values := make(map[string]string)
+	for _, m := range challengeParam.FindAllStringSubmatch(params, -1) {
+		values[m[1]] = m[2]
+	}
+	if values["realm"] == "" {
+		return "", fmt.Errorf("registry sent no token realm")
+	}
+
+	query := url.Values{}
+	if values["service"] != "" {
+		query.Set("service", values["service"])
+	}
+	scope := values["scope"]
+	if scope == "" {
+		scope = "repository:" + repository + ":pull"
+	}
+	query.Set("scope", scope)
+
+	resp, err := registryClient.Get(values["realm"] + "?" + query.Encode())
+	if err != nil {
+		return "", fmt.Errorf("failed to get registry token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry token service returned %s", resp.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to parse registry token: %w", err)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
+
+// parseReference splits an image reference into its registry, repository and
+// tag, with Docker Hub's defaults filled in
+func parseReference(imageName string) (string, string, string) {
+	repository := Repository(imageName)
+	tag := "latest"
+	if rest := strings.TrimPrefix(imageName, repository); strings.HasPrefix(rest, ":") {
+		tag = rest[1:]
+	}
+
+	registry := "docker.io"
+	if first, rest, ok := strings.Cut(repository, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		registry, repository = first, rest
+	}
+	if registry == "docker.io" || registry == "index.docker.io" {
+		registry = "registry-1.docker.io"
+		if !strings.Contains(repository, "/") {
+			repository = "library/" + repository
+		}
+	}
+	return registry, repository, tag
+}
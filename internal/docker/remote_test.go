@@ -0,0 +1,101 @@
+package docker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		image                     string
+		registry, repository, tag string
+	}{
+		{"alpine", "registry-1.docker.io", "library/alpine", "latest"},
+		{"alpine:3.19", "registry-1.docker.io", "library/alpine", "3.19"},
+		{"sooperset/mcp-atlassian:latest", "registry-1.docker.io", "sooperset/mcp-atlassian", "latest"},
+		{"docker.io/library/alpine:3.19", "registry-1.docker.io", "library/alpine", "3.19"},
+		{"ghcr.io/org/mcp/server:v1", "ghcr.io", "org/mcp/server", "v1"},
+		{"localhost:5000/mcp", "localhost:5000", "mcp", "latest"},
+	}
+
+	for _, tt := range tests {
+		registry, repository, tag := parseReference(tt.image)
+		if registry != tt.registry || repository != tt.repository || tag != tt.tag {
+			t.Errorf("parseReference(%q) = %q, %q, %q, want %q, %q, %q",
+				tt.image, registry, repository, tag, tt.registry, tt.repository, tt.tag)
+		}
+	}
+}
+
+func TestRemoteDigest(t *testing.T) {
+	const digest = "sha256:2d4e459f4ecb5329407ae3e47cbc107a2fbace221354ca75960af4c047b3cb13"
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			if r.URL.Query().Get("scope") != "repository:org/mcp:pull" {
+				http.Error(w, "wrong scope", http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`{"token":"anonymous"}`))
+		case r.Header.Get("Authorization") != "Bearer anonymous":
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="test",scope="repository:org/mcp:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.Method != http.MethodHead:
+			// Checking must not download the manifest, let alone the image
+			http.Error(w, "not a HEAD request", http.StatusMethodNotAllowed)
+		case r.URL.Path == "/v2/org/mcp/manifests/latest" && strings.Contains(r.Header.Get("Accept"), "image.index"):
+			w.Header().Set("Docker-Content-Digest", digest)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	got, err := RemoteDigest(host + "/org/mcp:latest")
+	if err != nil || got != digest {
+		t.Errorf("RemoteDigest() = %q, %v, want %q", got, err, digest)
+	}
+
+	if _, err := RemoteDigest(host + "/org/mcp:missing"); err == nil {
+		t.Errorf("RemoteDigest() of a missing tag succeeded")
+	}
+
+	pinned := host + "/org/other@" + digest
+	if got, err := RemoteDigest(pinned); err != nil || got != digest {
+		t.Errorf("RemoteDigest() of a pinned image = %q, %v, want %q", got, err, digest)
+	}
+}
+
+func TestMatchRepoDigest(t *testing.T) {
+	const (
+		hub  = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+		ghcr = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+	)
+	repoDigests := []string{"ghcr.io/org/mcp@" + ghcr, "org/mcp@" + hub}
+
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{"ghcr.io/org/mcp:latest", ghcr},
+		{"org/mcp:latest", hub},
+		{"docker.io/org/mcp", hub},
+		{"ghcr.io/other/mcp:latest", ""},
+		{"quay.io/org/mcp:latest", ""},
+	}
+
+	for _, tt := range tests {
+		got, err := matchRepoDigest(tt.image, repoDigests)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("matchRepoDigest(%q) = %q, want an error", tt.image, got)
+		case tt.want != "" && (err != nil || got != tt.want):
+			t.Errorf("matchRepoDigest(%q) = %q, %v, want %q", tt.image, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/lvrach/smp/internal/paths"
+)
+
+// defaultUsername is sent with tokens that have no username, GitHub and most
+// other hosts accept any username with a personal access token
+const defaultUsername = "x-access-token"
+
+// credentialHelper answers git's credential requests from the environment, so the
+// token never appears in arguments or on disk. Git passes its -c settings on to
+// the git processes it starts, e.g. for submodules or redirects, so the helper
+// only answers for HTTPS requests to the credential's host and path prefix.
+const credentialHelper = `!f() { test "$1" = get || return 0; ` +
+	`while IFS='=' read -r key value; do case "$key" in protocol) protocol=$value;; host) host=${value%%:*};; path) path=${value%.git};; esac; done; ` +
+	`test "$protocol" = https && test "$host" = "$SMP_GIT_HOST" || return 0; ` +
+	`if test -n "$SMP_GIT_PATH"; then case "/$path/" in "/$SMP_GIT_PATH/"*) ;; *) return 0;; esac; fi; ` +
+	`echo "username=${SMP_GIT_USERNAME}"; echo "password=${SMP_GIT_TOKEN}"; }; f`
+
+// command runs git against a remote with smp's credentials for it and returns its
+// stdout. Git never prompts: missing credentials fail with an *Error. Progress goes
+// to stderr so it never mixes with MCP stdio.
+func command(op, repoURL string, args ...string) ([]byte, error) {
+	authArgs, env, err := authenticate(repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("git", append(authArgs, args...)...)
+	cmd.Env = append(os.Environ(), env...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, &Error{
+			Op:     op,
+			URL:    repoURL,
+			Kind:   classify(stderr.String()),
+			Detail: errorLine(stderr.String()),
+		}
+	}
+
+	return out, nil
+}
+
+// authenticate returns the git arguments and environment that apply the stored
+// credential for a remote
+func authenticate(repoURL string) ([]string, []string, error) {
+	var args []string
+	env := []string{"GIT_TERMINAL_PROMPT=0"}
+
+	sshCommand := os.Getenv("GIT_SSH_COMMAND")
+	if sshCommand == "" {
+		sshCommand = "ssh"
+	}
+	sshCommand += " -o BatchMode=yes"
+
+	store, err := NewHomeCredentialStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	cred, err := store.Match(repoURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cred != nil {
+		r := parseURL(repoURL)
+
+		if cred.SSHKey != "" {
+			sshCommand += fmt.Sprintf(" -i '%s' -o IdentitiesOnly=yes", strings.ReplaceAll(paths.ExpandHome(cred.SSHKey), "'", `'\''`))
+		}
+
+		// Rewriting with insteadOf also covers submodules using SSH URLs
+		if cred.HTTPSInsteadOfSSH && r.SSH {
+			args = append(args,
+				"-c", fmt.Sprintf("url.https://%s/.insteadOf=git@%s:", r.Host, r.Host),
+				"-c", fmt.Sprintf("url.https://%s/.insteadOf=ssh://git@%s/", r.Host, r.Host),
+			)
+		}
+
+		token, err := cred.token()
+		if err != nil {
+			return nil, nil, err
+		}
+		if token != "" {
+			username := cred.Username
+			if username == "" {
+				username = defaultUsername
+			}
+			// The empty helper drops configured helpers, so only the stored token is
+			// tried, and useHttpPath makes git tell the helper the path
+			host, path, _ := strings.Cut(strings.Trim(cred.Prefix, "/"), "/")
+			args = append(args,
+				"-c", "credential.helper=",
+				"-c", "credential.helper="+credentialHelper,
+				"-c", "credential.useHttpPath=true",
+			)
+			env = append(env,
+				"SMP_GIT_HOST="+host,
+				"SMP_GIT_PATH="+path,
+				"SMP_GIT_USERNAME="+username,
+				"SMP_GIT_TOKEN="+token,
+			)
+		}
+	}
+
+	env = append(env, "GIT_SSH_COMMAND="+sshCommand)
+	return args, env, nil
+}
+
+// originURL returns the URL of the origin remote of a clone in dir
+func originURL(dir string) (string, error) {
+	out, err := exec.Command("git", "-C", dir, "remote", "get-url", "origin").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read origin of %s: %w", dir, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
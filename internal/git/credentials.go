@@ -0,0 +1,202 @@
+package git
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lvrach/smp/internal/state"
+	"github.com/lvrach/smp/keystore"
+)
+
+// Credential is how smp authenticates to the git repositories under a URL prefix
+type Credential struct {
+	// Prefix of the repositories the credential applies to, as host or host/path,
+	// e.g. github.com or github.com/acme/mcp-definitions
+	Prefix string `json:"prefix"`
+
+	// Username sent with the token over HTTPS
+	Username string `json:"username,omitempty"`
+
+	// Store the token is kept in: state (this file) or keychain
+	SecretStore string `json:"secret_store,omitempty"`
+
+	// Token for HTTPS, when kept in the state store
+	Token string `json:"token,omitempty"`
+
+	// Private key file for SSH, instead of the SSH agent's keys
+	SSHKey string `json:"ssh_key,omitempty"`
+
+	// HTTPSInsteadOfSSH rewrites SSH URLs to HTTPS, so repositories defined with
+	// git@host: URLs are cloned with the token, or anonymously if public
+	HTTPSInsteadOfSSH bool `json:"https_instead_of_ssh,omitempty"`
+}
+
+// HasToken reports whether an HTTPS token is stored for the credential
+func (c *Credential) HasToken() bool {
+	return c.Token != "" || c.SecretStore == state.SecretStoreKeychain
+}
+
+// token returns the HTTPS token of the credential, empty if it has none
+func (c *Credential) token() (string, error) {
+	if c.SecretStore != state.SecretStoreKeychain {
+		return c.Token, nil
+	}
+
+	kc := keystore.KeyChain{}
+	token, err := kc.Retrieve(keystore.AccountType(keychainAccount(c.Prefix)))
+	if err != nil {
+		return "", fmt.Errorf("failed to read git token for %s from keychain: %w", c.Prefix, err)
+	}
+	return token, nil
+}
+
+func keychainAccount(prefix string) string {
+	return "git:" + prefix
+}
+
+// CredentialStore handles the git credentials smp authenticates with
+type CredentialStore struct {
+	path string
+}
+
+// NewCredentialStore operates a credential store in baseDir
+func NewCredentialStore(baseDir string) *CredentialStore {
+	return &CredentialStore{path: filepath.Join(baseDir, "git-credentials.json")}
+}
+
+// NewHomeCredentialStore operates a credential store in the user's home directory
+func NewHomeCredentialStore() (*CredentialStore, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+	}
+
+	return NewCredentialStore(filepath.Join(homeDir, ".smp")), nil
+}
+
+// List returns the stored credentials ordered by prefix
+func (s *CredentialStore) List() ([]Credential, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read git credentials: %w", err)
+	}
+
+	var creds []Credential
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal git credentials: %w", err)
+	}
+
+	return creds, nil
+}
+
+// Save stores a credential, replacing the one for the same prefix. A token is
+// kept in the credential's secret store.
+func (s *CredentialStore) Save(cred Credential, token string) error {
+	cred.Prefix = strings.Trim(cred.Prefix, "/")
+	cred.Token = ""
+
+	if token != "" {
+		if cred.SecretStore == state.SecretStoreKeychain {
+			kc := keystore.KeyChain{}
+			if err := kc.Store(keystore.AccountType(keychainAccount(cred.Prefix)), token); err != nil {
+				return fmt.Errorf("failed to store git token in keychain: %w", err)
+			}
+		} else {
+			cred.SecretStore = state.SecretStoreState
+			cred.Token = token
+		}
+	}
+
+	creds, err := s.List()
+	if err != nil {
+		return err
+	}
+
+	var updated []Credential
+	for _, existing := range creds {
+		if existing.Prefix != cred.Prefix {
+			updated = append(updated, existing)
+		}
+	}
+	updated = append(updated, cred)
+	sort.Slice(updated, func(i, j int) bool {
+		return updated[i].Prefix < updated[j].Prefix
+	})
+
+	return s.save(updated)
+}
+
+// Remove deletes the credential for a prefix and its token
+func (s *CredentialStore) Remove(prefix string) error {
+	prefix = strings.Trim(prefix, "/")
+
+	creds, err := s.List()
+	if err != nil {
+		return err
+	}
+
+	var remaining []Credential
+	for _, cred := range creds {
+		if cred.Prefix != prefix {
+			remaining = append(remaining, cred)
+			continue
+		}
+		if cred.SecretStore == state.SecretStoreKeychain {
+			kc := keystore.KeyChain{}
+			if err := kc.Delete(keystore.AccountType(keychainAccount(prefix))); err != nil {
+				return err
+			}
+		}
+	}
+	if len(remaining) == len(creds) {
+		return fmt.Errorf("no git credential for %q", prefix)
+	}
+
+	return s.save(remaining)
+}
+
+// Match returns the credential with the longest prefix matching a repository URL,
+// nil if there is none
+func (s *CredentialStore) Match(repoURL string) (*Credential, error) {
+	creds, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	r := parseURL(repoURL)
+	var best *Credential
+	for i, cred := range creds {
+		if r.matchesPrefix(cred.Prefix) && (best == nil || len(cred.Prefix) > len(best.Prefix)) {
+			best = &creds[i]
+		}
+	}
+	return best, nil
+}
+
+func (s *CredentialStore) save(creds []Credential) error {
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal git credentials: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to create git credentials directory: %w", err)
+	}
+
+	// Tokens may be kept in this file
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write git credentials: %w", err)
+	}
+	if err := os.Chmod(s.path, 0600); err != nil {
+		return fmt.Errorf("failed to restrict git credentials permissions: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	store := NewCredentialStore(filepath.Join(t.TempDir(), ".smp"))
+	for _, prefix := range []string{"github.com/acme", "github.com/acme/private", "gitlab.com"} {
+		if err := store.Save(Credential{Prefix: prefix}, "token-"+prefix); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "https://github.com/acme/mcp.git", want: "github.com/acme"},
+		{url: "git@github.com:acme/mcp.git", want: "github.com/acme"},
+		{url: "ssh://git@github.com/acme/mcp", want: "github.com/acme"},
+		{url: "https://github.com/acme/private/mcp.git", want: "github.com/acme/private"},
+		{url: "https://github.com/acme/private-mcp.git", want: "github.com/acme"},
+		{url: "https://gitlab.com/org/mcp.git", want: "gitlab.com"},
+		{url: "https://github.com/acme-evil/mcp.git"},
+		{url: "https://github.com/acm.git"},
+		{url: "https://evil.com/github.com/acme/mcp.git"},
+		{url: "https://github.com.evil.com/acme/mcp.git"},
+		{url: "git@evil.com:github.com/acme/mcp.git"},
+		{url: "./github.com/acme/mcp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			cred, err := store.Match(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ""
+			if cred != nil {
+				got = cred.Prefix
+			}
+			if got != tt.want {
+				t.Errorf("Match(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCredentialStoreSave(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), ".smp")
+	store := NewCredentialStore(dir)
+
+	if err := store.Save(Credential{Prefix: "/github.com/acme/"}, "s3cr3t"); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0700 {
+		t.Errorf("directory permissions = %o, want 700", perm)
+	}
+	info, err = os.Stat(filepath.Join(dir, "git-credentials.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("file permissions = %o, want 600", perm)
+	}
+
+	creds, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(creds) != 1 || creds[0].Prefix != "github.com/acme" || creds[0].Token != "s3cr3t" {
+		t.Errorf("List() = %+v", creds)
+	}
+}
+
+func TestCredentialHelper(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell")
+	}
+
+	tests := []struct {
+		name    string
+		prefix  string
+		request string
+		want    bool
+	}{
+		{name: "repository under prefix", prefix: "github.com/acme", request: "protocol=https\nhost=github.com\npath=acme/mcp.git\n", want: true},
+		{name: "host prefix", prefix: "github.com", request: "protocol=https\nhost=github.com\npath=other/mcp.git\n", want: true},
+		{name: "host with port", prefix: "github.com", request: "protocol=https\nhost=github.com:443\npath=acme/mcp\n", want: true},
+		{name: "prefix itself", prefix: "github.com/acme", request: "protocol=https\nhost=github.com\npath=acme\n", want: true},
+		{name: "sibling owner", prefix: "github.com/acme", request: "protocol=https\nhost=github.com\npath=acme-evil/mcp.git\n"},
+		{name: "other host", prefix: "github.com/acme", request: "protocol=https\nhost=evil.com\npath=github.com/acme/mcp.git\n"},
+		{name: "host suffix", prefix: "github.com", request: "protocol=https\nhost=github.com.evil.com\npath=acme/mcp.git\n"},
+		{name: "plain HTTP", prefix: "github.com/acme", request: "protocol=http\nhost=github.com\npath=acme/mcp.git\n"},
+		{name: "no path", prefix: "github.com/acme", request: "protocol=https\nhost=github.com\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, path, _ := strings.Cut(tt.prefix, "/")
+			// Git runs a ! helper in the shell with the operation appended
+			cmd := exec.Command("sh", "-c", strings.TrimPrefix(credentialHelper, "!")+" get")
+			cmd.Stdin = strings.NewReader(tt.request)
+			cmd.Env = append(os.Environ(),
+				"SMP_GIT_HOST="+host,
+				"SMP_GIT_PATH="+path,
+				"SMP_GIT_USERNAME=x-access-token",
+				"SMP_GIT_TOKEN=s3cr3t",
+			)
+			out, err := cmd.Output()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := strings.Contains(string(out), "password=s3cr3t")
+			if got != tt.want {
+				t.Errorf("helper sent token: %v, want %v\n%s", got, tt.want, out)
+			}
+		})
+	}
+}
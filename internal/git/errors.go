@@ -0,0 +1,117 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Kinds of git failures, matched with errors.Is
+var (
+	ErrAuthFailed     = errors.New("authentication failed")
+	ErrBranchNotFound = errors.New("branch or tag not found")
+	ErrNetwork        = errors.New("network unavailable")
+)
+
+// Error is a failed git operation against a remote
+type Error struct {
+	// Operation that failed, e.g. clone
+	Op string
+
+	// URL of the remote
+	URL string
+
+	// Kind of failure, nil if unknown
+	Kind error
+
+	// Last line git printed on stderr
+	Detail string
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("git %s %s failed", e.Op, e.URL)
+	if e.Kind != nil {
+		msg = fmt.Sprintf("git %s %s: %v", e.Op, e.URL, e.Kind)
+	}
+	if hint := e.hint(); hint != "" {
+		msg += " (" + hint + ")"
+	}
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+func (e *Error) hint() string {
+	switch e.Kind {
+	case ErrAuthFailed:
+		r := parseURL(e.URL)
+		if r.SSH {
+			return fmt.Sprintf("check your SSH key, or use 'smp git login %s --ssh-key' or '--https-instead-of-ssh'", r.Host)
+		}
+		return fmt.Sprintf("use 'smp git login %s' to store a token", r.Host)
+	case ErrNetwork:
+		return "check your network connection"
+	}
+	return ""
+}
+
+// classify derives the kind of a failure from git's stderr
+func classify(stderr string) error {
+	s := strings.ToLower(stderr)
+	switch {
+	case containsAny(s,
+		"authentication failed",
+		"could not read username",
+		"could not read password",
+		"terminal prompts disabled",
+		"permission denied (publickey",
+		"host key verification failed",
+		"repository not found",
+		"the requested url returned error: 401",
+		"the requested url returned error: 403"):
+		return ErrAuthFailed
+	case containsAny(s,
+		"remote branch",
+		"couldn't find remote ref",
+		"not our ref"):
+		return ErrBranchNotFound
+	case containsAny(s,
+		"could not resolve host",
+		"could not resolve hostname",
+		"connection timed out",
+		"network is unreachable",
+		"connection refused",
+		"failed to connect",
+		"operation timed out"):
+		return ErrNetwork
+	}
+	return nil
+}
+
+// errorLine picks the line of git's output that explains the failure: the
+// error of ssh, else of git, else the last line after any progress output
+func errorLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	for _, prefix := range []string{"ssh:", "fatal:", "error:"} {
+		for _, line := range lines {
+			if strings.HasPrefix(strings.TrimSpace(line), prefix) {
+				return strings.TrimSpace(line)
+			}
+		}
+	}
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+func containsAny(s string, substrings ...string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
 )
 
 // CloneRepository clones a Git repository into a temporary directory and returns the path
@@ -14,6 +15,17 @@ func CloneRepository(repoURL, branch string) (string, error) {
 		return "", fmt.Errorf("failed to create temporary directory: %w", err)
 	}
 
+	if err := Clone(repoURL, branch, tempDir); err != nil {
+		// Clean up the temporary directory if clone fails
+		os.RemoveAll(tempDir)
+		return "", err
+	}
+
+	return tempDir, nil
+}
+
+// Clone makes a shallow clone of a branch or tag of a Git repository into dir
+func Clone(repoURL, branch, dir string) error {
 	// Prepare clone arguments
 	args := []string{"clone", "--depth=1"}
 
@@ -22,19 +34,148 @@ func CloneRepository(repoURL, branch string) (string, error) {
 		args = append(args, "-b", branch)
 	}
 
-	// Add repository URL and destination
-	args = append(args, repoURL, tempDir)
+	// Add repository URL and destination, after -- so a URL can't pass options
+	args = append(args, "--", repoURL, dir)
 
-	// Execute git clone command
-	cmd := exec.Command("git", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	_, err := command("clone", repoURL, args...)
+	return err
+}
 
-	if err := cmd.Run(); err != nil {
-		// Clean up the temporary directory if clone fails
-		os.RemoveAll(tempDir)
-		return "", fmt.Errorf("failed to clone repository: %w", err)
+// Update fetches the latest commit of branch into a shallow clone in dir and
+// resets the working tree to it
+func Update(dir, branch string) error {
+	ref := "HEAD"
+	if branch != "" {
+		ref = branch
 	}
 
-	return tempDir, nil
+	repoURL, err := originURL(dir)
+	if err != nil {
+		return err
+	}
+
+	if _, err := command("fetch", repoURL, "-C", dir, "fetch", "--depth=1", "--", "origin", ref); err != nil {
+		return err
+	}
+
+	if out, err := exec.Command("git", "-C", dir, "reset", "--hard", "FETCH_HEAD").CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to update repository: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// Checkout fetches a specific commit into a shallow clone in dir and checks it out
+func Checkout(dir, commit string) error {
+	repoURL, err := originURL(dir)
+	if err != nil {
+		return err
+	}
+
+	if _, err := command("fetch", repoURL, "-C", dir, "fetch", "--depth=1", "--", "origin", commit); err != nil {
+		return fmt.Errorf("failed to fetch commit %s: %w", commit, err)
+	}
+
+	if out, err := exec.Command("git", "-C", dir, "checkout", "--detach", "FETCH_HEAD").CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to check out commit %s: %w: %s", commit, err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// HeadCommit returns the SHA of the commit checked out in dir
+func HeadCommit(dir string) (string, error) {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve HEAD commit: %w", err)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// RemoteCommit returns the SHA of the commit a branch or tag of a remote repository
+// points to, or of its default branch if ref is empty
+func RemoteCommit(repoURL, ref string) (string, error) {
+	candidates := []string{"HEAD"}
+	switch {
+	case strings.HasPrefix(ref, "refs/"):
+		candidates = []string{ref}
+	case ref != "":
+		candidates = []string{"refs/heads/" + ref, "refs/tags/" + ref}
+	}
+
+	// Annotated tags point to a tag object, their peeled ^{} entry to the commit
+	args := []string{"ls-remote", "--", repoURL}
+	for _, candidate := range candidates {
+		args = append(args, candidate, candidate+"^{}")
+	}
+
+	out, err := command("ls-remote", repoURL, args...)
+	if err != nil {
+		return "", err
+	}
+
+	commits := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			commits[fields[1]] = fields[0]
+		}
+	}
+	for _, candidate := range candidates {
+		if commit, exists := commits[candidate+"^{}"]; exists {
+			return commit, nil
+		}
+		if commit, exists := commits[candidate]; exists {
+			return commit, nil
+		}
+	}
+
+	return "", &Error{Op: "ls-remote", URL: repoURL, Kind: ErrBranchNotFound, Detail: fmt.Sprintf("no branch or tag %q", ref)}
+}
+
+// UpdateSubmodules checks out the submodules of a clone in dir, recursively and shallowly
+func UpdateSubmodules(dir string) error {
+	repoURL, err := originURL(dir)
+	if err != nil {
+		return err
+	}
+
+	if _, err := command("submodule update", repoURL, "-C", dir, "submodule", "update", "--init", "--recursive", "--depth=1"); err != nil {
+		return fmt.Errorf("failed to check out submodules: %w", err)
+	}
+
+	return nil
+}
+
+// Log returns the one-line summaries of the commits after from up to HEAD in a
+// shallow clone in dir, deepening it as needed. If from is not among the last limit
+// commits, the last limit commits are returned.
+func Log(dir, from string, limit int) ([]string, error) {
+	repoURL, err := originURL(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := command("fetch", repoURL, "-C", dir, "fetch", fmt.Sprintf("--deepen=%d", limit)); err != nil {
+		return nil, fmt.Errorf("failed to fetch history: %w", err)
+	}
+
+	args := []string{"-C", dir, "log", "--oneline", fmt.Sprintf("--max-count=%d", limit)}
+	if from != "" && exec.Command("git", "-C", dir, "cat-file", "-e", from+"^{commit}").Run() == nil {
+		args = append(args, from+"..HEAD")
+	}
+
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit log: %w", err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, nil
 }
@@ -0,0 +1,61 @@
+package git
+
+import (
+	"net/url"
+	"strings"
+)
+
+// remote is a parsed git remote URL
+type remote struct {
+	// Host of the remote, empty for local repositories
+	Host string
+
+	// Path of the repository on the host, without a .git suffix
+	Path string
+
+	// SSH reports whether the remote is reached over SSH
+	SSH bool
+}
+
+// parseURL parses the URL forms git accepts: https://host/path, ssh://[user@]host/path
+// and the scp-like [user@]host:path
+func parseURL(repoURL string) remote {
+	if u, err := url.Parse(repoURL); err == nil && u.Scheme != "" && u.Host != "" {
+		return remote{
+			Host: u.Hostname(),
+			Path: cleanPath(u.Path),
+			SSH:  u.Scheme == "ssh" || u.Scheme == "git+ssh",
+		}
+	}
+
+	// scp-like syntax, as long as there is no slash before the colon
+	if i := strings.Index(repoURL, ":"); i > 0 && !strings.Contains(repoURL[:i], "/") {
+		host := repoURL[:i]
+		if at := strings.LastIndex(host, "@"); at >= 0 {
+			host = host[at+1:]
+		}
+		return remote{Host: host, Path: cleanPath(repoURL[i+1:]), SSH: true}
+	}
+
+	return remote{Path: repoURL}
+}
+
+// String returns the remote as host/path, the form credential prefixes match against
+func (r remote) String() string {
+	if r.Host == "" {
+		return r.Path
+	}
+	return r.Host + "/" + r.Path
+}
+
+func cleanPath(p string) string {
+	return strings.TrimSuffix(strings.Trim(p, "/"), ".git")
+}
+
+// matchesPrefix reports whether a remote is under a credential prefix such as
+// github.com or github.com/acme, matching whole path segments only
+func (r remote) matchesPrefix(prefix string) bool {
+	prefix = strings.Trim(prefix, "/")
+	s := r.String()
+	return s == prefix || strings.HasPrefix(s, prefix+"/")
+}
@@ -0,0 +1,62 @@
+package manifest
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+const lockHeader = "# Generated by smp apply. Do not edit.\n"
+
+// Lock records the exact versions smp apply resolved for a manifest, so every
+// apply of the same manifest installs the same images
+type Lock struct {
+	MCPs map[string]LockedMCP `yaml:"mcps"`
+}
+
+// LockedMCP is the resolved version of an MCP
+type LockedMCP struct {
+	Image      string `yaml:"image,omitempty"`
+	Repository string `yaml:"repository,omitempty"`
+	Digest     string `yaml:"digest,omitempty"`
+	Commit     string `yaml:"commit,omitempty"`
+	Package    string `yaml:"package,omitempty"`
+	Version    string `yaml:"version,omitempty"`
+}
+
+// LoadLock reads a lockfile, returning an empty lock if it doesn't exist
+func LoadLock(path string) (*Lock, error) {
+	lock := &Lock{MCPs: make(map[string]LockedMCP)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return lock, nil
+		}
+		return nil, fmt.Errorf("failed to read lockfile: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("failed to parse lockfile %s: %w", path, err)
+	}
+	if lock.MCPs == nil {
+		lock.MCPs = make(map[string]LockedMCP)
+	}
+
+	return lock, nil
+}
+
+// Save writes the lockfile
+func (l *Lock) Save(path string) error {
+	data, err := yaml.Marshal(l)
+	if err != nil {
+		return fmt.Errorf("failed to marshal lockfile: %w", err)
+	}
+
+	if err := os.WriteFile(path, append([]byte(lockHeader), data...), 0644); err != nil {
+		return fmt.Errorf("failed to write lockfile: %w", err)
+	}
+
+	return nil
+}
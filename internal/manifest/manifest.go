@@ -0,0 +1,164 @@
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/lvrach/smp/internal/paths"
+	"github.com/lvrach/smp/internal/state"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is the manifest smp apply reads when none is given
+const DefaultFile = "smp.yaml"
+
+// LockFile is the name of the lockfile written next to a manifest
+const LockFile = "smp.lock"
+
+var (
+	commitPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	digestPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+)
+
+// Manifest declares the MCPs every member of a team should have installed
+type Manifest struct {
+	// Secret store for secrets of newly installed MCPs: state or keychain
+	SecretStore string `yaml:"secret_store,omitempty"`
+
+	MCPs []MCP `yaml:"mcps"`
+}
+
+// MCP is an MCP declared in a manifest
+type MCP struct {
+	Name string `yaml:"name"`
+
+	// Commit to build, for MCPs built from a repository
+	Commit string `yaml:"commit,omitempty"`
+
+	// Image digest to run, for MCPs using a prebuilt image
+	Digest string `yaml:"digest,omitempty"`
+
+	// Package version to build, for MCPs installed from npm or PyPI
+	Version string `yaml:"version,omitempty"`
+
+	// Hosts to configure the MCP in, all available hosts if empty
+	Hosts []string `yaml:"hosts,omitempty"`
+
+	// Features to enable from the definition's variable groups
+	Features []string `yaml:"features,omitempty"`
+
+	// Values of non-secret environment variables
+	Env map[string]string `yaml:"env,omitempty"`
+
+	// References to the values of secret environment variables,
+	// env:NAME to read an environment variable or file:PATH to read a file
+	Secrets map[string]string `yaml:"secrets,omitempty"`
+
+	// Tools the host may see and call, glob patterns of tool names
+	Tools *state.ToolPolicy `yaml:"tools,omitempty"`
+}
+
+// Load reads and validates a manifest, rejecting unknown fields
+func Load(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	var m Manifest
+	if err := decoder.Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+
+	return &m, nil
+}
+
+// Validate checks the manifest for duplicate MCPs and malformed versions
+func (m *Manifest) Validate() error {
+	switch m.SecretStore {
+	case "", state.SecretStoreState, state.SecretStoreKeychain:
+	default:
+		return fmt.Errorf("unknown secret_store %q, expected state or keychain", m.SecretStore)
+	}
+
+	seen := make(map[string]bool)
+	for _, mcp := range m.MCPs {
+		if mcp.Name == "" {
+			return fmt.Errorf("MCP without a name")
+		}
+		if seen[mcp.Name] {
+			return fmt.Errorf("MCP %q is declared more than once", mcp.Name)
+		}
+		seen[mcp.Name] = true
+
+		if mcp.Commit != "" && !commitPattern.MatchString(mcp.Commit) {
+			return fmt.Errorf("MCP %q: commit must be a full 40 character SHA", mcp.Name)
+		}
+		if mcp.Digest != "" && !digestPattern.MatchString(mcp.Digest) {
+			return fmt.Errorf("MCP %q: digest must be of the form sha256:<64 hex characters>", mcp.Name)
+		}
+		if (mcp.Commit != "" && mcp.Digest != "") || (mcp.Version != "" && (mcp.Commit != "" || mcp.Digest != "")) {
+			return fmt.Errorf("MCP %q: commit, digest and version are mutually exclusive", mcp.Name)
+		}
+
+		for name, ref := range mcp.Secrets {
+			if _, _, ok := strings.Cut(ref, ":"); !ok {
+				return fmt.Errorf("MCP %q: secret %s must reference env:NAME or file:PATH", mcp.Name, name)
+			}
+		}
+
+		if err := mcp.Tools.Validate(); err != nil {
+			return fmt.Errorf("MCP %q: %w", mcp.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Get returns the MCP with the given name, nil if the manifest does not declare it
+func (m *Manifest) Get(name string) *MCP {
+	for i := range m.MCPs {
+		if m.MCPs[i].Name == name {
+			return &m.MCPs[i]
+		}
+	}
+	return nil
+}
+
+// ResolveSecret returns the value a secret reference points to
+func ResolveSecret(ref string) (string, error) {
+	kind, target, _ := strings.Cut(ref, ":")
+
+	switch kind {
+	case "env":
+		value, exists := os.LookupEnv(target)
+		if !exists {
+			return "", fmt.Errorf("environment variable %s is not set", target)
+		}
+		return value, nil
+	case "file":
+		data, err := os.ReadFile(paths.ExpandHome(target))
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	default:
+		return "", fmt.Errorf("unknown secret reference %q, expected env:NAME or file:PATH", ref)
+	}
+}
+
+// LockPath returns the path of the lockfile belonging to a manifest
+func LockPath(manifestPath string) string {
+	return filepath.Join(filepath.Dir(manifestPath), LockFile)
+}
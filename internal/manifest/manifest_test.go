@@ -0,0 +1,161 @@
+package manifest_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lvrach/smp/internal/manifest"
+	"github.com/lvrach/smp/internal/state"
+)
+
+const commit = "0123456789abcdef0123456789abcdef01234567"
+
+func TestValidate(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("ab", 32)
+
+	tests := []struct {
+		name     string
+		manifest manifest.Manifest
+		wantErr  string
+	}{
+		{
+			name: "valid",
+			manifest: manifest.Manifest{SecretStore: state.SecretStoreKeychain, MCPs: []manifest.MCP{
+				{Name: "a", Commit: commit, Secrets: map[string]string{"TOKEN": "env:TOKEN"}},
+				{Name: "b", Digest: digest, Tools: &state.ToolPolicy{Allow: []string{"get_*"}}},
+				{Name: "c", Version: "1.2.0"},
+			}},
+		},
+		{
+			name:     "unknown secret store",
+			manifest: manifest.Manifest{SecretStore: "vault"},
+			wantErr:  "unknown secret_store",
+		},
+		{
+			name:     "no name",
+			manifest: manifest.Manifest{MCPs: []manifest.MCP{{Commit: commit}}},
+			wantErr:  "without a name",
+		},
+		{
+			name:     "duplicate",
+			manifest: manifest.Manifest{MCPs: []manifest.MCP{{Name: "a"}, {Name: "a"}}},
+			wantErr:  "more than once",
+		},
+		{
+			name:     "short commit",
+			manifest: manifest.Manifest{MCPs: []manifest.MCP{{Name: "a", Commit: "0123456"}}},
+			wantErr:  "full 40 character SHA",
+		},
+		{
+			name:     "malformed digest",
+			manifest: manifest.Manifest{MCPs: []manifest.MCP{{Name: "a", Digest: "sha256:abc"}}},
+			wantErr:  "digest must be",
+		},
+		{
+			name:     "commit and digest",
+			manifest: manifest.Manifest{MCPs: []manifest.MCP{{Name: "a", Commit: commit, Digest: digest}}},
+			wantErr:  "mutually exclusive",
+		},
+		{
+			name:     "version and commit",
+			manifest: manifest.Manifest{MCPs: []manifest.MCP{{Name: "a", Commit: commit, Version: "1.0.0"}}},
+			wantErr:  "mutually exclusive",
+		},
+		{
+			name:     "secret without reference",
+			manifest: manifest.Manifest{MCPs: []manifest.MCP{{Name: "a", Secrets: map[string]string{"TOKEN": "s3cr3t"}}}},
+			wantErr:  "must reference env:NAME or file:PATH",
+		},
+		{
+			name:     "invalid tool pattern",
+			manifest: manifest.Manifest{MCPs: []manifest.MCP{{Name: "a", Tools: &state.ToolPolicy{Deny: []string{"[a-"}}}}},
+			wantErr:  "invalid tool pattern",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.manifest.Validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Validate() = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Validate() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsUnknownFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), manifest.DefaultFile)
+	if err := os.WriteFile(path, []byte("mcps:\n  - name: a\n    comit: "+commit+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manifest.Load(path); err == nil || !strings.Contains(err.Error(), "comit") {
+		t.Errorf("Load() = %v, want an error naming the unknown field", err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	path := manifest.LockPath(filepath.Join(t.TempDir(), manifest.DefaultFile))
+
+	lock, err := manifest.LoadLock(path)
+	if err != nil {
+		t.Fatalf("LoadLock() of a missing lockfile = %v", err)
+	}
+	if lock.MCPs == nil || len(lock.MCPs) != 0 {
+		t.Fatalf("got %+v, want an empty lock", lock)
+	}
+
+	lock.MCPs["a"] = manifest.LockedMCP{Repository: "https://github.com/org/a.git", Commit: commit}
+	lock.MCPs["b"] = manifest.LockedMCP{Package: "npm:@org/b", Version: "1.2.0"}
+	if err := lock.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "# Generated by smp apply") {
+		t.Errorf("lockfile lacks its header:\n%s", data)
+	}
+
+	loaded, err := manifest.LoadLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, lock) {
+		t.Errorf("loaded %+v, want %+v", loaded, lock)
+	}
+}
+
+func TestResolveSecret(t *testing.T) {
+	t.Setenv("SMP_TEST_TOKEN", "from-env")
+	file := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{ref: "env:SMP_TEST_TOKEN", want: "from-env"},
+		{ref: "file:" + file, want: "from-file"},
+		{ref: "env:SMP_TEST_UNSET", wantErr: true},
+		{ref: "file:" + file + ".missing", wantErr: true},
+		{ref: "vault:token", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := manifest.ResolveSecret(tt.ref)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ResolveSecret(%q) = %q, %v", tt.ref, got, err)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package pin
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/lvrach/smp/internal/proxy"
+	"github.com/lvrach/smp/internal/state"
+)
+
+// ErrorCode is the JSON-RPC error code of requests for tools, prompts and
+// resources that are blocked until their changes are approved
+const ErrorCode = -32001
+
+// Guard checks the tools, prompts and resources an MCP lists during a session
+// against their pins. Until a list is pinned, in the first session that lists it,
+// it pins every item it sees. Afterwards, new and changed items are recorded as
+// pending and, in block mode, hidden from the host until they are approved.
+type Guard struct {
+	name     string
+	mode     string
+	trusting map[string]bool
+	pins     map[string]state.PinnedList
+	pending  map[string]state.PinnedList
+	save     func(pins, pending map[string]state.PinnedList) error
+	log      io.Writer
+
+	mu sync.Mutex
+}
+
+// NewGuard creates a guard for a session of an MCP. save is called with the pins
+// and pending changes whenever they grow; messages go to log.
+func NewGuard(mcpState *state.MCPServer, save func(pins, pending map[string]state.PinnedList) error, log io.Writer) *Guard {
+	mode := mcpState.PinMode
+	if mode == "" {
+		mode = ModeBlock
+	}
+
+	trusting := make(map[string]bool)
+	for method := range lists {
+		if _, pinned := mcpState.Pins[method]; !pinned {
+			trusting[method] = true
+		}
+	}
+
+	return &Guard{
+		name:     mcpState.Name,
+		mode:     mode,
+		trusting: trusting,
+		pins:     copyLists(mcpState.Pins),
+		pending:  copyLists(mcpState.PendingPins),
+		save:     save,
+		log:      log,
+	}
+}
+
+// HostMessage answers requests for blocked items with an error instead of
+// forwarding them to the MCP
+func (g *Guard) HostMessage(msg *proxy.Message) *proxy.Message {
+	if !msg.IsRequest() {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.mode != ModeBlock {
+		return nil
+	}
+	for method, l := range lists {
+		if l.use != msg.Method {
+			continue
+		}
+		key := msg.StringParam(l.useParam)
+		if _, blocked := g.pending[method].Items[key]; blocked {
+			return proxy.ErrorResponse(msg, ErrorCode, fmt.Sprintf("%s changed since it was approved, run 'smp approve %s' to allow it", Change{Method: method, Name: key}.Subject(), g.name))
+		}
+	}
+	return nil
+}
+
+// ServerMessage checks list results against the pins and, in block mode, removes
+// new and changed items before they reach the host
+func (g *Guard) ServerMessage(msg *proxy.Message, call *proxy.Call) {
+	if call == nil || len(msg.Result) == 0 {
+		return
+	}
+	method := call.Request.Method
+	if _, ok := lists[method]; !ok {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	items, err := listItems(method, msg.Result)
+	if err != nil {
+		fmt.Fprintf(g.log, "smp: %v\n", err)
+		return
+	}
+
+	var changes []Change
+	updated := false
+	for key, item := range items {
+		itemHash := hashItem(item)
+		pinned, isPinned := g.pins[method].Items[key]
+		switch {
+		case isPinned && pinned == itemHash:
+			// Changes reverted by the MCP need no approval anymore
+			if _, ok := g.pending[method].Items[key]; ok {
+				remove(g.pending, method, key)
+				updated = true
+			}
+			continue
+		case g.trusting[method]:
+			g.pins = add(g.pins, method, key, itemHash)
+			updated = true
+			continue
+		}
+
+		changes = append(changes, Change{Method: method, Name: key, New: !isPinned})
+		if g.pending[method].Items[key] != itemHash {
+			g.pending = add(g.pending, method, key, itemHash)
+			updated = true
+		}
+	}
+
+	if updated && g.save != nil {
+		if err := g.save(copyLists(g.pins), copyLists(g.pending)); err != nil {
+			fmt.Fprintf(g.log, "smp: failed to save pins: %v\n", err)
+		}
+	}
+
+	if len(changes) == 0 {
+		return
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	for _, change := range changes {
+		fmt.Fprintf(g.log, "smp: %s: %s, not approved yet\n", g.name, change)
+	}
+	if g.mode != ModeBlock {
+		return
+	}
+	fmt.Fprintf(g.log, "smp: %s: blocked %d change(s), review and allow them with 'smp approve %s'\n", g.name, len(changes), g.name)
+
+	changed := make(map[string]bool)
+	for _, change := range changes {
+		changed[change.Name] = true
+	}
+	filtered, err := proxy.FilterItems(msg.Result, lists[method].field, lists[method].key, func(key string) bool {
+		return !changed[key]
+	})
+	if err != nil {
+		fmt.Fprintf(g.log, "smp: %v\n", err)
+		msg.Result = nil
+		msg.Error = &proxy.Error{Code: ErrorCode, Message: fmt.Sprintf("%s result of %s could not be filtered", method, g.name)}
+		return
+	}
+	msg.Result = filtered
+}
+
+func copyLists(lists map[string]state.PinnedList) map[string]state.PinnedList {
+	if lists == nil {
+		return nil
+	}
+	copied := make(map[string]state.PinnedList, len(lists))
+	for method, l := range lists {
+		items := make(map[string]string, len(l.Items))
+		for key, itemHash := range l.Items {
+			items[key] = itemHash
+		}
+		copied[method] = state.PinnedList{Hash: l.Hash, Items: items}
+	}
+	return copied
+}
@@ -0,0 +1,181 @@
+package pin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lvrach/smp/internal/state"
+)
+
+// Modes of handling definitions that differ from their pins
+const (
+	ModeBlock = "block"
+	ModeWarn  = "warn"
+)
+
+// list describes an MCP list method whose items are pinned
+type list struct {
+	// Field of the result holding the items
+	field string
+
+	// Field identifying an item
+	key string
+
+	// Method using an item, and the parameter naming it
+	use      string
+	useParam string
+}
+
+var lists = map[string]list{
+	"tools/list":     {field: "tools", key: "name", use: "tools/call", useParam: "name"},
+	"prompts/list":   {field: "prompts", key: "name", use: "prompts/get", useParam: "name"},
+	"resources/list": {field: "resources", key: "uri", use: "resources/read", useParam: "uri"},
+}
+
+// Change is a tool, prompt or resource that differs from its pin
+type Change struct {
+	Method string
+	Name   string
+
+	// Whether the item was not pinned at all
+	New bool
+}
+
+// String describes the change, e.g. tool jira_get_issue changed
+func (c Change) String() string {
+	if c.New {
+		return "new " + c.Subject()
+	}
+	return c.Subject() + " changed"
+}
+
+// Subject names the item of a change, e.g. tool jira_get_issue
+func (c Change) Subject() string {
+	return strings.TrimSuffix(lists[c.Method].field, "s") + " " + c.Name
+}
+
+// listItems returns the items of a list result keyed by name, or URI for resources,
+// with the raw JSON of each
+func listItems(method string, result json.RawMessage) (map[string]json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(result, &fields); err != nil {
+		return nil, fmt.Errorf("failed to parse %s result: %w", method, err)
+	}
+
+	var raw []json.RawMessage
+	if data, ok := fields[lists[method].field]; ok {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("failed to parse %s result: %w", method, err)
+		}
+	}
+
+	items := make(map[string]json.RawMessage, len(raw))
+	for _, item := range raw {
+		var keyed map[string]json.RawMessage
+		if err := json.Unmarshal(item, &keyed); err != nil {
+			return nil, fmt.Errorf("failed to parse %s result: %w", method, err)
+		}
+		var key string
+		json.Unmarshal(keyed[lists[method].key], &key)
+		items[key] = item
+	}
+	return items, nil
+}
+
+// hashItem returns the hash of an item's canonical JSON, so formatting and key
+// order don't matter
+func hashItem(item json.RawMessage) string {
+	var v interface{}
+	if err := json.Unmarshal(item, &v); err != nil {
+		return hash(item)
+	}
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return hash(item)
+	}
+	return hash(canonical)
+}
+
+// listHash returns the hash of a list from the hashes of its items, independent
+// of the order the MCP returns them in
+func listHash(items map[string]string) string {
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s\x00%s\n", key, items[key])
+	}
+	return hash([]byte(b.String()))
+}
+
+func hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// add records an item hash in a set of pinned lists
+func add(lists map[string]state.PinnedList, method, key, itemHash string) map[string]state.PinnedList {
+	if lists == nil {
+		lists = make(map[string]state.PinnedList)
+	}
+	pinned := lists[method]
+	if pinned.Items == nil {
+		pinned.Items = make(map[string]string)
+	}
+	pinned.Items[key] = itemHash
+	pinned.Hash = listHash(pinned.Items)
+	lists[method] = pinned
+	return lists
+}
+
+// remove drops an item hash from a set of pinned lists
+func remove(lists map[string]state.PinnedList, method, key string) {
+	pinned, ok := lists[method]
+	if !ok {
+		return
+	}
+	delete(pinned.Items, key)
+	if len(pinned.Items) == 0 {
+		delete(lists, method)
+		return
+	}
+	pinned.Hash = listHash(pinned.Items)
+	lists[method] = pinned
+}
+
+// Pending returns the changes awaiting approval
+func Pending(mcpState *state.MCPServer) []Change {
+	var changes []Change
+	for method, pending := range mcpState.PendingPins {
+		for key := range pending.Items {
+			_, pinned := mcpState.Pins[method].Items[key]
+			changes = append(changes, Change{Method: method, Name: key, New: !pinned})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Method != changes[j].Method {
+			return changes[i].Method < changes[j].Method
+		}
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+// Approve pins the pending changes of an MCP
+func Approve(mcpState *state.MCPServer) {
+	for method, pending := range mcpState.PendingPins {
+		for key, itemHash := range pending.Items {
+			mcpState.Pins = add(mcpState.Pins, method, key, itemHash)
+		}
+	}
+	mcpState.PendingPins = nil
+}
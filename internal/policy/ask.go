@@ -0,0 +1,258 @@
+package policy
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Ways of asking the user to confirm a tool call
+const (
+	AskAuto   = "auto"
+	AskDialog = "dialog"
+	AskTTY    = "tty"
+	AskWeb    = "web"
+)
+
+// ErrNoDialog is returned when no desktop dialog can be shown
+var ErrNoDialog = errors.New("no desktop dialog available, install zenity or kdialog, or confirm with --confirm tty or web")
+
+// ErrTooLong is returned when the arguments of a call don't fit in a dialog
+var ErrTooLong = errors.New("arguments too long to show in a dialog, confirm with --confirm tty or web")
+
+// maxDialogArgs is the length of the longest arguments shown in a desktop
+// dialog. Dialogs don't scroll, and longer arguments could hide their end
+// below the screen.
+const maxDialogArgs = 2000
+
+// Asker asks the user to confirm a tool call and reports whether they approved
+// it. It returns when the context is done.
+type Asker func(ctx context.Context, c Confirmation) (bool, error)
+
+// NewAsker returns the asker for a way of asking: a desktop dialog, the
+// terminal, a page in the browser, or auto for the first of them available.
+// Messages such as the page's address go to log.
+func NewAsker(method string, log io.Writer) (Asker, error) {
+	switch method {
+	case AskAuto:
+		return func(ctx context.Context, c Confirmation) (bool, error) {
+			if dialogAvailable() && len(c.Args) <= maxDialogArgs {
+				return askDialog(ctx, c)
+			}
+			if tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0); err == nil {
+				return askTTY(ctx, tty, c)
+			}
+			return askWeb(ctx, c, log)
+		}, nil
+	case AskDialog:
+		return askDialog, nil
+	case AskTTY:
+		return func(ctx context.Context, c Confirmation) (bool, error) {
+			tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+			if err != nil {
+				return false, fmt.Errorf("no terminal to ask on: %w", err)
+			}
+			return askTTY(ctx, tty, c)
+		}, nil
+	case AskWeb:
+		return func(ctx context.Context, c Confirmation) (bool, error) {
+			return askWeb(ctx, c, log)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown confirmation method %q, expected auto, dialog, tty or web", method)
+}
+
+// dialogAvailable reports whether a desktop dialog can be shown
+func dialogAvailable() bool {
+	switch runtime.GOOS {
+	case "darwin":
+		_, err := exec.LookPath("osascript")
+		return err == nil
+	case "linux":
+		if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+			return false
+		}
+		for _, tool := range []string{"zenity", "kdialog"} {
+			if _, err := exec.LookPath(tool); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// askDialog shows a desktop dialog with Allow and Deny buttons
+func askDialog(ctx context.Context, c Confirmation) (bool, error) {
+	if len(c.Args) > maxDialogArgs {
+		return false, ErrTooLong
+	}
+
+	var cmd *exec.Cmd
+	switch {
+	case runtime.GOOS == "darwin":
+		// The text is passed as an argument, so it needs no AppleScript quoting
+		cmd = exec.CommandContext(ctx, "osascript",
+			"-e", "on run argv",
+			"-e", `display dialog (item 1 of argv) with title "smp" buttons {"Deny", "Allow"} default button "Deny" cancel button "Deny" with icon caution`,
+			"-e", "end run",
+			c.Text())
+	case hasCommand("zenity"):
+		cmd = exec.CommandContext(ctx, "zenity", "--question", "--title=smp", "--no-markup",
+			"--ok-label=Allow", "--cancel-label=Deny", "--text="+c.Text())
+	case hasCommand("kdialog"):
+		cmd = exec.CommandContext(ctx, "kdialog", "--title", "smp", "--yes-label", "Allow", "--no-label", "Deny", "--yesno", c.Text())
+	default:
+		return false, ErrNoDialog
+	}
+
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		// Deny, or the dialog was closed
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to show dialog: %w", err)
+	}
+	return true, nil
+}
+
+func hasCommand(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// askTTY asks on the terminal smp runs in, as stdin and stdout belong to the host
+func askTTY(ctx context.Context, tty *os.File, c Confirmation) (bool, error) {
+	defer tty.Close()
+
+	fmt.Fprintf(tty, "\nsmp: %s\nAllow? [y/N] ", c.Text())
+
+	answer := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(tty).ReadString('\n')
+		answer <- line
+	}()
+
+	select {
+	case line := <-answer:
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "y", "yes":
+			return true, nil
+		}
+		return false, nil
+	case <-ctx.Done():
+		fmt.Fprintln(tty)
+		return false, ctx.Err()
+	}
+}
+
+var confirmPage = template.Must(template.New("confirm").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>smp: confirm {{.Tool}}</title></head>
+<body style="font-family: sans-serif; max-width: 48em; margin: 2em auto">
+{{if .Decided}}
+<p>{{.Decided}}, you can close this page.</p>
+{{else}}
+<h2>Allow a call to {{.Tool}} of {{.MCP}}?</h2>
+<pre style="background: #f4f4f4; padding: 1em; white-space: pre-wrap">{{.Args}}</pre>
+<form method="post">
+<button name="decision" value="allow">Allow</button>
+<button name="decision" value="deny">Deny</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+// askWeb serves a page to confirm the call on a random local address and opens
+// it in the browser. The address holds a random token, so other local users
+// and web pages can't decide in the user's place.
+func askWeb(ctx context.Context, c Confirmation, log io.Writer) (bool, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return false, err
+	}
+	path := "/" + hex.EncodeToString(token)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return false, fmt.Errorf("failed to listen for confirmation: %w", err)
+	}
+
+	decision := make(chan bool, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		page := struct {
+			Confirmation
+			Decided string
+		}{Confirmation: c}
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			confirmPage.Execute(w, page)
+			return
+		}
+
+		approved := r.FormValue("decision") == "allow"
+		page.Decided = "Denied"
+		if approved {
+			page.Decided = "Allowed"
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		confirmPage.Execute(w, page)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+
+		select {
+		case decision <- approved:
+		default:
+		}
+	})
+
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	defer server.Close()
+
+	url := "http://" + listener.Addr().String() + path
+	fmt.Fprintf(log, "smp: confirm the call to %s of %s at %s\n", c.Tool, c.MCP, url)
+	openBrowser(url)
+
+	select {
+	case approved := <-decision:
+		return approved, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// openBrowser opens a URL in the default browser, if there is one
+func openBrowser(url string) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	if cmd.Start() == nil {
+		go cmd.Wait()
+	}
+}
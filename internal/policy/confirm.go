@@ -0,0 +1,135 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/lvrach/smp/internal/proxy"
+	"github.com/lvrach/smp/internal/state"
+)
+
+// DeniedCode is the JSON-RPC error code of tool calls the user denied or didn't
+// confirm in time
+const DeniedCode = -32002
+
+// Confirmation is a tool call waiting for the user's approval
+type Confirmation struct {
+	MCP  string
+	Tool string
+
+	// Args are the indented JSON arguments of the call, never cut, as the user
+	// must see all of what they approve
+	Args string
+}
+
+// Text describes the call to the user
+func (c Confirmation) Text() string {
+	return fmt.Sprintf("Allow the host to call the tool %s of %s with these arguments?\n\n%s", c.Tool, c.MCP, c.Args)
+}
+
+// Confirmer is an interceptor holding calls to tools the policy marks for
+// confirmation until the user approves them, answering with an error when the
+// user denies a call or doesn't answer in time
+type Confirmer struct {
+	name    string
+	policy  *state.ToolPolicy
+	ask     Asker
+	timeout time.Duration
+	log     io.Writer
+
+	// turn lets one confirmation ask the user at a time
+	turn chan struct{}
+}
+
+// NewConfirmer creates a confirmer for the tools of an MCP that need
+// confirmation, nil if none do
+func NewConfirmer(mcpState *state.MCPServer, ask Asker, timeout time.Duration, log io.Writer) *Confirmer {
+	if mcpState.Tools == nil || len(mcpState.Tools.Confirm) == 0 {
+		return nil
+	}
+	return &Confirmer{
+		name:    mcpState.Name,
+		policy:  mcpState.Tools,
+		ask:     ask,
+		timeout: timeout,
+		log:     log,
+		turn:    make(chan struct{}, 1),
+	}
+}
+
+// HostMessage passes every message, calls to confirm are held instead
+func (c *Confirmer) HostMessage(*proxy.Message) *proxy.Message {
+	return nil
+}
+
+// ServerMessage passes every message
+func (c *Confirmer) ServerMessage(*proxy.Message, *proxy.Call) {}
+
+// Hold reports whether a message is a call to a tool that needs confirmation
+func (c *Confirmer) Hold(msg *proxy.Message) bool {
+	return msg.Method == "tools/call" && msg.IsRequest() && c.policy.NeedsConfirmation(msg.StringParam("name"))
+}
+
+// Decide asks the user to confirm a call, waiting for earlier confirmations
+func (c *Confirmer) Decide(msg *proxy.Message) *proxy.Message {
+	tool := msg.StringParam("name")
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	select {
+	case c.turn <- struct{}{}:
+		defer func() { <-c.turn }()
+	case <-ctx.Done():
+		return c.deny(msg, tool, ctx.Err())
+	}
+
+	fmt.Fprintf(c.log, "smp: %s: waiting for confirmation of a call to tool %s\n", c.name, tool)
+	approved, err := c.ask(ctx, Confirmation{MCP: c.name, Tool: tool, Args: formatArgs(msg)})
+	if err == nil && approved {
+		fmt.Fprintf(c.log, "smp: %s: call to tool %s confirmed\n", c.name, tool)
+		return nil
+	}
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return c.deny(msg, tool, err)
+}
+
+func (c *Confirmer) deny(msg *proxy.Message, tool string, err error) *proxy.Message {
+	var reason string
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		reason = fmt.Sprintf("was not confirmed within %s", c.timeout)
+	case err != nil:
+		fmt.Fprintf(c.log, "smp: %s: failed to ask for confirmation: %v\n", c.name, err)
+		reason = "could not be confirmed"
+	default:
+		reason = "was denied by the user"
+	}
+
+	fmt.Fprintf(c.log, "smp: %s: call to tool %s %s\n", c.name, tool, reason)
+	return proxy.ErrorResponse(msg, DeniedCode, fmt.Sprintf("call to tool %s of %s %s", tool, c.name, reason))
+}
+
+// formatArgs returns the indented arguments of a tools/call request
+func formatArgs(msg *proxy.Message) string {
+	var params struct {
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	json.Unmarshal(msg.Params, &params)
+	if len(params.Arguments) == 0 {
+		return "{}"
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, params.Arguments, "", "  "); err != nil {
+		return string(params.Arguments)
+	}
+	return buf.String()
+}
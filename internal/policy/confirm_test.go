@@ -0,0 +1,218 @@
+package policy_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lvrach/smp/internal/policy"
+	"github.com/lvrach/smp/internal/proxy"
+	"github.com/lvrach/smp/internal/state"
+)
+
+func toolCall(id, tool, args string) *proxy.Message {
+	return &proxy.Message{
+		JSONRPC: "2.0",
+		ID:      json.RawMessage(id),
+		Method:  "tools/call",
+		Params:  json.RawMessage(`{"name":"` + tool + `","arguments":` + args + `}`),
+	}
+}
+
+func newConfirmer(t *testing.T, ask policy.Asker, timeout time.Duration) *policy.Confirmer {
+	t.Helper()
+	mcpState := &state.MCPServer{Name: "jira", Tools: &state.ToolPolicy{Confirm: []string{"delete_*", "update_issue"}}}
+	c := policy.NewConfirmer(mcpState, ask, timeout, io.Discard)
+	if c == nil {
+		t.Fatal("NewConfirmer returned nil for a policy with confirmations")
+	}
+	return c
+}
+
+func TestNeedsConfirmation(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *state.ToolPolicy
+		tool   string
+		want   bool
+	}{
+		{name: "no policy", tool: "delete_issue"},
+		{name: "no confirmations", policy: &state.ToolPolicy{Deny: []string{"*"}}, tool: "delete_issue"},
+		{name: "exact", policy: &state.ToolPolicy{Confirm: []string{"update_issue"}}, tool: "update_issue", want: true},
+		{name: "glob", policy: &state.ToolPolicy{Confirm: []string{"delete_*"}}, tool: "delete_issue", want: true},
+		{name: "not matched", policy: &state.ToolPolicy{Confirm: []string{"delete_*"}}, tool: "get_issue"},
+		{name: "prefix only", policy: &state.ToolPolicy{Confirm: []string{"delete"}}, tool: "delete_issue"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.NeedsConfirmation(tt.tool); got != tt.want {
+				t.Errorf("NeedsConfirmation(%q) = %v, want %v", tt.tool, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewConfirmerWithoutConfirmations(t *testing.T) {
+	mcpState := &state.MCPServer{Name: "jira", Tools: &state.ToolPolicy{Deny: []string{"delete_*"}}}
+	if c := policy.NewConfirmer(mcpState, nil, time.Second, io.Discard); c != nil {
+		t.Errorf("got a confirmer for a policy without confirmations")
+	}
+}
+
+func TestHold(t *testing.T) {
+	c := newConfirmer(t, nil, time.Second)
+
+	tests := []struct {
+		name string
+		msg  *proxy.Message
+		want bool
+	}{
+		{name: "marked tool", msg: toolCall("1", "delete_issue", "{}"), want: true},
+		{name: "other tool", msg: toolCall("1", "get_issue", "{}")},
+		{name: "notification", msg: &proxy.Message{JSONRPC: "2.0", Method: "tools/call", Params: json.RawMessage(`{"name":"delete_issue"}`)}},
+		{name: "other method", msg: &proxy.Message{JSONRPC: "2.0", ID: json.RawMessage("1"), Method: "tools/list"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.Hold(tt.msg); got != tt.want {
+				t.Errorf("Hold() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecide(t *testing.T) {
+	// The start of the arguments is padded, the end must still be shown
+	padded := `{"padding":"` + strings.Repeat(" ", 10000) + `","command":"rm -rf /"}`
+
+	tests := []struct {
+		name      string
+		args      string
+		ask       policy.Asker
+		wantError string
+	}{
+		{
+			name: "approved",
+			args: `{"key":"ABC-1"}`,
+			ask:  func(context.Context, policy.Confirmation) (bool, error) { return true, nil },
+		},
+		{
+			name:      "denied",
+			args:      `{"key":"ABC-1"}`,
+			ask:       func(context.Context, policy.Confirmation) (bool, error) { return false, nil },
+			wantError: "was denied by the user",
+		},
+		{
+			name: "timeout",
+			args: `{"key":"ABC-1"}`,
+			ask: func(ctx context.Context, _ policy.Confirmation) (bool, error) {
+				<-ctx.Done()
+				return false, ctx.Err()
+			},
+			wantError: "was not confirmed within",
+		},
+		{
+			name:      "asker failed",
+			args:      `{"key":"ABC-1"}`,
+			ask:       func(context.Context, policy.Confirmation) (bool, error) { return false, policy.ErrNoDialog },
+			wantError: "could not be confirmed",
+		},
+		{
+			name: "full arguments",
+			args: padded,
+			ask: func(_ context.Context, c policy.Confirmation) (bool, error) {
+				return strings.Contains(c.Args, `"command": "rm -rf /"`), nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newConfirmer(t, tt.ask, 50*time.Millisecond)
+			msg := toolCall("7", "delete_issue", tt.args)
+
+			resp := c.Decide(msg)
+			if tt.wantError == "" {
+				if resp != nil {
+					t.Fatalf("got error response %+v, want the call to pass", resp.Error)
+				}
+				return
+			}
+			if resp == nil || resp.Error == nil {
+				t.Fatalf("got %+v, want an error response", resp)
+			}
+			if resp.Error.Code != policy.DeniedCode || !strings.Contains(resp.Error.Message, tt.wantError) {
+				t.Errorf("got error %d %q, want %d containing %q", resp.Error.Code, resp.Error.Message, policy.DeniedCode, tt.wantError)
+			}
+			if string(resp.ID) != "7" {
+				t.Errorf("response ID %s, want 7", resp.ID)
+			}
+		})
+	}
+}
+
+func TestDecideOneAtATime(t *testing.T) {
+	var asking, most int32
+	ask := func(context.Context, policy.Confirmation) (bool, error) {
+		n := atomic.AddInt32(&asking, 1)
+		defer atomic.AddInt32(&asking, -1)
+		for {
+			m := atomic.LoadInt32(&most)
+			if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return true, nil
+	}
+	c := newConfirmer(t, ask, time.Second)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if resp := c.Decide(toolCall(string(rune('0'+i)), "delete_issue", "{}")); resp != nil {
+				t.Errorf("call %d: got %+v, want it confirmed", i, resp.Error)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&most); n != 1 {
+		t.Errorf("%d confirmations asked at once, want 1", n)
+	}
+}
+
+func TestDecideTimesOutWaitingForTurn(t *testing.T) {
+	release := make(chan struct{})
+	ask := func(ctx context.Context, _ policy.Confirmation) (bool, error) {
+		select {
+		case <-release:
+			return true, nil
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+	c := newConfirmer(t, ask, 50*time.Millisecond)
+
+	first := make(chan *proxy.Message)
+	go func() { first <- c.Decide(toolCall("1", "delete_issue", "{}")) }()
+	time.Sleep(10 * time.Millisecond)
+
+	// The second call waits for the first confirmation and times out
+	resp := c.Decide(toolCall("2", "update_issue", "{}"))
+	if resp == nil || resp.Error == nil || !strings.Contains(resp.Error.Message, "was not confirmed within") {
+		t.Errorf("got %+v, want a timeout", resp)
+	}
+
+	close(release)
+	<-first
+}
@@ -0,0 +1,58 @@
+package policy
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/lvrach/smp/internal/proxy"
+	"github.com/lvrach/smp/internal/state"
+)
+
+// ToolFilter is an interceptor enforcing an MCP's tool policy: disallowed tools
+// are removed from tools/list results and calls to them are rejected
+type ToolFilter struct {
+	name   string
+	policy *state.ToolPolicy
+	log    io.Writer
+}
+
+// NewToolFilter creates a filter enforcing the tool policy of an MCP, nil if the
+// MCP has none
+func NewToolFilter(mcpState *state.MCPServer, log io.Writer) *ToolFilter {
+	if mcpState.Tools == nil {
+		return nil
+	}
+	return &ToolFilter{name: mcpState.Name, policy: mcpState.Tools, log: log}
+}
+
+// HostMessage rejects calls to disallowed tools with an invalid params error, as
+// MCP servers answer calls to unknown tools
+func (f *ToolFilter) HostMessage(msg *proxy.Message) *proxy.Message {
+	if msg.Method != "tools/call" || !msg.IsRequest() {
+		return nil
+	}
+
+	tool := msg.StringParam("name")
+	if f.policy.Allowed(tool) {
+		return nil
+	}
+
+	fmt.Fprintf(f.log, "smp: %s: rejected call to tool %s, not allowed by policy\n", f.name, tool)
+	return proxy.ErrorResponse(msg, proxy.CodeInvalidParams, fmt.Sprintf("tool %s is not allowed by the smp policy of %s", tool, f.name))
+}
+
+// ServerMessage removes disallowed tools from tools/list results
+func (f *ToolFilter) ServerMessage(msg *proxy.Message, call *proxy.Call) {
+	if call == nil || call.Request.Method != "tools/list" || len(msg.Result) == 0 {
+		return
+	}
+
+	filtered, err := proxy.FilterItems(msg.Result, "tools", "name", f.policy.Allowed)
+	if err != nil {
+		fmt.Fprintf(f.log, "smp: %s: failed to filter tools/list result: %v\n", f.name, err)
+		msg.Result = nil
+		msg.Error = &proxy.Error{Code: proxy.CodeInternalError, Message: fmt.Sprintf("tools/list result of %s could not be filtered", f.name)}
+		return
+	}
+	msg.Result = filtered
+}
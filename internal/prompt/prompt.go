@@ -10,71 +10,323 @@ import (
 	"github.com/lvrach/smp/keystore"
 )
 
+// skipOption is offered for optional enum variables to leave them unset
+const skipOption = "(skip)"
+
 // PromptEnvironmentVariables prompts the user for environment variable values
 func PromptEnvironmentVariables(mcpConfig *config.MCPConfig, mcpState *state.MCPServer) error {
 	// TODO decouple this from the mcpConfig and mcpState
 
-	// Ask about keychain storage on macOS if there are any secrets
-	var useKeychain bool
-	hasSecrets := false
-	for _, envVar := range mcpConfig.EnvironmentVars {
-		if envVar.Type == "secret" {
-			hasSecrets = true
-			break
+	if err := promptSecretStore(mcpConfig, mcpState); err != nil {
+		return err
+	}
+
+	// Ask which features to enable before the variables that depend on them,
+	// suggesting those whose variables an earlier install configured
+	if len(mcpConfig.Groups) > 0 && len(mcpState.Features) == 0 {
+		features, err := promptFeatures(mcpConfig, nil, mcpState.GetEnvironmentVariable)
+		if err != nil {
+			return err
 		}
+		mcpState.Features = features
 	}
 
-	if runtime.GOOS == "darwin" && hasSecrets {
-		prompt := &survey.Confirm{
-			Message: "Do you want to store secrets in the macOS keychain?",
-			Default: true,
+	for _, envVar := range mcpConfig.EnvironmentVars {
+		// Skip if already set
+		if mcpState.HasEnvironmentVariable(envVar.Name) {
+			continue
+		}
+
+		// Skip variables whose condition does not hold, evaluated against the
+		// answers given so far
+		if !envVar.Active(mcpState.Features, mcpState.GetEnvironmentVariable) {
+			continue
 		}
-		if err := survey.AskOne(prompt, &useKeychain); err != nil {
-			return fmt.Errorf("failed to get keychain preference: %w", err)
+
+		value, err := promptVariable(envVar, envVar.Default, false)
+		if err != nil {
+			return fmt.Errorf("failed to get value for %s: %w", envVar.Name, err)
+		}
+
+		// Optional variables left empty are not stored
+		if value == "" {
+			continue
+		}
+
+		if err := StoreVariable(mcpConfig, mcpState, envVar, value); err != nil {
+			return err
 		}
 	}
 
+	return nil
+}
+
+// ConfigureEnvironmentVariables prompts again for the named variables, or for the
+// features and all active variables if no names are given. Current non-secret values
+// are offered as defaults and secrets left empty keep their current value.
+func ConfigureEnvironmentVariables(mcpConfig *config.MCPConfig, mcpState *state.MCPServer, names []string) error {
+	if err := promptSecretStore(mcpConfig, mcpState); err != nil {
+		return err
+	}
+
+	if len(names) == 0 && len(mcpConfig.Groups) > 0 {
+		features, err := promptFeatures(mcpConfig, mcpState.Features, mcpState.GetEnvironmentVariable)
+		if err != nil {
+			return err
+		}
+		mcpState.Features = features
+	}
+
 	for _, envVar := range mcpConfig.EnvironmentVars {
-		// Skip if already set
-		if _, exists := mcpState.GetEnvironmentVariable(envVar.Name); exists {
+		if len(names) > 0 && !contains(names, envVar.Name) {
+			continue
+		}
+		if len(names) == 0 && !envVar.Active(mcpState.Features, mcpState.GetEnvironmentVariable) {
+			continue
+		}
+
+		current := envVar.Default
+		if value, exists := mcpState.GetEnvironmentVariable(envVar.Name); exists && !envVar.IsSecret() {
+			current = value
+		}
+		keepSecret := envVar.IsSecret() && mcpState.HasEnvironmentVariable(envVar.Name)
+
+		value, err := promptVariable(envVar, current, keepSecret)
+		if err != nil {
+			return fmt.Errorf("failed to get value for %s: %w", envVar.Name, err)
+		}
+
+		if value == "" {
 			continue
 		}
 
-		var value string
-		var prompt survey.Prompt
+		if err := StoreVariable(mcpConfig, mcpState, envVar, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// promptSecretStore asks about keychain storage on macOS if there are any secrets
+// and no secret store has been chosen for the MCP yet
+func promptSecretStore(mcpConfig *config.MCPConfig, mcpState *state.MCPServer) error {
+	if mcpState.SecretStore != "" || len(mcpState.KeyChainEnvVars) > 0 {
+		return nil
+	}
+
+	hasSecrets := false
+	for _, envVar := range mcpConfig.EnvironmentVars {
+		if envVar.IsSecret() {
+			hasSecrets = true
+			break
+		}
+	}
+	if !hasSecrets {
+		return nil
+	}
+
+	mcpState.SecretStore = state.SecretStoreState
+	if runtime.GOOS != "darwin" {
+		return nil
+	}
+
+	var useKeychain bool
+	prompt := &survey.Confirm{
+		Message: "Do you want to store secrets in the macOS keychain?",
+		Default: true,
+	}
+	if err := survey.AskOne(prompt, &useKeychain); err != nil {
+		return fmt.Errorf("failed to get keychain preference: %w", err)
+	}
+	if useKeychain {
+		mcpState.SecretStore = state.SecretStoreKeychain
+	}
 
-		// Create appropriate prompt based on variable type
-		switch envVar.Type {
-		case "secret":
-			prompt = &survey.Password{
-				Message: fmt.Sprintf("Enter %s (%s):", envVar.Name, envVar.Description),
+	return nil
+}
+
+// StoreVariable saves a value in the state, routing secrets to the keychain when
+// it is the MCP's secret store
+func StoreVariable(mcpConfig *config.MCPConfig, mcpState *state.MCPServer, envVar config.EnvironmentVariable, value string) error {
+	if !envVar.IsSecret() || !mcpState.UsesKeychain() {
+		mcpState.SetEnvironmentVariable(envVar.Name, value)
+		return nil
+	}
+
+	kc := keystore.KeyChain{}
+	accountKey := mcpConfig.Name + "_" + envVar.Name
+	if err := kc.Store(keystore.AccountType(accountKey), value); err != nil {
+		return fmt.Errorf("failed to store %s in keychain: %w", envVar.Name, err)
+	}
+
+	if mcpState.KeyChainEnvVars == nil {
+		mcpState.KeyChainEnvVars = make(map[string]string)
+	}
+	mcpState.KeyChainEnvVars[accountKey] = envVar.Name
+	delete(mcpState.EnvironmentVariables, envVar.Name)
+
+	return nil
+}
+
+// promptFeatures asks which features of each variable group to enable. A group's
+// current features are the defaults, or if it has none, such as a group the
+// definition added since, those its configured variables suggest.
+func promptFeatures(mcpConfig *config.MCPConfig, current []string, lookup func(name string) (string, bool)) ([]string, error) {
+	suggested := mcpConfig.EnabledFeatures(nil, lookup)
+
+	var features []string
+	for _, group := range mcpConfig.Groups {
+		defaults := groupDefaults(group, current)
+		if len(defaults) == 0 {
+			defaults = groupDefaults(group, suggested)
+		}
+
+		if len(group.OneOf) > 0 {
+			var selected string
+			prompt := &survey.Select{
+				Message: fmt.Sprintf("Select %s (%s):", group.Name, group.Description),
+				Options: group.OneOf,
+			}
+			if len(defaults) > 0 {
+				prompt.Default = defaults[0]
 			}
-		default:
-			prompt = &survey.Input{
-				Message: fmt.Sprintf("Enter %s (%s):", envVar.Name, envVar.Description),
+			if err := survey.AskOne(prompt, &selected); err != nil {
+				return nil, fmt.Errorf("failed to get selection for %s: %w", group.Name, err)
 			}
+			features = append(features, selected)
+			continue
 		}
 
-		// Show the prompt
-		if err := survey.AskOne(prompt, &value, survey.WithValidator(survey.Required)); err != nil {
-			return fmt.Errorf("failed to get value for %s: %w", envVar.Name, err)
+		var selected []string
+		prompt := &survey.MultiSelect{
+			Message: fmt.Sprintf("Select %s (%s):", group.Name, group.Description),
+			Options: group.AnyOf,
+			Default: defaults,
 		}
+		if err := survey.AskOne(prompt, &selected, survey.WithValidator(survey.MinItems(1))); err != nil {
+			return nil, fmt.Errorf("failed to get selection for %s: %w", group.Name, err)
+		}
+		features = append(features, selected...)
+	}
 
-		if envVar.Type == "secret" && useKeychain {
-			kc := keystore.KeyChain{}
-			accountKey := mcpConfig.Name + "_" + envVar.Name
-			kc.Store(keystore.AccountType(accountKey), value)
+	return features, nil
+}
 
-			if mcpState.KeyChainEnvVars == nil {
-				mcpState.KeyChainEnvVars = make(map[string]string)
+// groupDefaults returns the features of a group that are among features
+func groupDefaults(group config.VariableGroup, features []string) []string {
+	var defaults []string
+	for _, feature := range group.Features() {
+		if contains(features, feature) {
+			defaults = append(defaults, feature)
+		}
+	}
+	return defaults
+}
+
+// promptVariable asks for a single environment variable value using a prompt
+// suited to its type, offering defaultValue as the default answer. Optional
+// variables, and secrets that keepSecret, may be skipped with an empty answer.
+func promptVariable(envVar config.EnvironmentVariable, defaultValue string, keepSecret bool) (string, error) {
+	message := fmt.Sprintf("Enter %s (%s):", envVar.Name, envVar.Description)
+	switch {
+	case keepSecret:
+		message = fmt.Sprintf("Enter %s (%s, leave empty to keep current):", envVar.Name, envVar.Description)
+	case !envVar.Required:
+		message = fmt.Sprintf("Enter %s (%s, optional):", envVar.Name, envVar.Description)
+	}
+
+	help := ""
+	if envVar.Example != "" {
+		help = fmt.Sprintf("Example: %s", envVar.Example)
+	}
+
+	var value string
+	var prompt survey.Prompt
+
+	// Create appropriate prompt based on variable type
+	switch envVar.Type {
+	case config.TypeSecret:
+		prompt = &survey.Password{
+			Message: message,
+			Help:    help,
+		}
+	case config.TypeEnum:
+		options := envVar.Enum
+		if !envVar.Required {
+			options = append([]string{skipOption}, options...)
+		}
+		selectPrompt := &survey.Select{
+			Message: message,
+			Options: options,
+			Help:    help,
+		}
+		if contains(options, defaultValue) {
+			selectPrompt.Default = defaultValue
+		}
+		if err := survey.AskOne(selectPrompt, &value); err != nil {
+			return "", err
+		}
+		if value == skipOption {
+			return "", nil
+		}
+		return value, nil
+	default:
+		prompt = &survey.Input{
+			Message: message,
+			Default: defaultValue,
+			Help:    help,
+		}
+	}
+
+	if err := survey.AskOne(prompt, &value, survey.WithValidator(validator(envVar, keepSecret))); err != nil {
+		return "", err
+	}
+
+	return value, nil
+}
+
+// validator returns a survey validator enforcing the variable's type and requiredness
+func validator(envVar config.EnvironmentVariable, allowEmpty bool) survey.Validator {
+	return func(ans interface{}) error {
+		value, _ := ans.(string)
+		if value == "" {
+			if envVar.Required && !allowEmpty {
+				return fmt.Errorf("%s is required", envVar.Name)
 			}
-			mcpState.KeyChainEnvVars[accountKey] = envVar.Name
-		} else {
-			mcpState.SetEnvironmentVariable(envVar.Name, value)
+			return nil
 		}
+		return envVar.Validate(value)
 	}
+}
 
-	return nil
+// Confirm asks the user a yes/no question
+func Confirm(message string, defaultValue bool) (bool, error) {
+	var confirmed bool
+	prompt := &survey.Confirm{
+		Message: message,
+		Default: defaultValue,
+	}
+
+	if err := survey.AskOne(prompt, &confirmed); err != nil {
+		return false, fmt.Errorf("failed to get confirmation: %w", err)
+	}
+
+	return confirmed, nil
+}
+
+// Password asks the user for a secret without echoing it
+func Password(message string) (string, error) {
+	var value string
+	prompt := &survey.Password{
+		Message: message,
+	}
+
+	if err := survey.AskOne(prompt, &value); err != nil {
+		return "", fmt.Errorf("failed to get input: %w", err)
+	}
+
+	return value, nil
 }
 
 // MultiSelect prompts the user to select multiple options from a list
@@ -106,3 +358,12 @@ func MultiSelect(message string, options []string, defaultSelections map[string]
 
 	return selected, nil
 }
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// fields are the members of a JSON-RPC message
+var fields = []string{"jsonrpc", "id", "method", "params", "result", "error"}
+
+// errNotJSON is returned for lines that aren't JSON at all
+var errNotJSON = errors.New("not JSON")
+
+// decode decodes a line holding a message or a batch of messages. Elements of
+// the line that aren't valid JSON-RPC messages are answered by error responses
+// in rejected. err is set if the line as a whole isn't JSON-RPC, errNotJSON if
+// it isn't JSON at all.
+//
+// Messages are decoded strictly, so that what the interceptors check is what a
+// peer decodes: duplicate members, which parsers resolve differently, and
+// members that differ from a JSON-RPC member only in case, which Go but not
+// other parsers would take for it, are rejected.
+func decode(line []byte) (messages, rejected []*Message, batch bool, err error) {
+	trimmed := bytes.TrimSpace(line)
+	if !json.Valid(trimmed) {
+		return nil, nil, false, errNotJSON
+	}
+
+	if trimmed[0] != '[' {
+		msg, err := decodeMessage(trimmed)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		return []*Message{msg}, nil, false, nil
+	}
+
+	var elements []json.RawMessage
+	if err := json.Unmarshal(trimmed, &elements); err != nil {
+		return nil, nil, true, err
+	}
+	if len(elements) == 0 {
+		return nil, nil, true, errors.New("empty batch")
+	}
+	for _, element := range elements {
+		msg, err := decodeMessage(element)
+		if err != nil {
+			rejected = append(rejected, invalidResponse(element, err))
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rejected, true, nil
+}
+
+// decodeMessage strictly decodes a single JSON-RPC message
+func decodeMessage(data []byte) (*Message, error) {
+	if err := checkMembers(data); err != nil {
+		return nil, err
+	}
+
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+	if msg.JSONRPC != "2.0" {
+		return nil, errors.New(`jsonrpc must be "2.0"`)
+	}
+	if msg.Method == "" && !msg.IsResponse() {
+		return nil, errors.New("neither a request nor a response")
+	}
+	return &msg, nil
+}
+
+// checkMembers rejects objects with duplicate members anywhere in a message,
+// ignoring case, and members of the message that only match a JSON-RPC member
+// ignoring case
+func checkMembers(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	// Keys of the objects being read, and whether a key is expected next
+	type object struct {
+		keys map[string]bool
+	}
+	var stack []*object
+	expectKey := false
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case json.Delim:
+			switch t {
+			case '{':
+				stack = append(stack, &object{keys: make(map[string]bool)})
+				expectKey = true
+				continue
+			case '[':
+				stack = append(stack, nil)
+			case '}', ']':
+				stack = stack[:len(stack)-1]
+			}
+		case string:
+			if expectKey {
+				// Go matches struct fields ignoring case, so members differing in
+				// case only are duplicates too. Upper casing first folds letters
+				// like the long s, which Go matches to s.
+				folded := strings.ToLower(strings.ToUpper(t))
+				top := stack[len(stack)-1]
+				if top.keys[folded] {
+					return fmt.Errorf("duplicate member %q", t)
+				}
+				top.keys[folded] = true
+				if len(stack) == 1 {
+					for _, field := range fields {
+						if t != field && strings.EqualFold(t, field) {
+							return fmt.Errorf("member %q is not %q", t, field)
+						}
+					}
+				}
+				expectKey = false
+				continue
+			}
+		}
+
+		// After a value inside an object, the next token is a key
+		expectKey = len(stack) > 0 && stack[len(stack)-1] != nil
+	}
+}
+
+// invalidResponse returns the error response to an invalid message, with its ID
+// if it has a readable one
+func invalidResponse(data []byte, err error) *Message {
+	var withID struct {
+		ID json.RawMessage `json:"id"`
+	}
+	id := json.RawMessage("null")
+	if json.Unmarshal(data, &withID) == nil && len(withID.ID) > 0 {
+		id = withID.ID
+	}
+	return &Message{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error:   &Error{Code: CodeInvalidRequest, Message: "Invalid Request: " + err.Error()},
+	}
+}
@@ -0,0 +1,70 @@
+package proxy_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/lvrach/smp/internal/proxy"
+)
+
+// TestMain runs the test binary as a fake MCP server when SMP_FAKE_MCP is set,
+// so the proxy is tested against a real process over real pipes
+func TestMain(m *testing.M) {
+	if os.Getenv("SMP_FAKE_MCP") != "" {
+		if err := serveFake(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// serveFake is an MCP answering tools/list and tools/call on stdio. It appends
+// the lines it receives to SMP_FAKE_MCP_RECEIVED and prints SMP_FAKE_MCP_STDOUT
+// before every answer, if set.
+func serveFake() error {
+	received, err := os.OpenFile(os.Getenv("SMP_FAKE_MCP_RECEIVED"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer received.Close()
+	stdout := os.Getenv("SMP_FAKE_MCP_STDOUT")
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fmt.Fprintln(received, line)
+
+		var messages []proxy.Message
+		if strings.HasPrefix(line, "[") {
+			json.Unmarshal([]byte(line), &messages)
+		} else {
+			var msg proxy.Message
+			json.Unmarshal([]byte(line), &msg)
+			messages = append(messages, msg)
+		}
+
+		for _, msg := range messages {
+			if !msg.IsRequest() {
+				continue
+			}
+			result := `{}`
+			switch msg.Method {
+			case "tools/list":
+				result = `{"tools":[{"name":"get_issue"},{"name":"delete_issue"}]}`
+			case "tools/call":
+				result = `{"content":[{"type":"text","text":"called ` + msg.StringParam("name") + `"}]}`
+			}
+			if stdout != "" {
+				fmt.Println(stdout)
+			}
+			fmt.Printf(`{"jsonrpc":"2.0","id":%s,"result":%s}`+"\n", msg.ID, result)
+		}
+	}
+	return scanner.Err()
+}
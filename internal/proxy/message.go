@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Standard JSON-RPC 2.0 error codes
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Message is a JSON-RPC 2.0 request, notification or response
+type Message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is the error of a JSON-RPC response
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// Call is a request of the host and the time it was forwarded, paired with its
+// response
+type Call struct {
+	Request *Message
+	Start   time.Time
+}
+
+// IsRequest reports whether the message is a request expecting a response
+func (m *Message) IsRequest() bool {
+	return m.Method != "" && len(m.ID) > 0
+}
+
+// IsNotification reports whether the message is a notification, a request
+// without response
+func (m *Message) IsNotification() bool {
+	return m.Method != "" && len(m.ID) == 0
+}
+
+// IsResponse reports whether the message is a response to a request
+func (m *Message) IsResponse() bool {
+	return m.Method == "" && len(m.ID) > 0
+}
+
+// ErrorResponse returns an error response to a request
+func ErrorResponse(request *Message, code int, message string) *Message {
+	return &Message{
+		JSONRPC: "2.0",
+		ID:      request.ID,
+		Error:   &Error{Code: code, Message: message},
+	}
+}
+
+// StringParam returns a string parameter of a request, empty if it has none
+func (m *Message) StringParam(name string) string {
+	var params map[string]json.RawMessage
+	if json.Unmarshal(m.Params, &params) != nil {
+		return ""
+	}
+	var value string
+	json.Unmarshal(params[name], &value)
+	return value
+}
+
+// FilterItems removes items from a list in a result, e.g. the tools of a
+// tools/list result. field names the list and key the string field identifying
+// an item, items for which keep returns false are removed.
+func FilterItems(result json.RawMessage, field, key string, keep func(string) bool) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(result, &fields); err != nil {
+		return nil, err
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(fields[field], &items); err != nil {
+		return nil, err
+	}
+
+	kept := []json.RawMessage{}
+	for _, item := range items {
+		var keyed map[string]json.RawMessage
+		if err := json.Unmarshal(item, &keyed); err != nil {
+			return nil, err
+		}
+		var id string
+		json.Unmarshal(keyed[key], &id)
+		if keep(id) {
+			kept = append(kept, item)
+		}
+	}
+	if len(kept) == len(items) {
+		return result, nil
+	}
+
+	data, err := json.Marshal(kept)
+	if err != nil {
+		return nil, err
+	}
+	fields[field] = data
+	return json.Marshal(fields)
+}
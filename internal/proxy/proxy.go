@@ -0,0 +1,314 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Interceptor observes and changes the messages between a host and an MCP. The
+// proxy calls the HostMessage, ServerMessage and Hold methods of its interceptors
+// one at a time, so interceptors need no locking for state only they touch.
+type Interceptor interface {
+	// HostMessage is called with each message from the host. It may change the
+	// message, or return a response to answer the host with instead of
+	// forwarding the message to the MCP.
+	HostMessage(msg *Message) *Message
+
+	// ServerMessage is called with each message to the host, from the MCP or
+	// answered by an interceptor, and may change it. call is the request a
+	// response answers, nil for other messages.
+	ServerMessage(msg *Message, call *Call)
+}
+
+// Gate is implemented by interceptors that hold some messages from the host
+// until they decide about them, e.g. by asking the user, without stalling the
+// other messages of the session
+type Gate interface {
+	// Hold reports whether a message from the host, passed by every interceptor,
+	// must wait for Decide
+	Hold(msg *Message) bool
+
+	// Decide is called in its own goroutine with a held message, concurrently
+	// with the other methods of the interceptors. It returns a response to answer
+	// the host with, or nil to forward the message to the MCP.
+	Decide(msg *Message) *Message
+}
+
+// Proxy relays newline-delimited JSON-RPC messages between a host and an MCP
+// over stdio, passing each through its interceptors. Every message is decoded
+// strictly and forwarded as re-encoded after the interceptors, so the peer sees
+// exactly what they checked. Host lines that aren't valid JSON-RPC are answered
+// with an error instead of being forwarded.
+type Proxy struct {
+	Interceptors []Interceptor
+
+	// Errors reports messages that could not be handled
+	Errors io.Writer
+
+	mu    sync.Mutex
+	out   io.Writer
+	calls map[string]*Call
+
+	inMu sync.Mutex
+	held sync.WaitGroup
+
+	// interceptMu serializes calls to the interceptors
+	interceptMu sync.Mutex
+}
+
+// New creates a proxy passing messages through the interceptors in order
+func New(log io.Writer, interceptors ...Interceptor) *Proxy {
+	return &Proxy{
+		Interceptors: interceptors,
+		Errors:       log,
+	}
+}
+
+// Run relays messages from hostIn to serverIn and from serverOut to hostOut
+// until the MCP closes its output. serverIn is closed when hostIn ends and the
+// held messages are decided.
+func (p *Proxy) Run(hostIn io.Reader, hostOut io.Writer, serverIn io.WriteCloser, serverOut io.Reader) error {
+	p.out = hostOut
+	p.calls = make(map[string]*Call)
+
+	go func() {
+		defer serverIn.Close()
+		defer p.held.Wait()
+		r := bufio.NewReader(hostIn)
+		for {
+			line, err := r.ReadBytes('\n')
+			if len(line) > 0 {
+				if werr := p.fromHost(line, serverIn); werr != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	r := bufio.NewReader(serverOut)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			if werr := p.fromServer(line); werr != nil {
+				return fmt.Errorf("writing to host: %w", werr)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading from MCP: %w", err)
+		}
+	}
+}
+
+// fromHost passes a line from the host through the interceptors and forwards it
+func (p *Proxy) fromHost(line []byte, serverIn io.Writer) error {
+	if len(bytes.TrimSpace(line)) == 0 {
+		return nil
+	}
+
+	messages, rejected, batch, err := decode(line)
+	switch {
+	case errors.Is(err, errNotJSON):
+		p.toHost([]*Message{invalid(CodeParseError, "Parse error")}, false)
+		return nil
+	case err != nil:
+		p.toHost([]*Message{invalid(CodeInvalidRequest, "Invalid Request: "+err.Error())}, false)
+		return nil
+	}
+	for _, reply := range rejected {
+		p.toHost([]*Message{reply}, false)
+	}
+
+	var forward []*Message
+	for _, msg := range messages {
+		if reply := p.hostMessage(msg); reply != nil {
+			p.toHost([]*Message{reply}, false)
+			continue
+		}
+		if gate := p.gate(msg); gate != nil {
+			p.hold(gate, msg, serverIn)
+			continue
+		}
+		forward = append(forward, msg)
+	}
+
+	if len(forward) == 0 {
+		return nil
+	}
+	data, err := encode(forward, batch)
+	if err != nil {
+		fmt.Fprintf(p.Errors, "smp: failed to encode message: %v\n", err)
+		return nil
+	}
+	return p.forward(forward, serverIn, data)
+}
+
+// forward records the requests among messages and writes them to the MCP
+func (p *Proxy) forward(messages []*Message, serverIn io.Writer, data []byte) error {
+	p.mu.Lock()
+	for _, msg := range messages {
+		if msg.IsRequest() {
+			p.calls[string(msg.ID)] = &Call{Request: msg, Start: time.Now()}
+		}
+	}
+	p.mu.Unlock()
+
+	p.inMu.Lock()
+	defer p.inMu.Unlock()
+	_, err := serverIn.Write(data)
+	return err
+}
+
+// gate returns the first interceptor holding a message, nil if none does
+func (p *Proxy) gate(msg *Message) Gate {
+	p.interceptMu.Lock()
+	defer p.interceptMu.Unlock()
+
+	for _, interceptor := range p.Interceptors {
+		if gate, ok := interceptor.(Gate); ok && gate.Hold(msg) {
+			return gate
+		}
+	}
+	return nil
+}
+
+// hold waits for a gate's decision about a message in the background, then
+// answers the host or forwards the message
+func (p *Proxy) hold(gate Gate, msg *Message, serverIn io.Writer) {
+	p.held.Add(1)
+	go func() {
+		defer p.held.Done()
+
+		start := time.Now()
+		reply := gate.Decide(msg)
+		if reply == nil {
+			data, err := encode([]*Message{msg}, false)
+			if err != nil {
+				fmt.Fprintf(p.Errors, "smp: failed to encode message: %v\n", err)
+				return
+			}
+			p.forward([]*Message{msg}, serverIn, data)
+			return
+		}
+
+		if reply.JSONRPC == "" {
+			reply.JSONRPC = "2.0"
+		}
+		if msg.IsRequest() {
+			p.mu.Lock()
+			p.calls[string(msg.ID)] = &Call{Request: msg, Start: start}
+			p.mu.Unlock()
+		}
+		p.toHost([]*Message{reply}, false)
+	}()
+}
+
+// hostMessage passes a message from the host through the interceptors, stopping
+// at the first that answers it. The answer is a response to the request.
+func (p *Proxy) hostMessage(msg *Message) *Message {
+	p.interceptMu.Lock()
+	defer p.interceptMu.Unlock()
+
+	for _, interceptor := range p.Interceptors {
+		if reply := interceptor.HostMessage(msg); reply != nil {
+			if reply.JSONRPC == "" {
+				reply.JSONRPC = "2.0"
+			}
+			if msg.IsRequest() {
+				p.mu.Lock()
+				p.calls[string(msg.ID)] = &Call{Request: msg, Start: time.Now()}
+				p.mu.Unlock()
+			}
+			return reply
+		}
+	}
+	return nil
+}
+
+// fromServer passes a line from the MCP through the interceptors and forwards
+// it. Invalid messages are dropped. Lines that aren't JSON at all, such as logs
+// of MCPs that print to stdout, are dropped too and reported on the error log,
+// which callers can redact, as they bypass the interceptors.
+func (p *Proxy) fromServer(line []byte) error {
+	if len(bytes.TrimSpace(line)) == 0 {
+		return nil
+	}
+
+	messages, rejected, batch, err := decode(line)
+	if errors.Is(err, errNotJSON) {
+		fmt.Fprintf(p.Errors, "smp: MCP wrote to stdout: %s\n", bytes.TrimRight(line, "\r\n"))
+		return nil
+	}
+	if err != nil {
+		fmt.Fprintf(p.Errors, "smp: dropped invalid message from MCP: %v\n", err)
+		return nil
+	}
+	for _, reply := range rejected {
+		fmt.Fprintf(p.Errors, "smp: dropped invalid message from MCP: %s\n", reply.Error.Message)
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	return p.toHost(messages, batch)
+}
+
+// toHost passes messages to the host through the interceptors
+func (p *Proxy) toHost(messages []*Message, batch bool) error {
+	for _, msg := range messages {
+		var call *Call
+		if msg.IsResponse() {
+			p.mu.Lock()
+			call = p.calls[string(msg.ID)]
+			delete(p.calls, string(msg.ID))
+			p.mu.Unlock()
+		}
+
+		p.interceptMu.Lock()
+		for _, interceptor := range p.Interceptors {
+			interceptor.ServerMessage(msg, call)
+		}
+		p.interceptMu.Unlock()
+	}
+
+	data, err := encode(messages, batch)
+	if err != nil {
+		fmt.Fprintf(p.Errors, "smp: failed to encode message: %v\n", err)
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err = p.out.Write(data)
+	return err
+}
+
+// invalid returns the error response to a line that couldn't be read
+func invalid(code int, message string) *Message {
+	return &Message{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &Error{Code: code, Message: message}}
+}
+
+// encode writes messages as a line, as a batch if they came in one
+func encode(messages []*Message, batch bool) ([]byte, error) {
+	var data []byte
+	var err error
+	if batch {
+		data, err = json.Marshal(messages)
+	} else {
+		data, err = json.Marshal(messages[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
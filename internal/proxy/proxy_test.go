@@ -0,0 +1,289 @@
+package proxy_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lvrach/smp/internal/policy"
+	"github.com/lvrach/smp/internal/proxy"
+	"github.com/lvrach/smp/internal/state"
+)
+
+// session runs host lines through a proxy to a fake server and returns the
+// messages the host received and the lines the server received
+func session(t *testing.T, interceptors []proxy.Interceptor, lines ...string) ([]proxy.Message, []string) {
+	t.Helper()
+	return sessionWith(t, "", io.Discard, interceptors, lines...)
+}
+
+// sessionWith runs a session with a fake server printing stdout before every
+// answer, logging to log
+func sessionWith(t *testing.T, stdout string, log io.Writer, interceptors []proxy.Interceptor, lines ...string) ([]proxy.Message, []string) {
+	t.Helper()
+
+	receivedFile := filepath.Join(t.TempDir(), "received")
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), "SMP_FAKE_MCP=1", "SMP_FAKE_MCP_RECEIVED="+receivedFile, "SMP_FAKE_MCP_STDOUT="+stdout)
+	cmd.Stderr = os.Stderr
+	serverIn, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverOut, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("starting fake server: %v", err)
+	}
+
+	var hostOut bytes.Buffer
+	p := proxy.New(log, interceptors...)
+	if err := p.Run(strings.NewReader(strings.Join(lines, "\n")+"\n"), &hostOut, serverIn, serverOut); err != nil {
+		t.Fatalf("proxy failed: %v", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("fake server failed: %v", err)
+	}
+
+	var received []proxy.Message
+	for _, line := range strings.Split(strings.TrimSpace(hostOut.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var msg proxy.Message
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatalf("host received invalid line %q: %v", line, err)
+		}
+		received = append(received, msg)
+	}
+
+	data, err := os.ReadFile(receivedFile)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	var serverReceived []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line != "" {
+			serverReceived = append(serverReceived, line)
+		}
+	}
+	return received, serverReceived
+}
+
+func denyFilter() []proxy.Interceptor {
+	mcpState := &state.MCPServer{Name: "fake", Tools: &state.ToolPolicy{Deny: []string{"delete_*"}}}
+	return []proxy.Interceptor{policy.NewToolFilter(mcpState, io.Discard)}
+}
+
+func byID(messages []proxy.Message, id string) *proxy.Message {
+	for i := range messages {
+		if string(messages[i].ID) == id {
+			return &messages[i]
+		}
+	}
+	return nil
+}
+
+func TestProxyRelaysMessages(t *testing.T) {
+	host, server := session(t, nil,
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"get_issue"}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+	)
+
+	if len(server) != 2 {
+		t.Fatalf("server received %d lines, want 2: %q", len(server), server)
+	}
+	reply := byID(host, "1")
+	if reply == nil || !strings.Contains(string(reply.Result), "called get_issue") {
+		t.Fatalf("unexpected reply %+v", host)
+	}
+}
+
+func TestProxyFiltersDeniedTools(t *testing.T) {
+	host, server := session(t, denyFilter(),
+		`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"delete_issue"}}`,
+	)
+
+	if list := byID(host, "1"); list == nil || strings.Contains(string(list.Result), "delete_issue") {
+		t.Errorf("tools/list result not filtered: %+v", list)
+	}
+	if call := byID(host, "2"); call == nil || call.Error == nil || call.Error.Code != proxy.CodeInvalidParams {
+		t.Errorf("denied call not rejected: %+v", call)
+	}
+	for _, line := range server {
+		if strings.Contains(line, "delete_issue") {
+			t.Errorf("server received denied call %q", line)
+		}
+	}
+}
+
+func TestProxyRejectsAmbiguousMessages(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		code int
+	}{
+		{
+			name: "member differing in case",
+			line: `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"delete_issue"},"Method":"ping"}`,
+			code: proxy.CodeInvalidRequest,
+		},
+		{
+			name: "duplicate method",
+			line: `{"jsonrpc":"2.0","id":1,"method":"ping","method":"tools/call","params":{"name":"delete_issue"}}`,
+			code: proxy.CodeInvalidRequest,
+		},
+		{
+			name: "duplicate tool name",
+			line: `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"get_issue","name":"delete_issue"}}`,
+			code: proxy.CodeInvalidRequest,
+		},
+		{
+			name: "tool name differing in case",
+			line: `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"get_issue","Name":"delete_issue"}}`,
+			code: proxy.CodeInvalidRequest,
+		},
+		{
+			name: "not JSON",
+			line: `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"delete_issue"}`,
+			code: proxy.CodeParseError,
+		},
+		{
+			name: "not JSON-RPC",
+			line: `{"id":1,"method":"tools/call","params":{"name":"delete_issue"}}`,
+			code: proxy.CodeInvalidRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, server := session(t, denyFilter(), tt.line)
+
+			if len(server) != 0 {
+				t.Errorf("server received %q", server)
+			}
+			if len(host) != 1 || host[0].Error == nil || host[0].Error.Code != tt.code {
+				t.Errorf("host received %+v, want error %d", host, tt.code)
+			}
+		})
+	}
+}
+
+func TestProxyRejectsInvalidBatchElements(t *testing.T) {
+	host, server := session(t, denyFilter(),
+		`[{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"get_issue"}},`+
+			`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"delete_issue"},"METHOD":"ping"}]`,
+	)
+
+	if len(server) != 1 || strings.Contains(server[0], "delete_issue") {
+		t.Fatalf("server received %q, want only the valid call", server)
+	}
+	if reply := byID(host, "1"); reply == nil || reply.Error != nil {
+		t.Errorf("valid call not answered: %+v", host)
+	}
+	if reply := byID(host, "2"); reply == nil || reply.Error == nil || reply.Error.Code != proxy.CodeInvalidRequest {
+		t.Errorf("invalid element not rejected: %+v", host)
+	}
+}
+
+func TestProxyForwardsWhatWasChecked(t *testing.T) {
+	_, server := session(t, denyFilter(),
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"get_issue"},"extra":"dropped"}`,
+	)
+
+	if len(server) != 1 {
+		t.Fatalf("server received %q", server)
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(server[0]), &members); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := members["extra"]; ok {
+		t.Errorf("server received unchecked member: %s", server[0])
+	}
+}
+
+func TestProxyLogsServerStdout(t *testing.T) {
+	var log bytes.Buffer
+	host, _ := sessionWith(t, "connected with token s3cr3t", &log, nil,
+		`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+	)
+
+	if len(host) != 1 || byID(host, "1") == nil {
+		t.Errorf("host received %+v, want only the reply", host)
+	}
+	if !strings.Contains(log.String(), "connected with token s3cr3t") {
+		t.Errorf("stdout line not logged: %q", log.String())
+	}
+}
+
+// exclusive is an interceptor and gate failing the test when the proxy calls it
+// from several goroutines at once. It holds calls to the tool held and answers
+// them itself.
+type exclusive struct {
+	t       *testing.T
+	inside  int32
+	server  int
+	decided int32
+}
+
+// enter marks the interceptor busy for a moment, so concurrent calls overlap
+func (e *exclusive) enter() func() {
+	if !atomic.CompareAndSwapInt32(&e.inside, 0, 1) {
+		e.t.Errorf("interceptor called concurrently")
+	}
+	time.Sleep(100 * time.Microsecond)
+	return func() { atomic.StoreInt32(&e.inside, 0) }
+}
+
+func (e *exclusive) HostMessage(*proxy.Message) *proxy.Message {
+	defer e.enter()()
+	return nil
+}
+
+func (e *exclusive) ServerMessage(*proxy.Message, *proxy.Call) {
+	defer e.enter()()
+	e.server++
+}
+
+func (e *exclusive) Hold(msg *proxy.Message) bool {
+	defer e.enter()()
+	return msg.StringParam("name") == "held"
+}
+
+func (e *exclusive) Decide(msg *proxy.Message) *proxy.Message {
+	atomic.AddInt32(&e.decided, 1)
+	return proxy.ErrorResponse(msg, -32002, "denied")
+}
+
+func TestProxySerializesInterceptors(t *testing.T) {
+	var lines []string
+	for i := 0; i < 100; i++ {
+		tool := "get_issue"
+		if i%2 == 0 {
+			tool = "held"
+		}
+		lines = append(lines, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"name":%q}}`, i, tool))
+	}
+
+	e := &exclusive{t: t}
+	host, server := session(t, []proxy.Interceptor{e}, lines...)
+
+	if len(host) != 100 || len(server) != 50 {
+		t.Errorf("host received %d messages and server %d lines, want 100 and 50", len(host), len(server))
+	}
+	if e.server != 100 || e.decided != 50 {
+		t.Errorf("interceptor saw %d messages to the host and decided %d, want 100 and 50", e.server, e.decided)
+	}
+}
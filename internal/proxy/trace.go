@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Trace is an interceptor writing every message it sees to a file as JSON lines,
+// to debug the traffic between a host and an MCP
+type Trace struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// traceEntry is a line of a trace
+type traceEntry struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Message   *Message  `json:"message"`
+}
+
+// NewTrace creates a trace writing to w
+func NewTrace(w io.Writer) *Trace {
+	return &Trace{w: w}
+}
+
+// HostMessage records a message from the host
+func (t *Trace) HostMessage(msg *Message) *Message {
+	t.write("host", msg)
+	return nil
+}
+
+// ServerMessage records a message to the host
+func (t *Trace) ServerMessage(msg *Message, _ *Call) {
+	t.write("mcp", msg)
+}
+
+func (t *Trace) write(direction string, msg *Message) {
+	data, err := json.Marshal(traceEntry{Time: time.Now().UTC(), Direction: direction, Message: msg})
+	if err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.w.Write(append(data, '\n'))
+}
@@ -0,0 +1,37 @@
+package redact
+
+import "github.com/lvrach/smp/internal/proxy"
+
+// Interceptor masks secrets and tokens in the messages an MCP sends to the host.
+// It should come before the interceptors recording messages, so they only see
+// redacted messages.
+type Interceptor struct {
+	r *Redactor
+}
+
+// NewInterceptor creates an interceptor redacting with r
+func NewInterceptor(r *Redactor) *Interceptor {
+	return &Interceptor{r: r}
+}
+
+// HostMessage leaves messages from the host unchanged, the host needs no secrets
+// of the MCP to call it
+func (i *Interceptor) HostMessage(*proxy.Message) *proxy.Message {
+	return nil
+}
+
+// ServerMessage redacts the result, error and params of a message to the host
+func (i *Interceptor) ServerMessage(msg *proxy.Message, _ *proxy.Call) {
+	if result, ok := i.r.JSON(msg.Result); ok {
+		msg.Result = result
+	}
+	if params, ok := i.r.JSON(msg.Params); ok {
+		msg.Params = params
+	}
+	if msg.Error != nil {
+		msg.Error.Message = i.r.String(msg.Error.Message)
+		if data, ok := i.r.JSON(msg.Error.Data); ok {
+			msg.Error.Data = data
+		}
+	}
+}
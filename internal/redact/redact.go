@@ -0,0 +1,185 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Placeholder replaces every redacted value
+const Placeholder = "[REDACTED]"
+
+// minSecretLength is the length below which secret values aren't redacted, as
+// short values like "1" or "yes" would mask unrelated text
+const minSecretLength = 6
+
+// tokenOverlap is how much of the end of a stream is held back at least, so
+// tokens continuing past it are matched whole
+const tokenOverlap = 4096
+
+// patterns match common tokens, whichever MCP they belong to
+var patterns = []*regexp.Regexp{
+	// GitHub tokens
+	regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`),
+	// GitLab personal access tokens
+	regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}\b`),
+	// Slack tokens
+	regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`),
+	// AWS access key IDs
+	regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`),
+	// Google API keys
+	regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),
+	// Atlassian API tokens
+	regexp.MustCompile(`\bATATT[A-Za-z0-9_=-]{20,}\b`),
+	// OpenAI, Anthropic and Stripe style secret keys
+	regexp.MustCompile(`\b(sk|rk)[-_](live_|test_|proj-|ant-)?[A-Za-z0-9_-]{20,}\b`),
+	// JSON web tokens
+	regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`),
+	// Bearer tokens of authorization headers
+	regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/-]{16,}=*`),
+	// Private keys
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+}
+
+// Redactor masks the secret values of an MCP and common token patterns
+type Redactor struct {
+	secrets []string
+}
+
+// New creates a redactor of the given secret values and common tokens
+func New(secrets []string) *Redactor {
+	r := &Redactor{}
+	seen := make(map[string]bool)
+	for _, secret := range secrets {
+		secret = strings.TrimSpace(secret)
+		if len(secret) < minSecretLength || seen[secret] {
+			continue
+		}
+		seen[secret] = true
+		r.secrets = append(r.secrets, secret)
+	}
+
+	// Longer secrets first, so a secret containing another is masked whole
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+	return r
+}
+
+// String returns s with secrets and tokens replaced by the placeholder
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, Placeholder)
+	}
+	for _, pattern := range patterns {
+		s = pattern.ReplaceAllString(s, Placeholder)
+	}
+	return s
+}
+
+// JSON returns a JSON value with secrets and tokens in its strings replaced by
+// the placeholder, and whether anything was replaced. Values that aren't valid
+// JSON are returned unchanged.
+func (r *Redactor) JSON(data json.RawMessage) (json.RawMessage, bool) {
+	if r == nil || len(data) == 0 {
+		return data, false
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return data, false
+	}
+
+	value, changed := r.value(value)
+	if !changed {
+		return data, false
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return data, false
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), true
+}
+
+func (r *Redactor) value(value interface{}) (interface{}, bool) {
+	changed := false
+	switch v := value.(type) {
+	case string:
+		redacted := r.String(v)
+		return redacted, redacted != v
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		for _, key := range keys {
+			field := v[key]
+			if redacted, ok := r.value(field); ok {
+				field = redacted
+				v[key] = field
+				changed = true
+			}
+			if redactedKey := r.String(key); redactedKey != key {
+				delete(v, key)
+				v[redactedKey] = field
+				changed = true
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if redacted, ok := r.value(item); ok {
+				v[i] = redacted
+				changed = true
+			}
+		}
+	}
+	return value, changed
+}
+
+// cut returns the length of the start of a stream that can be redacted on its
+// own: the end is held back, and so are secrets and tokens running across it
+func (r *Redactor) cut(s string) int {
+	if r == nil {
+		return len(s)
+	}
+
+	overlap := tokenOverlap
+	if len(r.secrets) > 0 && len(r.secrets[0]) > overlap {
+		overlap = len(r.secrets[0])
+	}
+	cut := len(s) - overlap
+	if cut <= 0 {
+		return 0
+	}
+
+	for moved := true; moved; {
+		moved = false
+		for _, secret := range r.secrets {
+			start := cut - len(secret) + 1
+			if start < 0 {
+				start = 0
+			}
+			if i := strings.Index(s[start:], secret); i >= 0 && start+i < cut {
+				cut = start + i
+				moved = true
+			}
+		}
+		for _, pattern := range patterns {
+			for _, loc := range pattern.FindAllStringIndex(s, -1) {
+				if loc[0] < cut && loc[1] > cut {
+					cut = loc[0]
+					moved = true
+				}
+			}
+		}
+	}
+	return cut
+}
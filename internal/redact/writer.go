@@ -0,0 +1,76 @@
+package redact
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// maxLine is the length at which the start of a line without newline is
+// redacted and written anyway, so a stream without newlines isn't held back
+const maxLine = 64 * 1024
+
+// Writer redacts a stream line by line before writing it to another writer
+type Writer struct {
+	r *Redactor
+	w io.Writer
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+// NewWriter creates a writer redacting what it writes to w
+func NewWriter(r *Redactor, w io.Writer) *Writer {
+	return &Writer{r: r, w: w}
+}
+
+// Write redacts and writes every complete line, buffering the rest until its
+// newline arrives or Flush is called
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := w.buf[:i+1]
+		if _, err := io.WriteString(w.w, w.r.String(string(line))); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[i+1:]
+	}
+
+	if len(w.buf) < maxLine {
+		return len(p), nil
+	}
+
+	// Write the start of a long line, holding back its end in case a secret
+	// continues in the next write. A token that long is cut after all.
+	cut := w.r.cut(string(w.buf))
+	if cut == 0 && len(w.buf) >= 4*maxLine {
+		cut = len(w.buf)
+	}
+	if cut > 0 {
+		if _, err := io.WriteString(w.w, w.r.String(string(w.buf[:cut]))); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[cut:]
+	}
+	return len(p), nil
+}
+
+// Flush redacts and writes a remaining line without newline
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(w.w, w.r.String(string(w.buf)))
+	w.buf = nil
+	return err
+}
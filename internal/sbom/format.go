@@ -0,0 +1,220 @@
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Properties smp adds to CycloneDX components, so a stored SBOM can be read back
+// without parsing package URLs
+const (
+	propertyEcosystem = "smp:ecosystem"
+	propertyRelease   = "smp:release"
+	propertyLocation  = "smp:location"
+)
+
+type cdxDocument struct {
+	BOMFormat   string         `json:"bomFormat"`
+	SpecVersion string         `json:"specVersion"`
+	Version     int            `json:"version"`
+	Metadata    cdxMetadata    `json:"metadata"`
+	Components  []cdxComponent `json:"components"`
+}
+
+type cdxMetadata struct {
+	Timestamp  time.Time     `json:"timestamp"`
+	Tools      []cdxTool     `json:"tools,omitempty"`
+	Component  cdxComponent  `json:"component"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxTool struct {
+	Name string `json:"name"`
+}
+
+type cdxComponent struct {
+	Type       string        `json:"type"`
+	BOMRef     string        `json:"bom-ref,omitempty"`
+	Name       string        `json:"name"`
+	Version    string        `json:"version,omitempty"`
+	PURL       string        `json:"purl,omitempty"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// CycloneDX encodes the SBOM as a CycloneDX 1.5 JSON document
+func (s *SBOM) CycloneDX() ([]byte, error) {
+	doc := cdxDocument{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.5",
+		Version:     1,
+		Metadata: cdxMetadata{
+			Timestamp: s.Created,
+			Tools:     []cdxTool{{Name: "smp"}},
+			Component: cdxComponent{Type: "container", Name: s.Image, Version: s.Digest},
+			Properties: []cdxProperty{
+				{Name: "smp:mcp", Value: s.MCP},
+				{Name: "smp:os", Value: s.OS},
+			},
+		},
+		Components: []cdxComponent{},
+	}
+
+	for _, p := range s.Packages {
+		purl := p.PURL()
+		properties := []cdxProperty{
+			{Name: propertyEcosystem, Value: p.Ecosystem},
+			{Name: propertyLocation, Value: p.Location},
+		}
+		if p.Release != "" {
+			properties = append(properties, cdxProperty{Name: propertyRelease, Value: p.Release})
+		}
+		doc.Components = append(doc.Components, cdxComponent{
+			Type:       "library",
+			BOMRef:     purl,
+			Name:       p.Name,
+			Version:    p.Version,
+			PURL:       purl,
+			Properties: properties,
+		})
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// ParseCycloneDX decodes an SBOM written by CycloneDX
+func ParseCycloneDX(data []byte) (*SBOM, error) {
+	var doc cdxDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse CycloneDX SBOM: %w", err)
+	}
+	if doc.BOMFormat != "CycloneDX" {
+		return nil, fmt.Errorf("failed to parse CycloneDX SBOM: unexpected format %q", doc.BOMFormat)
+	}
+
+	s := &SBOM{
+		Image:   doc.Metadata.Component.Name,
+		Digest:  doc.Metadata.Component.Version,
+		Created: doc.Metadata.Timestamp,
+	}
+	for _, property := range doc.Metadata.Properties {
+		switch property.Name {
+		case "smp:mcp":
+			s.MCP = property.Value
+		case "smp:os":
+			s.OS = property.Value
+		}
+	}
+
+	for _, component := range doc.Components {
+		p := Package{Name: component.Name, Version: component.Version}
+		for _, property := range component.Properties {
+			switch property.Name {
+			case propertyEcosystem:
+				p.Ecosystem = property.Value
+			case propertyRelease:
+				p.Release = property.Value
+			case propertyLocation:
+				p.Location = property.Value
+			}
+		}
+		s.Packages = append(s.Packages, p)
+	}
+
+	return s, nil
+}
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID           string            `json:"SPDXID"`
+	Name             string            `json:"name"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	SourceInfo       string            `json:"sourceInfo,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// SPDX encodes the SBOM as an SPDX 2.3 JSON document
+func (s *SBOM) SPDX() ([]byte, error) {
+	const imageID = "SPDXRef-Image"
+
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              s.MCP,
+		DocumentNamespace: fmt.Sprintf("https://github.com/lvrach/smp/sbom/%s/%s", s.MCP, strings.ReplaceAll(s.Digest, ":", "-")),
+		CreationInfo: spdxCreationInfo{
+			Created:  s.Created.Format(time.RFC3339),
+			Creators: []string{"Tool: smp"},
+		},
+		Packages: []spdxPackage{{
+			SPDXID:           imageID,
+			Name:             s.Image,
+			VersionInfo:      s.Digest,
+			DownloadLocation: "NOASSERTION",
+		}},
+		Relationships: []spdxRelationship{{
+			SPDXElementID:      "SPDXRef-DOCUMENT",
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: imageID,
+		}},
+	}
+
+	for i, p := range s.Packages {
+		id := fmt.Sprintf("SPDXRef-Package-%d", i+1)
+		doc.Packages = append(doc.Packages, spdxPackage{
+			SPDXID:           id,
+			Name:             p.Name,
+			VersionInfo:      p.Version,
+			DownloadLocation: "NOASSERTION",
+			SourceInfo:       "found in " + p.Location,
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  p.PURL(),
+			}},
+		})
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      imageID,
+			RelationshipType:   "CONTAINS",
+			RelatedSPDXElement: id,
+		})
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
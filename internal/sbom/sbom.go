@@ -0,0 +1,131 @@
+package sbom
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lvrach/smp/internal/docker"
+)
+
+// Ecosystems of packages, named as in the OSV vulnerability format
+const (
+	EcosystemNPM    = "npm"
+	EcosystemPyPI   = "PyPI"
+	EcosystemGo     = "Go"
+	EcosystemDebian = "Debian"
+	EcosystemUbuntu = "Ubuntu"
+	EcosystemAlpine = "Alpine"
+)
+
+// Package is a software package found in an image
+type Package struct {
+	Name      string
+	Version   string
+	Ecosystem string
+
+	// Release of the distribution OS packages belong to, e.g. 12 for Debian
+	// bookworm or v3.19 for Alpine
+	Release string
+
+	// Path of the file the package was found in
+	Location string
+}
+
+// OSVEcosystem returns the ecosystem of the package including the distribution
+// release, as vulnerability databases name it, e.g. Debian:12
+func (p Package) OSVEcosystem() string {
+	if p.Release != "" {
+		return p.Ecosystem + ":" + p.Release
+	}
+	return p.Ecosystem
+}
+
+// PURL returns the package URL identifying the package
+func (p Package) PURL() string {
+	version := url.PathEscape(p.Version)
+	switch p.Ecosystem {
+	case EcosystemNPM:
+		return "pkg:npm/" + strings.ReplaceAll(p.Name, "@", "%40") + "@" + version
+	case EcosystemPyPI:
+		return "pkg:pypi/" + normalizePyPI(p.Name) + "@" + version
+	case EcosystemGo:
+		return "pkg:golang/" + p.Name + "@" + version
+	case EcosystemDebian, EcosystemUbuntu:
+		distro := strings.ToLower(p.Ecosystem)
+		return fmt.Sprintf("pkg:deb/%s/%s@%s?distro=%s-%s", distro, p.Name, version, distro, p.Release)
+	case EcosystemAlpine:
+		return fmt.Sprintf("pkg:apk/alpine/%s@%s?distro=alpine-%s", p.Name, version, strings.TrimPrefix(p.Release, "v"))
+	}
+	return "pkg:generic/" + url.PathEscape(p.Name) + "@" + version
+}
+
+// SBOM lists the packages in the image of an MCP
+type SBOM struct {
+	MCP     string
+	Image   string
+	Digest  string
+	Created time.Time
+
+	// Name of the image's operating system, e.g. Debian GNU/Linux 12 (bookworm)
+	OS string
+
+	Packages []Package
+}
+
+// Generate exports the filesystem of an image and lists the packages installed in
+// it, from OS package databases, language lockfiles and Go binaries
+func Generate(mcpName, imageRef, digest string) (*SBOM, error) {
+	var doc *SBOM
+	err := docker.ExportFilesystem(imageRef, func(r io.Reader) error {
+		var err error
+		doc, err = Scan(r)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan image %s: %w", imageRef, err)
+	}
+
+	doc.MCP = mcpName
+	doc.Image = imageRef
+	doc.Digest = digest
+	doc.Created = time.Now().UTC()
+	return doc, nil
+}
+
+// sortPackages orders packages by ecosystem, name and version and drops
+// packages found more than once
+func sortPackages(packages []Package) []Package {
+	sort.SliceStable(packages, func(i, j int) bool {
+		a, b := packages[i], packages[j]
+		if a.Ecosystem != b.Ecosystem {
+			return a.Ecosystem < b.Ecosystem
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Version < b.Version
+	})
+
+	var unique []Package
+	seen := make(map[string]bool)
+	for _, p := range packages {
+		key := p.Ecosystem + "|" + p.Name + "|" + p.Version
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, p)
+	}
+	return unique
+}
+
+// normalizePyPI returns the normalized form of a Python package name, as PyPI
+// compares them
+func normalizePyPI(name string) string {
+	name = strings.ToLower(name)
+	return strings.NewReplacer("_", "-", ".", "-").Replace(name)
+}
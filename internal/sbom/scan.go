@@ -0,0 +1,317 @@
+package sbom
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"debug/buildinfo"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// maxBinarySize is the size of the largest executable read to look for Go
+// module information
+const maxBinarySize = 256 << 20
+
+// elfMagic starts every Linux executable
+var elfMagic = []byte{0x7f, 'E', 'L', 'F'}
+
+// Scan lists the packages in an image filesystem read as a tar archive
+func Scan(r io.Reader) (*SBOM, error) {
+	var (
+		packages   []Package
+		osPackages []Package
+		osRelease  map[string]string
+	)
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read image filesystem: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+header.Name), "/")
+		base := path.Base(name)
+		dir := path.Dir(name)
+
+		switch {
+		case name == "etc/os-release" || (name == "usr/lib/os-release" && osRelease == nil):
+			osRelease = parseKeyValues(tr)
+		case name == "var/lib/dpkg/status" || dir == "var/lib/dpkg/status.d":
+			osPackages = append(osPackages, parseStanzas(tr, "Package", "Version", name)...)
+		case name == "lib/apk/db/installed":
+			osPackages = append(osPackages, parseStanzas(tr, "P", "V", name)...)
+		case base == "package.json" && isNodeModule(dir):
+			if p, ok := parsePackageJSON(tr, name); ok {
+				packages = append(packages, p)
+			}
+		case base == "package-lock.json" && !strings.Contains(name, "node_modules/"):
+			packages = append(packages, parsePackageLock(tr, name)...)
+		case base == "METADATA" && strings.HasSuffix(dir, ".dist-info"),
+			base == "PKG-INFO" && strings.HasSuffix(dir, ".egg-info"):
+			if p, ok := parsePythonMetadata(tr, name); ok {
+				packages = append(packages, p)
+			}
+		case base == "uv.lock" || base == "poetry.lock":
+			packages = append(packages, parseTOMLLock(tr, name)...)
+		case header.Mode&0111 != 0 && header.Size > int64(len(elfMagic)) && header.Size <= maxBinarySize:
+			packages = append(packages, parseGoBinary(tr, name)...)
+		}
+	}
+
+	doc := &SBOM{OS: osRelease["PRETTY_NAME"]}
+
+	ecosystem, release := distribution(osRelease)
+	for _, p := range osPackages {
+		p.Ecosystem = ecosystem
+		p.Release = release
+		packages = append(packages, p)
+	}
+
+	doc.Packages = sortPackages(packages)
+	return doc, nil
+}
+
+// distribution returns the OSV ecosystem and release of OS packages from the
+// fields of /etc/os-release
+func distribution(osRelease map[string]string) (string, string) {
+	version := osRelease["VERSION_ID"]
+	switch osRelease["ID"] {
+	case "alpine":
+		// Alpine advisories are per branch, e.g. v3.19 for 3.19.1
+		parts := strings.SplitN(version, ".", 3)
+		if len(parts) >= 2 {
+			version = parts[0] + "." + parts[1]
+		}
+		return EcosystemAlpine, "v" + version
+	case "ubuntu":
+		return EcosystemUbuntu, version
+	default:
+		// Debian and derivatives, including distroless images
+		return EcosystemDebian, strings.SplitN(version, ".", 2)[0]
+	}
+}
+
+// isNodeModule reports whether dir is a package installed in node_modules,
+// e.g. node_modules/zod or node_modules/@scope/name
+func isNodeModule(dir string) bool {
+	parent := path.Dir(dir)
+	if strings.HasPrefix(path.Base(parent), "@") {
+		parent = path.Dir(parent)
+	}
+	return path.Base(parent) == "node_modules"
+}
+
+// parseKeyValues parses a file of KEY=value lines, such as /etc/os-release
+func parseKeyValues(r io.Reader) map[string]string {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if ok {
+			values[key] = strings.Trim(value, `"'`)
+		}
+	}
+	return values
+}
+
+// parseStanzas parses a package database of blank line separated stanzas of
+// "Key: value" or "K:value" lines, as dpkg and apk write them
+func parseStanzas(r io.Reader, nameKey, versionKey, location string) []Package {
+	var packages []Package
+	current := Package{Location: location}
+	installed := true
+
+	flush := func() {
+		if current.Name != "" && current.Version != "" && installed {
+			packages = append(packages, current)
+		}
+		current = Package{Location: location}
+		installed = true
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || strings.HasPrefix(line, " ") {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case nameKey:
+			current.Name = value
+		case versionKey:
+			current.Version = value
+		case "Status":
+			// Removed packages keep a stanza in the dpkg database
+			installed = strings.HasSuffix(value, " installed")
+		}
+	}
+	flush()
+
+	return packages
+}
+
+// parsePackageJSON reads the name and version of an installed npm package
+func parsePackageJSON(r io.Reader, location string) (Package, bool) {
+	var manifest struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(r).Decode(&manifest); err != nil || manifest.Name == "" || manifest.Version == "" {
+		return Package{}, false
+	}
+	return Package{Name: manifest.Name, Version: manifest.Version, Ecosystem: EcosystemNPM, Location: location}, true
+}
+
+// parsePackageLock reads the packages locked by an npm lockfile, version 2 and 3
+// list them under packages, version 1 under nested dependencies
+func parsePackageLock(r io.Reader, location string) []Package {
+	type dependency struct {
+		Version      string                     `json:"version"`
+		Dependencies map[string]json.RawMessage `json:"dependencies"`
+	}
+	var lock struct {
+		Packages     map[string]dependency      `json:"packages"`
+		Dependencies map[string]json.RawMessage `json:"dependencies"`
+	}
+	if err := json.NewDecoder(r).Decode(&lock); err != nil {
+		return nil
+	}
+
+	var packages []Package
+	for key, dep := range lock.Packages {
+		i := strings.LastIndex(key, "node_modules/")
+		if i < 0 || dep.Version == "" {
+			continue
+		}
+		name := key[i+len("node_modules/"):]
+		packages = append(packages, Package{Name: name, Version: dep.Version, Ecosystem: EcosystemNPM, Location: location})
+	}
+
+	var walk func(deps map[string]json.RawMessage)
+	walk = func(deps map[string]json.RawMessage) {
+		for name, raw := range deps {
+			var dep dependency
+			if json.Unmarshal(raw, &dep) != nil || dep.Version == "" {
+				continue
+			}
+			packages = append(packages, Package{Name: name, Version: dep.Version, Ecosystem: EcosystemNPM, Location: location})
+			walk(dep.Dependencies)
+		}
+	}
+	if len(lock.Packages) == 0 {
+		walk(lock.Dependencies)
+	}
+
+	return packages
+}
+
+// parsePythonMetadata reads the name and version of an installed Python
+// distribution from its METADATA or PKG-INFO headers
+func parsePythonMetadata(r io.Reader, location string) (Package, bool) {
+	p := Package{Ecosystem: EcosystemPyPI, Location: location}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// Headers end at the first blank line, the description follows
+			break
+		}
+		if value, ok := strings.CutPrefix(line, "Name: "); ok {
+			p.Name = strings.TrimSpace(value)
+		}
+		if value, ok := strings.CutPrefix(line, "Version: "); ok {
+			p.Version = strings.TrimSpace(value)
+		}
+	}
+	return p, p.Name != "" && p.Version != ""
+}
+
+// parseTOMLLock reads the [[package]] tables of a uv or Poetry lockfile
+func parseTOMLLock(r io.Reader, location string) []Package {
+	var packages []Package
+	var current *Package
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			if current != nil && current.Name != "" && current.Version != "" {
+				packages = append(packages, *current)
+			}
+			current = nil
+			if line == "[[package]]" {
+				current = &Package{Ecosystem: EcosystemPyPI, Location: location}
+			}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		switch strings.TrimSpace(key) {
+		case "name":
+			current.Name = value
+		case "version":
+			current.Version = value
+		}
+	}
+	if current != nil && current.Name != "" && current.Version != "" {
+		packages = append(packages, *current)
+	}
+
+	return packages
+}
+
+// parseGoBinary reads the modules a Go executable was built from
+func parseGoBinary(r io.Reader, location string) []Package {
+	magic := make([]byte, len(elfMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, elfMagic) {
+		return nil
+	}
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		return nil
+	}
+
+	info, err := buildinfo.Read(bytes.NewReader(append(magic, rest...)))
+	if err != nil {
+		return nil
+	}
+
+	var packages []Package
+	if info.Main.Path != "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		packages = append(packages, Package{Name: info.Main.Path, Version: info.Main.Version, Ecosystem: EcosystemGo, Location: location})
+	}
+	for _, dep := range info.Deps {
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		packages = append(packages, Package{Name: dep.Path, Version: dep.Version, Ecosystem: EcosystemGo, Location: location})
+	}
+	packages = append(packages, Package{Name: "stdlib", Version: strings.TrimPrefix(info.GoVersion, "go"), Ecosystem: EcosystemGo, Location: location})
+
+	return packages
+}
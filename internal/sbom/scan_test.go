@@ -0,0 +1,183 @@
+package sbom_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/lvrach/smp/internal/sbom"
+)
+
+// file is a regular file of an image filesystem
+type file struct {
+	name    string
+	content string
+	mode    int64
+}
+
+// archive writes files to a tar archive, as docker exports filesystems
+func archive(t *testing.T, files []file) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		mode := f.mode
+		if mode == 0 {
+			mode = 0644
+		}
+		header := &tar.Header{Typeflag: tar.TypeReg, Name: f.name, Mode: mode, Size: int64(len(f.content))}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+// summary lists packages as "ecosystem name version" strings
+func summary(packages []sbom.Package) []string {
+	var lines []string
+	for _, p := range packages {
+		lines = append(lines, p.OSVEcosystem()+" "+p.Name+" "+p.Version)
+	}
+	return lines
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    []file
+		os       string
+		packages []string
+	}{
+		{
+			name: "debian",
+			files: []file{
+				{name: "etc/os-release", content: "PRETTY_NAME=\"Debian GNU/Linux 12 (bookworm)\"\nID=debian\nVERSION_ID=\"12\"\n"},
+				{name: "var/lib/dpkg/status", content: "Package: curl\nStatus: install ok installed\nVersion: 7.88.1-10+deb12u5\nDescription: tool\n multi-line: description\n\n" +
+					"Package: removed\nStatus: deinstall ok config-files\nVersion: 1.0-1\n\n" +
+					"Package: libc6\nStatus: install ok installed\nVersion: 2.36-9+deb12u4\n"},
+			},
+			os:       "Debian GNU/Linux 12 (bookworm)",
+			packages: []string{"Debian:12 curl 7.88.1-10+deb12u5", "Debian:12 libc6 2.36-9+deb12u4"},
+		},
+		{
+			name: "distroless",
+			files: []file{
+				{name: "./etc/os-release", content: "ID=debian\nVERSION_ID=\"12.5\"\n"},
+				{name: "var/lib/dpkg/status.d/tzdata", content: "Package: tzdata\nVersion: 2024a-0+deb12u1\n"},
+			},
+			packages: []string{"Debian:12 tzdata 2024a-0+deb12u1"},
+		},
+		{
+			name: "ubuntu",
+			files: []file{
+				{name: "usr/lib/os-release", content: "ID=ubuntu\nVERSION_ID=\"22.04\"\n"},
+				{name: "var/lib/dpkg/status", content: "Package: openssl\nStatus: install ok installed\nVersion: 3.0.2-0ubuntu1.10\n"},
+			},
+			packages: []string{"Ubuntu:22.04 openssl 3.0.2-0ubuntu1.10"},
+		},
+		{
+			name: "alpine",
+			files: []file{
+				{name: "etc/os-release", content: "ID=alpine\nVERSION_ID=3.19.1\n"},
+				{name: "lib/apk/db/installed", content: "C:Q1abc=\nP:musl\nV:1.2.4_git20230717-r4\n\nP:busybox\nV:1.36.1-r15\n"},
+			},
+			packages: []string{"Alpine:v3.19 busybox 1.36.1-r15", "Alpine:v3.19 musl 1.2.4_git20230717-r4"},
+		},
+		{
+			name: "npm",
+			files: []file{
+				{name: "app/node_modules/zod/package.json", content: `{"name":"zod","version":"3.22.4"}`},
+				{name: "app/node_modules/@scope/pkg/package.json", content: `{"name":"@scope/pkg","version":"1.0.0"}`},
+				{name: "app/node_modules/zod/lib/package.json", content: `{"name":"not-a-module","version":"0.0.1"}`},
+				{name: "app/package-lock.json", content: `{"packages":{"":{"version":"1.0.0"},"node_modules/zod":{"version":"3.22.4"},"node_modules/a/node_modules/b":{"version":"2.0.0"}}}`},
+			},
+			packages: []string{"npm @scope/pkg 1.0.0", "npm b 2.0.0", "npm zod 3.22.4"},
+		},
+		{
+			name: "npm lockfile version 1",
+			files: []file{
+				{name: "app/package-lock.json", content: `{"lockfileVersion":1,"dependencies":{"a":{"version":"1.0.0","dependencies":{"b":{"version":"2.0.0"}}}}}`},
+			},
+			packages: []string{"npm a 1.0.0", "npm b 2.0.0"},
+		},
+		{
+			name: "python",
+			files: []file{
+				{name: "usr/lib/python3/site-packages/requests-2.31.0.dist-info/METADATA", content: "Metadata-Version: 2.1\nName: requests\nVersion: 2.31.0\n\nName: not-a-header\n"},
+				{name: "usr/lib/python3/site-packages/six.egg-info/PKG-INFO", content: "Name: six\nVersion: 1.16.0\n"},
+				{name: "app/uv.lock", content: "version = 1\n\n[[package]]\nname = \"httpx\"\nversion = \"0.27.0\"\n\n[package.optional-dependencies]\nname = \"ignored\"\n\n[[package]]\nname = \"mcp\"\nversion = \"1.2.0\"\n"},
+			},
+			packages: []string{"PyPI httpx 0.27.0", "PyPI mcp 1.2.0", "PyPI requests 2.31.0", "PyPI six 1.16.0"},
+		},
+		{
+			name: "duplicates",
+			files: []file{
+				{name: "a/node_modules/zod/package.json", content: `{"name":"zod","version":"3.22.4"}`},
+				{name: "b/node_modules/zod/package.json", content: `{"name":"zod","version":"3.22.4"}`},
+			},
+			packages: []string{"npm zod 3.22.4"},
+		},
+		{
+			name: "not packages",
+			files: []file{
+				{name: "app/package.json", content: `{"name":"app","version":"1.0.0"}`},
+				{name: "usr/bin/script", content: "#!/bin/sh\necho hello\n", mode: 0755},
+				{name: "app/node_modules/broken/package.json", content: `{"name":`},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := sbom.Scan(archive(t, tt.files))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if doc.OS != tt.os {
+				t.Errorf("OS = %q, want %q", doc.OS, tt.os)
+			}
+			if got := summary(doc.Packages); !reflect.DeepEqual(got, tt.packages) {
+				t.Errorf("packages = %q, want %q", got, tt.packages)
+			}
+		})
+	}
+}
+
+func TestScanGoBinary(t *testing.T) {
+	// The test binary is a Go executable with module information
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(executable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(content, []byte("\x7fELF")) {
+		t.Skip("not an ELF executable")
+	}
+
+	doc, err := sbom.Scan(archive(t, []file{{name: "usr/local/bin/mcp", content: string(content), mode: 0755}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdlib bool
+	for _, p := range doc.Packages {
+		if p.Ecosystem == sbom.EcosystemGo && p.Name == "stdlib" && p.Location == "usr/local/bin/mcp" {
+			stdlib = true
+		}
+	}
+	if !stdlib {
+		t.Errorf("packages = %q, want the Go standard library", summary(doc.Packages))
+	}
+}
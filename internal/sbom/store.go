@@ -0,0 +1,88 @@
+package sbom
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Store keeps the SBOMs of installed MCPs, one CycloneDX and one SPDX document
+// per image digest
+type Store struct {
+	dir string
+}
+
+// NewStore creates a store of SBOMs in dir
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// NewHomeStore operates an SBOM store in the user's home directory
+func NewHomeStore() (*Store, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+	}
+
+	return NewStore(filepath.Join(homeDir, ".smp", "sbom")), nil
+}
+
+// Path returns the file of the CycloneDX SBOM of an MCP's image
+func (s *Store) Path(mcpName, digest string) string {
+	return filepath.Join(s.dir, mcpName, strings.ReplaceAll(digest, ":", "-")+".cdx.json")
+}
+
+// Exists reports whether an SBOM of the image was stored
+func (s *Store) Exists(mcpName, digest string) bool {
+	_, err := os.Stat(s.Path(mcpName, digest))
+	return err == nil
+}
+
+// Save writes the SBOM in CycloneDX and SPDX format
+func (s *Store) Save(doc *SBOM) error {
+	cdx, err := doc.CycloneDX()
+	if err != nil {
+		return fmt.Errorf("failed to encode CycloneDX SBOM: %w", err)
+	}
+	spdx, err := doc.SPDX()
+	if err != nil {
+		return fmt.Errorf("failed to encode SPDX SBOM: %w", err)
+	}
+
+	path := s.Path(doc.MCP, doc.Digest)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create SBOM directory: %w", err)
+	}
+	if err := os.WriteFile(path, cdx, 0644); err != nil {
+		return fmt.Errorf("failed to write SBOM: %w", err)
+	}
+	if err := os.WriteFile(strings.TrimSuffix(path, ".cdx.json")+".spdx.json", spdx, 0644); err != nil {
+		return fmt.Errorf("failed to write SBOM: %w", err)
+	}
+
+	return nil
+}
+
+// Load reads the SBOM of an MCP's image, the error wraps os.ErrNotExist if none
+// was stored
+func (s *Store) Load(mcpName, digest string) (*SBOM, error) {
+	data, err := os.ReadFile(s.Path(mcpName, digest))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no SBOM of %s for image %s: %w", mcpName, digest, err)
+		}
+		return nil, fmt.Errorf("failed to read SBOM: %w", err)
+	}
+
+	return ParseCycloneDX(data)
+}
+
+// Remove deletes the SBOMs of an MCP
+func (s *Store) Remove(mcpName string) error {
+	if err := os.RemoveAll(filepath.Join(s.dir, mcpName)); err != nil {
+		return fmt.Errorf("failed to remove SBOMs of %s: %w", mcpName, err)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package source
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/lvrach/smp/internal/git"
+)
+
+// namePattern is the pattern of source names, which name directories in ~/.smp
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// ValidateName checks that a source name is safe to use as a directory name
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid source name %q, use lowercase letters, digits, '.', '_' and '-', starting with a letter or digit", name)
+	}
+	return nil
+}
+
+// Source is a git repository of MCP definitions registered with smp
+type Source struct {
+	// Name of the source, used as its checkout directory
+	Name string `json:"name"`
+
+	// Git URL of the repository
+	URL string `json:"url"`
+
+	// Branch to track, empty for the remote's default branch
+	Branch string `json:"branch,omitempty"`
+}
+
+// Store handles the registered definition sources and their checkouts
+type Store struct {
+	baseDir string
+}
+
+// NewStore operates a new source store
+func NewStore(baseDir string) (*Store, error) {
+	return &Store{
+		baseDir: baseDir,
+	}, nil
+}
+
+// NewHomeStore operates a source store in the user's home directory
+func NewHomeStore() (*Store, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+	}
+
+	return NewStore(filepath.Join(homeDir, ".smp"))
+}
+
+// NameFromURL derives a source name from a git URL,
+// e.g. git@github.com:acme/mcp-definitions.git becomes mcp-definitions
+func NameFromURL(url string) string {
+	name := path.Base(strings.ReplaceAll(url, ":", "/"))
+	return strings.ToLower(strings.TrimSuffix(name, ".git"))
+}
+
+// Dir returns the checkout directory of a source
+func (s *Store) Dir(name string) string {
+	return filepath.Join(s.baseDir, "sources", name)
+}
+
+// DefinitionsDir returns the directory holding a source's definitions: its
+// definitions/ folder if it has one, the repository root otherwise
+func (s *Store) DefinitionsDir(name string) string {
+	dir := filepath.Join(s.Dir(name), "definitions")
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		return dir
+	}
+	return s.Dir(name)
+}
+
+// List returns the registered sources in registration order
+func (s *Store) List() ([]Source, error) {
+	data, err := os.ReadFile(s.registryPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read sources file: %w", err)
+	}
+
+	var sources []Source
+	if err := json.Unmarshal(data, &sources); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal sources: %w", err)
+	}
+
+	return sources, nil
+}
+
+// Add clones a source and registers it
+func (s *Store) Add(src Source) error {
+	if err := ValidateName(src.Name); err != nil {
+		return err
+	}
+
+	sources, err := s.List()
+	if err != nil {
+		return err
+	}
+
+	for _, existing := range sources {
+		if existing.Name == src.Name {
+			return fmt.Errorf("source %q already exists", src.Name)
+		}
+	}
+
+	// The sources directory is only created once a source is added, so reading
+	// definitions leaves the home directory alone
+	if err := os.MkdirAll(filepath.Join(s.baseDir, "sources"), 0755); err != nil {
+		return fmt.Errorf("failed to create sources directory: %w", err)
+	}
+
+	// Only clean up a failed clone's directory if this call created it
+	_, statErr := os.Stat(s.Dir(src.Name))
+	existed := !os.IsNotExist(statErr)
+	if err := git.Clone(src.URL, src.Branch, s.Dir(src.Name)); err != nil {
+		if !existed {
+			os.RemoveAll(s.Dir(src.Name))
+		}
+		return err
+	}
+
+	return s.save(append(sources, src))
+}
+
+// Update fetches the latest definitions of a registered source
+func (s *Store) Update(name string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+
+	src, err := s.Get(name)
+	if err != nil {
+		return err
+	}
+
+	// Re-clone if the checkout went missing
+	if _, err := os.Stat(s.Dir(name)); os.IsNotExist(err) {
+		return git.Clone(src.URL, src.Branch, s.Dir(name))
+	}
+
+	return git.Update(s.Dir(name), src.Branch)
+}
+
+// Remove unregisters a source and deletes its checkout
+func (s *Store) Remove(name string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+
+	sources, err := s.List()
+	if err != nil {
+		return err
+	}
+
+	var remaining []Source
+	for _, src := range sources {
+		if src.Name != name {
+			remaining = append(remaining, src)
+		}
+	}
+	if len(remaining) == len(sources) {
+		return fmt.Errorf("source %q not found", name)
+	}
+
+	if err := os.RemoveAll(s.Dir(name)); err != nil {
+		return fmt.Errorf("failed to delete source checkout: %w", err)
+	}
+
+	return s.save(remaining)
+}
+
+// Get returns a registered source by name
+func (s *Store) Get(name string) (*Source, error) {
+	sources, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, src := range sources {
+		if src.Name == name {
+			return &src, nil
+		}
+	}
+
+	return nil, fmt.Errorf("source %q not found", name)
+}
+
+func (s *Store) registryPath() string {
+	return filepath.Join(s.baseDir, "sources.json")
+}
+
+func (s *Store) save(sources []Source) error {
+	data, err := json.MarshalIndent(sources, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal sources: %w", err)
+	}
+
+	if err := os.WriteFile(s.registryPath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to write sources file: %w", err)
+	}
+
+	return nil
+}
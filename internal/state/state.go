@@ -4,7 +4,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"time"
+
+	"github.com/lvrach/smp/internal/config"
+)
+
+// Secret stores an MCP's secret environment variables can be kept in
+const (
+	SecretStoreState    = "state"
+	SecretStoreKeychain = "keychain"
 )
 
 // MCPServer represents the state of an installed MCP
@@ -12,17 +22,136 @@ type MCPServer struct {
 	// Name of the MCP
 	Name string `json:"name"`
 
+	// Project definitions directory the MCP was installed from, if any
+	DefinitionDir string `json:"definition_dir,omitempty"`
+
 	// Docker image tag for this MCP
 	LocalImageTag string `json:"local_image_tag"`
 
+	// Digest of the Docker image, if known
+	ImageDigest string `json:"image_digest,omitempty"`
+
+	// Commit of the source repository the image was built from
+	SourceCommit string `json:"source_commit,omitempty"`
+
+	// Version of the npm or PyPI package the image was built from
+	PackageVersion string `json:"package_version,omitempty"`
+
+	// Signature policy of the definition at install, with its key inlined. smp
+	// run enforces this copy, so later changes to definitions can't weaken it.
+	Verify *config.VerifyPolicy `json:"verify,omitempty"`
+
+	// Digest of the image whose signature was last verified against Verify
+	VerifiedDigest string `json:"verified_digest,omitempty"`
+
+	// Time the Docker image was last built, zero for pulled images
+	BuiltAt time.Time `json:"built_at"`
+
+	// Image that was replaced by the last upgrade, kept for rollback
+	PreviousImage *ImageVersion `json:"previous_image,omitempty"`
+
 	// Environment variables set for this MCP
 	EnvironmentVariables map[string]string `json:"environment_variables"`
 
 	// Environment variables that are stored in the keychain
 	KeyChainEnvVars map[string]string `json:"keychain_env_vars"`
 
+	// Secret store chosen for this MCP's secrets
+	SecretStore string `json:"secret_store,omitempty"`
+
+	// Features enabled from the definition's variable groups
+	Features []string `json:"features,omitempty"`
+
 	// Hosts that are configured to run this MCP
 	ConfiguredHosts []string `json:"configured_hosts"`
+
+	// Approved tools, prompts and resources, by list method, pinned on the first run
+	Pins map[string]PinnedList `json:"pins,omitempty"`
+
+	// Changed or new tools, prompts and resources seen since, awaiting smp approve
+	PendingPins map[string]PinnedList `json:"pending_pins,omitempty"`
+
+	// What smp run does when definitions differ from their pins: block (the default) or warn
+	PinMode string `json:"pin_mode,omitempty"`
+
+	// Tools hosts may see and call and the calls that need the user's approval,
+	// all allowed without approval if nil
+	Tools *ToolPolicy `json:"tools,omitempty"`
+}
+
+// ToolPolicy limits the tools of an MCP that hosts can see and call, and marks
+// the tools whose calls the user must confirm. Entries are tool names or glob
+// patterns such as jira_get_*.
+type ToolPolicy struct {
+	// Tools that are allowed, all tools if empty
+	Allow []string `json:"allow,omitempty" yaml:"allow,omitempty"`
+
+	// Tools that are denied, even if allowed
+	Deny []string `json:"deny,omitempty" yaml:"deny,omitempty"`
+
+	// Tools whose every call the user must confirm
+	Confirm []string `json:"confirm,omitempty" yaml:"confirm,omitempty"`
+}
+
+// Allowed reports whether the policy lets hosts see and call a tool
+func (p *ToolPolicy) Allowed(tool string) bool {
+	if p == nil {
+		return true
+	}
+	if matchTool(p.Deny, tool) {
+		return false
+	}
+	return len(p.Allow) == 0 || matchTool(p.Allow, tool)
+}
+
+// NeedsConfirmation reports whether the user must confirm calls to a tool
+func (p *ToolPolicy) NeedsConfirmation(tool string) bool {
+	return p != nil && matchTool(p.Confirm, tool)
+}
+
+// Empty reports whether the policy neither limits nor marks any tools
+func (p *ToolPolicy) Empty() bool {
+	return p == nil || (len(p.Allow) == 0 && len(p.Deny) == 0 && len(p.Confirm) == 0)
+}
+
+// Validate checks that the policy's entries are valid glob patterns
+func (p *ToolPolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	for _, pattern := range append(append(append([]string{}, p.Allow...), p.Deny...), p.Confirm...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid tool pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+func matchTool(patterns []string, tool string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, tool); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// PinnedList is the digest of the items returned by an MCP list method
+type PinnedList struct {
+	// Hash of all items
+	Hash string `json:"hash"`
+
+	// Hash of each item by name, or URI for resources
+	Items map[string]string `json:"items"`
+}
+
+// ImageVersion identifies a version of an MCP's Docker image
+type ImageVersion struct {
+	LocalImageTag  string    `json:"local_image_tag"`
+	ImageDigest    string    `json:"image_digest,omitempty"`
+	SourceCommit   string    `json:"source_commit,omitempty"`
+	PackageVersion string    `json:"package_version,omitempty"`
+	BuiltAt        time.Time `json:"built_at"`
 }
 
 // Store handles the persistence and retrieval of MCP states
@@ -149,6 +278,100 @@ func (s *MCPServer) GetEnvironmentVariable(key string) (string, bool) {
 	return value, exists
 }
 
+// HasEnvironmentVariable reports whether a variable is set, either in the state
+// or in the keychain
+func (s *MCPServer) HasEnvironmentVariable(key string) bool {
+	if _, exists := s.GetEnvironmentVariable(key); exists {
+		return true
+	}
+	_, exists := s.KeyChainAccount(key)
+	return exists
+}
+
+// UnsetEnvironmentVariable removes a variable from the state. If the variable was
+// stored in the keychain its account key is returned so the caller can delete it.
+func (s *MCPServer) UnsetEnvironmentVariable(key string) (string, bool) {
+	delete(s.EnvironmentVariables, key)
+
+	accountKey, exists := s.KeyChainAccount(key)
+	if exists {
+		delete(s.KeyChainEnvVars, accountKey)
+	}
+	return accountKey, exists
+}
+
+// KeyChainAccount returns the keychain account key holding a variable
+func (s *MCPServer) KeyChainAccount(key string) (string, bool) {
+	for accountKey, env := range s.KeyChainEnvVars {
+		if env == key {
+			return accountKey, true
+		}
+	}
+	return "", false
+}
+
+// UsesKeychain reports whether this MCP's secrets are kept in the keychain
+func (s *MCPServer) UsesKeychain() bool {
+	if s.SecretStore != "" {
+		return s.SecretStore == SecretStoreKeychain
+	}
+	return len(s.KeyChainEnvVars) > 0
+}
+
+// AddConfiguredHost records a host the MCP is configured in
+func (s *MCPServer) AddConfiguredHost(host string) {
+	for _, h := range s.ConfiguredHosts {
+		if h == host {
+			return
+		}
+	}
+	s.ConfiguredHosts = append(s.ConfiguredHosts, host)
+}
+
+// RemoveConfiguredHost forgets a host the MCP was configured in
+func (s *MCPServer) RemoveConfiguredHost(host string) {
+	hosts := s.ConfiguredHosts[:0]
+	for _, h := range s.ConfiguredHosts {
+		if h != host {
+			hosts = append(hosts, h)
+		}
+	}
+	s.ConfiguredHosts = hosts
+}
+
+// Installed reports whether the MCP has been installed
+func (s *MCPServer) Installed() bool {
+	return s.LocalImageTag != ""
+}
+
+// SecretBackend returns where the MCP's secrets are stored, empty if it has none
+func (s *MCPServer) SecretBackend() string {
+	if s.UsesKeychain() {
+		return SecretStoreKeychain
+	}
+	return s.SecretStore
+}
+
+// ImageVersion returns the version of the image the MCP currently runs
+func (s *MCPServer) ImageVersion() ImageVersion {
+	return ImageVersion{
+		LocalImageTag:  s.LocalImageTag,
+		ImageDigest:    s.ImageDigest,
+		SourceCommit:   s.SourceCommit,
+		PackageVersion: s.PackageVersion,
+		BuiltAt:        s.BuiltAt,
+	}
+}
+
+// SetImageVersion sets the version of the image the MCP runs
+func (s *MCPServer) SetImageVersion(v ImageVersion) {
+	s.LocalImageTag = v.LocalImageTag
+	s.ImageDigest = v.ImageDigest
+	s.SourceCommit = v.SourceCommit
+	s.PackageVersion = v.PackageVersion
+	s.BuiltAt = v.BuiltAt
+}
+
 // SetLocalImageTag sets the local Docker image tag for this MCP
 func (s *MCPServer) SetLocalImageTag(tag string) {
 	s.LocalImageTag = tag
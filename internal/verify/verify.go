@@ -0,0 +1,133 @@
+package verify
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/lvrach/smp/internal/config"
+	"github.com/lvrach/smp/internal/paths"
+)
+
+// ErrUnverified is returned when an image's signature or attestation does not
+// satisfy the definition's policy
+var ErrUnverified = errors.New("image signature not verified")
+
+// ErrNoCosign is returned when the cosign binary is not installed
+var ErrNoCosign = errors.New("cosign is required to verify image signatures, see https://docs.sigstore.dev/cosign/system_config/installation/")
+
+// Image verifies the signature of an image, pinned by digest, and the attestation
+// the policy asks for with cosign. Extra cosign arguments, e.g. --allow-http-registry
+// and --insecure-ignore-tlog for a local registry, can be set in SMP_COSIGN_ARGS.
+func Image(policy *config.VerifyPolicy, imageRef string) error {
+	if _, err := exec.LookPath("cosign"); err != nil {
+		return ErrNoCosign
+	}
+
+	identityArgs, cleanUp, err := identity(policy)
+	if err != nil {
+		return err
+	}
+	defer cleanUp()
+
+	if err := cosign("verify", identityArgs, imageRef); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrUnverified, imageRef, err)
+	}
+
+	if policy.Attestation != "" {
+		args := append([]string{"--type", policy.Attestation}, identityArgs...)
+		if err := cosign("verify-attestation", args, imageRef); err != nil {
+			return fmt.Errorf("%w: %s attestation of %s: %v", ErrUnverified, policy.Attestation, imageRef, err)
+		}
+	}
+
+	return nil
+}
+
+// Pin returns a copy of a policy to record at install, with a key file replaced
+// by the PEM encoded key it holds, so the copy doesn't change with the file
+func Pin(policy *config.VerifyPolicy) (*config.VerifyPolicy, error) {
+	if policy == nil {
+		return nil, nil
+	}
+
+	pinned := *policy
+	if pinned.Key != "" && !strings.HasPrefix(pinned.Key, "-----BEGIN") {
+		key, err := os.ReadFile(paths.ExpandHome(pinned.Key))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key: %w", err)
+		}
+		pinned.Key = string(key)
+	}
+	return &pinned, nil
+}
+
+// identity returns the cosign arguments selecting who must have signed the image.
+// A PEM encoded key is written to a temporary file removed by the returned function.
+func identity(policy *config.VerifyPolicy) ([]string, func(), error) {
+	noop := func() {}
+
+	if policy.Key == "" {
+		args := []string{"--certificate-oidc-issuer", policy.Issuer}
+		if policy.IdentityRegexp != "" {
+			args = append(args, "--certificate-identity-regexp", policy.IdentityRegexp)
+		} else {
+			args = append(args, "--certificate-identity", policy.Identity)
+		}
+		return args, noop, nil
+	}
+
+	if !strings.HasPrefix(policy.Key, "-----BEGIN") {
+		return []string{"--key", paths.ExpandHome(policy.Key)}, noop, nil
+	}
+
+	f, err := os.CreateTemp("", "smp-cosign-*.pub")
+	if err != nil {
+		return nil, noop, fmt.Errorf("failed to write public key: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(policy.Key); err != nil {
+		os.Remove(f.Name())
+		return nil, noop, fmt.Errorf("failed to write public key: %w", err)
+	}
+
+	return []string{"--key", f.Name()}, func() { os.Remove(f.Name()) }, nil
+}
+
+// cosign runs a cosign verification command, discarding the verified payload it
+// prints and returning the reason of a failure
+func cosign(command string, args []string, imageRef string) error {
+	cmdArgs := append([]string{command}, args...)
+	cmdArgs = append(cmdArgs, strings.Fields(os.Getenv("SMP_COSIGN_ARGS"))...)
+	cmdArgs = append(cmdArgs, imageRef)
+
+	cmd := exec.Command("cosign", cmdArgs...)
+	cmd.Stdout = io.Discard
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return errors.New(errorLine(stderr.String(), err))
+	}
+
+	return nil
+}
+
+// errorLine picks the line explaining why cosign failed
+func errorLine(output string, err error) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); strings.HasPrefix(line, "Error:") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "Error:"))
+		}
+	}
+	if line := strings.TrimSpace(lines[len(lines)-1]); line != "" {
+		return line
+	}
+	return err.Error()
+}
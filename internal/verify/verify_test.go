@@ -0,0 +1,318 @@
+package verify_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lvrach/smp/internal/config"
+	"github.com/lvrach/smp/internal/verify"
+)
+
+// registry is an in-memory OCI registry with what cosign needs to sign and
+// verify images: blob uploads and manifests by tag and digest
+type registry struct {
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string]manifest
+	uploads   map[string][]byte
+}
+
+type manifest struct {
+	mediaType string
+	content   []byte
+}
+
+func newRegistry(t *testing.T) (*registry, string) {
+	r := &registry{
+		blobs:     make(map[string][]byte),
+		manifests: make(map[string]manifest),
+		uploads:   make(map[string][]byte),
+	}
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return r, strings.TrimPrefix(server.URL, "http://")
+}
+
+func digestOf(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// push stores a minimal image in a repository under a tag, returning its digest
+func (r *registry) push(repository, tag, label string) string {
+	config := []byte(fmt.Sprintf(`{"architecture":"amd64","os":"linux","config":{"Labels":{"test":%q}},"rootfs":{"type":"layers","diff_ids":[]}}`, label))
+	content, _ := json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"config": map[string]any{
+			"mediaType": "application/vnd.oci.image.config.v1+json",
+			"digest":    digestOf(config),
+			"size":      len(config),
+		},
+		"layers": []any{},
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.blobs[digestOf(config)] = config
+	m := manifest{mediaType: "application/vnd.oci.image.manifest.v1+json", content: content}
+	r.manifests[repository+":"+tag] = m
+	r.manifests[repository+"@"+digestOf(content)] = m
+	return digestOf(content)
+}
+
+func (r *registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	if path == "" || path == req.URL.Path {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	switch {
+	case strings.Contains(path, "/manifests/"):
+		i := strings.LastIndex(path, "/manifests/")
+		r.serveManifest(w, req, path[:i], path[i+len("/manifests/"):])
+	case strings.Contains(path, "/blobs/uploads"):
+		i := strings.LastIndex(path, "/blobs/uploads")
+		r.serveUpload(w, req, path[:i], strings.Trim(path[i+len("/blobs/uploads"):], "/"))
+	case strings.Contains(path, "/blobs/"):
+		i := strings.LastIndex(path, "/blobs/")
+		blob, ok := r.blobs[path[i+len("/blobs/"):]]
+		if !ok {
+			http.Error(w, `{"errors":[{"code":"BLOB_UNKNOWN"}]}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(blob)))
+		w.Header().Set("Docker-Content-Digest", digestOf(blob))
+		if req.Method == http.MethodGet {
+			w.Write(blob)
+		}
+	default:
+		// Referrers and tag lists are optional, cosign falls back without them
+		http.Error(w, `{"errors":[{"code":"UNSUPPORTED"}]}`, http.StatusNotFound)
+	}
+}
+
+func (r *registry) serveManifest(w http.ResponseWriter, req *http.Request, repository, reference string) {
+	key := repository + ":" + reference
+	if strings.HasPrefix(reference, "sha256:") {
+		key = repository + "@" + reference
+	}
+
+	if req.Method == http.MethodPut {
+		content, _ := io.ReadAll(req.Body)
+		m := manifest{mediaType: req.Header.Get("Content-Type"), content: content}
+		r.manifests[key] = m
+		r.manifests[repository+"@"+digestOf(content)] = m
+		w.Header().Set("Docker-Content-Digest", digestOf(content))
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	m, ok := r.manifests[key]
+	if !ok {
+		http.Error(w, `{"errors":[{"code":"MANIFEST_UNKNOWN"}]}`, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", m.mediaType)
+	w.Header().Set("Content-Length", fmt.Sprint(len(m.content)))
+	w.Header().Set("Docker-Content-Digest", digestOf(m.content))
+	if req.Method == http.MethodGet {
+		w.Write(m.content)
+	}
+}
+
+func (r *registry) serveUpload(w http.ResponseWriter, req *http.Request, repository, id string) {
+	body, _ := io.ReadAll(req.Body)
+
+	switch req.Method {
+	case http.MethodPost:
+		if digest := req.URL.Query().Get("digest"); digest != "" {
+			r.blobs[digest] = body
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		id = fmt.Sprint(len(r.uploads) + 1)
+		r.uploads[id] = body
+		w.Header().Set("Location", "/v2/"+repository+"/blobs/uploads/"+id)
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPatch:
+		r.uploads[id] = append(r.uploads[id], body...)
+		w.Header().Set("Location", "/v2/"+repository+"/blobs/uploads/"+id)
+		w.Header().Set("Range", fmt.Sprintf("0-%d", len(r.uploads[id])-1))
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPut:
+		blob := append(r.uploads[id], body...)
+		delete(r.uploads, id)
+		r.blobs[req.URL.Query().Get("digest")] = blob
+		w.Header().Set("Docker-Content-Digest", digestOf(blob))
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// generateKey makes a cosign key pair without a password in dir
+func generateKey(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	cmd := exec.Command("cosign", "generate-key-pair")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "COSIGN_PASSWORD=")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("cosign generate-key-pair: %v\n%s", err, out)
+	}
+	return filepath.Join(dir, "cosign.key"), filepath.Join(dir, "cosign.pub")
+}
+
+func sign(t *testing.T, key, ref string) {
+	t.Helper()
+	cmd := exec.Command("cosign", "sign", "--yes", "--key", key, "--tlog-upload=false", "--allow-http-registry", ref)
+	cmd.Env = append(os.Environ(), "COSIGN_PASSWORD=")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("cosign sign: %v\n%s", err, out)
+	}
+}
+
+func TestImageWithLocalRegistry(t *testing.T) {
+	if _, err := exec.LookPath("cosign"); err != nil {
+		t.Skip("cosign is not installed")
+	}
+	t.Setenv("SMP_COSIGN_ARGS", "--allow-http-registry --insecure-ignore-tlog")
+
+	reg, host := newRegistry(t)
+	signed := host + "/test/mcp@" + reg.push("test/mcp", "signed", "signed")
+	unsigned := host + "/test/mcp@" + reg.push("test/mcp", "unsigned", "unsigned")
+
+	key, pub := generateKey(t, t.TempDir())
+	_, otherPub := generateKey(t, t.TempDir())
+	sign(t, key, signed)
+
+	// Policies are verified as install records them
+	policy, err := verify.Pin(&config.VerifyPolicy{Key: pub})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPolicy, err := verify.Pin(&config.VerifyPolicy{Key: otherPub})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		policy *config.VerifyPolicy
+		ref    string
+		ok     bool
+	}{
+		{name: "signed", policy: policy, ref: signed, ok: true},
+		{name: "unsigned", policy: policy, ref: unsigned},
+		{name: "signed with another key", policy: otherPolicy, ref: signed},
+		{name: "missing attestation", policy: &config.VerifyPolicy{Key: policy.Key, Attestation: "slsaprovenance"}, ref: signed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verify.Image(tt.policy, tt.ref)
+			switch {
+			case tt.ok && err != nil:
+				t.Errorf("verification failed: %v", err)
+			case !tt.ok && !errors.Is(err, verify.ErrUnverified):
+				t.Errorf("got %v, want %v", err, verify.ErrUnverified)
+			}
+		})
+	}
+
+	// The recorded copy still verifies after the key file changes
+	if err := os.WriteFile(pub, []byte("not a key"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verify.Image(policy, signed); err != nil {
+		t.Errorf("recorded policy failed after the key file changed: %v", err)
+	}
+}
+
+func TestPin(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "cosign.pub")
+	const key = "-----BEGIN PUBLIC KEY-----\nMFkw\n-----END PUBLIC KEY-----\n"
+	if err := os.WriteFile(keyFile, []byte(key), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	keyless := &config.VerifyPolicy{Identity: "ci@example.com", Issuer: "https://issuer.example.com", Mode: config.VerifyWarn}
+
+	tests := []struct {
+		name   string
+		policy *config.VerifyPolicy
+		want   *config.VerifyPolicy
+	}{
+		{name: "none"},
+		{name: "key file", policy: &config.VerifyPolicy{Key: keyFile, Attestation: "slsaprovenance"}, want: &config.VerifyPolicy{Key: key, Attestation: "slsaprovenance"}},
+		{name: "inline key", policy: &config.VerifyPolicy{Key: key}, want: &config.VerifyPolicy{Key: key}},
+		{name: "keyless", policy: keyless, want: keyless},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verify.Pin(tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("Pin() = %+v, want %+v", got, tt.want)
+			}
+			if got != nil && got == tt.policy {
+				t.Errorf("Pin() returned the policy, not a copy")
+			}
+		})
+	}
+
+	if _, err := verify.Pin(&config.VerifyPolicy{Key: filepath.Join(dir, "missing.pub")}); err == nil {
+		t.Errorf("Pin() of a missing key file succeeded")
+	}
+}
+
+func TestImageUsesRecordedKey(t *testing.T) {
+	// A fake cosign accepting only the recorded key shows which key is checked
+	bin := t.TempDir()
+	script := "#!/bin/sh\n" +
+		"while [ $# -gt 0 ]; do if [ \"$1\" = --key ]; then grep -q recorded \"$2\" && exit 0; fi; shift; done\n" +
+		"echo 'Error: no matching signatures' >&2; exit 1\n"
+	if err := os.WriteFile(filepath.Join(bin, "cosign"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("SMP_COSIGN_ARGS", "")
+
+	keyFile := filepath.Join(t.TempDir(), "cosign.pub")
+	if err := os.WriteFile(keyFile, []byte("-----BEGIN PUBLIC KEY-----\nrecorded\n-----END PUBLIC KEY-----\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := verify.Pin(&config.VerifyPolicy{Key: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Swapping the key file after install doesn't change what is verified
+	if err := os.WriteFile(keyFile, []byte("-----BEGIN PUBLIC KEY-----\nswapped\n-----END PUBLIC KEY-----\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verify.Image(policy, "registry.example.com/mcp@sha256:abc"); err != nil {
+		t.Errorf("recorded key not used: %v", err)
+	}
+	if err := verify.Image(&config.VerifyPolicy{Key: keyFile}, "registry.example.com/mcp@sha256:abc"); !errors.Is(err, verify.ErrUnverified) {
+		t.Errorf("swapped key verified: %v", err)
+	}
+}
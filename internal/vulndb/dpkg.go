@@ -0,0 +1,93 @@
+package vulndb
+
+import "strings"
+
+// compareDpkg compares Debian package versions of the form
+// [epoch:]upstream[-revision] as dpkg does
+func compareDpkg(a, b string) int {
+	epochA, upstreamA, revisionA := splitDpkg(a)
+	epochB, upstreamB, revisionB := splitDpkg(b)
+
+	if c := compareNumbers(epochA, epochB); c != 0 {
+		return c
+	}
+	if c := verrevcmp(upstreamA, upstreamB); c != 0 {
+		return c
+	}
+	return verrevcmp(revisionA, revisionB)
+}
+
+// splitDpkg splits a version into its epoch, upstream version and revision. The
+// epoch ends at the first colon and the revision starts after the last hyphen.
+func splitDpkg(version string) (string, string, string) {
+	epoch := "0"
+	if i := strings.Index(version, ":"); i >= 0 {
+		epoch, version = version[:i], version[i+1:]
+	}
+	revision := ""
+	if i := strings.LastIndex(version, "-"); i >= 0 {
+		version, revision = version[:i], version[i+1:]
+	}
+	return epoch, version, revision
+}
+
+// verrevcmp compares upstream versions or revisions as dpkg does: alternating
+// runs of non-digits, compared character by character, and of digits, compared
+// numerically. Letters sort before other characters, and a tilde before
+// everything, even the end of the version, so 1.0~rc1 is lower than 1.0.
+func verrevcmp(a, b string) int {
+	for a != "" || b != "" {
+		for (a != "" && !isDigit(a[0])) || (b != "" && !isDigit(b[0])) {
+			if c := compareInts(dpkgOrder(a), dpkgOrder(b)); c != 0 {
+				return c
+			}
+			a, b = rest(a), rest(b)
+		}
+
+		a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		i, j := digits(a), digits(b)
+		if c := compareNumbers(a[:i], b[:j]); c != 0 {
+			return c
+		}
+		a, b = a[i:], b[j:]
+	}
+	return 0
+}
+
+// dpkgOrder returns the weight of the first character of s in a comparison of
+// non-digit runs, the end of s and digits weighing nothing
+func dpkgOrder(s string) int {
+	switch {
+	case s == "" || isDigit(s[0]):
+		return 0
+	case s[0] == '~':
+		return -1
+	case isLetter(s[0]):
+		return int(s[0])
+	}
+	return int(s[0]) + 256
+}
+
+func rest(s string) string {
+	if s == "" {
+		return s
+	}
+	return s[1:]
+}
+
+// digits returns the length of the run of digits s starts with
+func digits(s string) int {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return i
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
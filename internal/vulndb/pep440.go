@@ -0,0 +1,146 @@
+package vulndb
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// pep440Pattern matches the versions PEP 440 defines, including the alternative
+// spellings it normalizes
+var pep440Pattern = regexp.MustCompile(`^v?` +
+	`(?:(\d+)!)?` +
+	`(\d+(?:\.\d+)*)` +
+	`(?:[-_.]?(a|b|c|rc|alpha|beta|pre|preview)[-_.]?(\d*))?` +
+	`(?:-(\d+)|[-_.]?(post|rev|r)[-_.]?(\d*))?` +
+	`(?:[-_.]?(dev)[-_.]?(\d*))?` +
+	`(?:\+([a-z0-9]+(?:[-_.][a-z0-9]+)*))?$`)
+
+// prePhases orders the pre-release phases, with their alternative spellings
+var prePhases = map[string]int{"a": 0, "alpha": 0, "b": 1, "beta": 1, "c": 2, "rc": 2, "pre": 2, "preview": 2}
+
+// pep440 is a version broken into the parts PEP 440 orders versions by
+type pep440 struct {
+	epoch   int
+	release []int
+
+	// pre is the phase and number of a pre-release, post and dev the numbers
+	// of a post and development release. Missing parts are set to sort as PEP
+	// 440 specifies: 1.0.dev0 < 1.0a1 < 1.0 < 1.0.post1.
+	pre  [2]int
+	post int
+	dev  int
+
+	local []string
+}
+
+// comparePEP440 compares Python package versions as PEP 440 specifies. Versions
+// that aren't valid PEP 440 versions compare by their segments.
+func comparePEP440(a, b string) int {
+	va, okA := parsePEP440(a)
+	vb, okB := parsePEP440(b)
+	if !okA || !okB {
+		return compareSegments(a, b)
+	}
+
+	if c := compareInts(va.epoch, vb.epoch); c != 0 {
+		return c
+	}
+	for i := 0; i < len(va.release) || i < len(vb.release); i++ {
+		if c := compareInts(release(va.release, i), release(vb.release, i)); c != 0 {
+			return c
+		}
+	}
+	for i := range va.pre {
+		if c := compareInts(va.pre[i], vb.pre[i]); c != 0 {
+			return c
+		}
+	}
+	if c := compareInts(va.post, vb.post); c != 0 {
+		return c
+	}
+	if c := compareInts(va.dev, vb.dev); c != 0 {
+		return c
+	}
+	return compareLocal(va.local, vb.local)
+}
+
+func parsePEP440(version string) (pep440, bool) {
+	m := pep440Pattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(version)))
+	if m == nil {
+		return pep440{}, false
+	}
+
+	var v pep440
+	v.epoch = number(m[1])
+	for _, n := range strings.Split(m[2], ".") {
+		v.release = append(v.release, number(n))
+	}
+
+	switch {
+	case m[3] != "":
+		v.pre = [2]int{prePhases[m[3]], number(m[4])}
+	case m[8] != "" && m[5] == "" && m[6] == "":
+		// A development release of a release sorts before its pre-releases
+		v.pre = [2]int{math.MinInt, 0}
+	default:
+		v.pre = [2]int{math.MaxInt, 0}
+	}
+
+	switch {
+	case m[5] != "":
+		v.post = number(m[5])
+	case m[6] != "":
+		v.post = number(m[7])
+	default:
+		v.post = math.MinInt
+	}
+
+	v.dev = math.MaxInt
+	if m[8] != "" {
+		v.dev = number(m[9])
+	}
+
+	if m[10] != "" {
+		v.local = strings.FieldsFunc(m[10], func(r rune) bool { return r == '-' || r == '_' || r == '.' })
+	}
+	return v, true
+}
+
+// compareLocal compares local version labels: a version without one is lower,
+// numeric segments compare numerically and sort after alphanumeric ones
+func compareLocal(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		numA, numB := digits(a[i]) == len(a[i]), digits(b[i]) == len(b[i])
+		var c int
+		switch {
+		case numA && numB:
+			c = compareNumbers(a[i], b[i])
+		case numA:
+			c = 1
+		case numB:
+			c = -1
+		default:
+			c = strings.Compare(a[i], b[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(a), len(b))
+}
+
+// release returns the i-th number of a release, 0 past its end
+func release(numbers []int, i int) int {
+	if i < len(numbers) {
+		return numbers[i]
+	}
+	return 0
+}
+
+// number parses a run of digits, 0 if empty or too large
+func number(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
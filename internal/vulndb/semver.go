@@ -0,0 +1,78 @@
+package vulndb
+
+import "strings"
+
+// compareSemver compares semantic versions, as npm and Go modules use them, with
+// an optional leading v. Build metadata is ignored and a pre-release is lower
+// than its release. Versions that aren't semantic compare by their segments.
+func compareSemver(a, b string) int {
+	coreA, preA, okA := parseSemver(a)
+	coreB, preB, okB := parseSemver(b)
+	if !okA || !okB {
+		return compareSegments(a, b)
+	}
+
+	for i := 0; i < len(coreA) || i < len(coreB); i++ {
+		if c := compareNumbers(field(coreA, i), field(coreB, i)); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case preA == "" && preB == "":
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	}
+	return comparePrerelease(strings.Split(preA, "."), strings.Split(preB, "."))
+}
+
+// parseSemver splits a version into the numbers of its core and its
+// pre-release, dropping build metadata
+func parseSemver(version string) ([]string, string, bool) {
+	version = strings.TrimPrefix(version, "v")
+	version, _, _ = strings.Cut(version, "+")
+	core, pre, _ := strings.Cut(version, "-")
+
+	numbers := strings.Split(core, ".")
+	for _, n := range numbers {
+		if n == "" || digits(n) != len(n) {
+			return nil, "", false
+		}
+	}
+	return numbers, pre, true
+}
+
+// comparePrerelease compares dot separated pre-release identifiers: numeric ones
+// numerically and lower than alphanumeric ones, which compare in ASCII order,
+// and a shorter list lower than a longer one it starts
+func comparePrerelease(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		numA, numB := a[i] != "" && digits(a[i]) == len(a[i]), b[i] != "" && digits(b[i]) == len(b[i])
+		var c int
+		switch {
+		case numA && numB:
+			c = compareNumbers(a[i], b[i])
+		case numA:
+			c = -1
+		case numB:
+			c = 1
+		default:
+			c = strings.Compare(a[i], b[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(a), len(b))
+}
+
+// field returns the i-th number of a version core, 0 past its end
+func field(numbers []string, i int) string {
+	if i < len(numbers) {
+		return numbers[i]
+	}
+	return "0"
+}
@@ -0,0 +1,150 @@
+package vulndb
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/lvrach/smp/internal/sbom"
+)
+
+// postRelease are words that make a version sort after the release they follow,
+// e.g. 1.0.post1 after 1.0, while other words mark pre-releases, e.g. 1.0.0-rc1
+// before 1.0.0
+var postRelease = map[string]bool{"post": true, "p": true, "pl": true, "patch": true, "r": true}
+
+// Compare compares two versions of a package of an ecosystem as OSV names it,
+// e.g. Debian:12, returning -1, 0 or 1. Debian and Ubuntu versions compare as
+// dpkg does, npm and Go versions as semantic versions and PyPI versions as PEP
+// 440 specifies. Versions of other ecosystems, and versions not valid in theirs,
+// compare by their segments.
+func Compare(ecosystem, a, b string) int {
+	base, _, _ := strings.Cut(ecosystem, ":")
+	switch base {
+	case sbom.EcosystemDebian, sbom.EcosystemUbuntu:
+		return compareDpkg(a, b)
+	case sbom.EcosystemNPM, sbom.EcosystemGo:
+		return compareSemver(a, b)
+	case sbom.EcosystemPyPI:
+		return comparePEP440(a, b)
+	}
+	return compareSegments(a, b)
+}
+
+// compareSegments compares versions split into numeric and alphabetic segments:
+// numbers compare numerically, words lexically, and a version followed by a
+// pre-release word is lower than the version alone. Epochs (1:2.0) and a
+// leading v are understood.
+func compareSegments(a, b string) int {
+	epochA, restA := epoch(a)
+	epochB, restB := epoch(b)
+	if epochA != epochB {
+		if epochA < epochB {
+			return -1
+		}
+		return 1
+	}
+
+	sa, sb := segments(restA), segments(restB)
+	for i := 0; i < len(sa) || i < len(sb); i++ {
+		switch {
+		case i >= len(sa):
+			return -tail(sb[i])
+		case i >= len(sb):
+			return tail(sa[i])
+		}
+
+		if c := compareSegment(sa[i], sb[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// tail returns how a version compares to itself without the remaining segment
+// starting with s: pre-release words make it lower, numbers and post-release
+// words higher
+func tail(s string) int {
+	if isNumber(s) || postRelease[strings.ToLower(s)] {
+		return 1
+	}
+	return -1
+}
+
+func compareSegment(a, b string) int {
+	numA, numB := isNumber(a), isNumber(b)
+	switch {
+	case numA && numB:
+		return compareNumbers(a, b)
+	case numA:
+		return 1
+	case numB:
+		return -1
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+// compareNumbers compares strings of digits of any length numerically
+func compareNumbers(a, b string) int {
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// epoch splits the epoch from a version, 0 if it has none
+func epoch(version string) (int, string) {
+	if i := strings.Index(version, ":"); i > 0 {
+		if n, err := strconv.Atoi(version[:i]); err == nil {
+			return n, version[i+1:]
+		}
+	}
+	return 0, version
+}
+
+// segments splits a version into runs of digits and of letters, dropping
+// separators and a leading v
+func segments(version string) []string {
+	version = strings.TrimPrefix(strings.TrimPrefix(version, "v"), "V")
+
+	var parts []string
+	var current strings.Builder
+	digits := false
+	for _, r := range version {
+		if !unicode.IsDigit(r) && !unicode.IsLetter(r) {
+			if current.Len() > 0 {
+				parts = append(parts, current.String())
+				current.Reset()
+			}
+			continue
+		}
+		if current.Len() > 0 && unicode.IsDigit(r) != digits {
+			parts = append(parts, current.String())
+			current.Reset()
+		}
+		digits = unicode.IsDigit(r)
+		current.WriteRune(r)
+	}
+	if current.Len() > 0 {
+		parts = append(parts, current.String())
+	}
+	return parts
+}
+
+func isNumber(s string) bool {
+	return s != "" && unicode.IsDigit(rune(s[0]))
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
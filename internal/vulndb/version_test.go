@@ -0,0 +1,68 @@
+package vulndb_test
+
+import (
+	"testing"
+
+	"github.com/lvrach/smp/internal/vulndb"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		ecosystem string
+		a, b      string
+		want      int
+	}{
+		// dpkg
+		{"Debian:12", "7.88.1-10", "7.88.1-10+deb12u5", -1},
+		{"Debian:12", "7.88.1-10+deb12u5", "7.88.1-10+deb12u12", -1},
+		{"Debian:12", "1.0~rc1-1", "1.0-1", -1},
+		{"Debian:12", "1.0~~", "1.0~", -1},
+		{"Debian:12", "1.0", "1.0a", -1},
+		{"Debian:12", "1.0a", "1.0+", -1},
+		{"Debian:12", "1:1.0-1", "2.0-1", 1},
+		{"Debian:12", "2.36-9+deb12u4", "2.36-9+deb12u4", 0},
+		{"Debian:12", "1.2.3-01", "1.2.3-1", 0},
+		{"Debian:12", "1.0-1-2", "1.0-1-10", -1},
+		{"Ubuntu:22.04", "1.0-1ubuntu1", "1.0-1", 1},
+		{"Ubuntu:22.04", "3.0.2-0ubuntu1.10", "3.0.2-0ubuntu1.9", 1},
+
+		// semver
+		{"npm", "1.2.3", "1.2.10", -1},
+		{"npm", "1.0.0-rc.1", "1.0.0", -1},
+		{"npm", "1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"npm", "1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"npm", "1.0.0-beta.2", "1.0.0-beta.11", -1},
+		{"npm", "1.0.0-rc.1", "1.0.0-beta.11", 1},
+		{"npm", "1.0.0+build.1", "1.0.0+build.2", 0},
+		{"Go", "v0.0.0-20230101000000-abcdef123456", "v0.1.0", -1},
+		{"Go", "v1.21.5", "v1.21.13", -1},
+
+		// PEP 440
+		{"PyPI", "1.0.dev0", "1.0a1", -1},
+		{"PyPI", "1.0a1", "1.0b1", -1},
+		{"PyPI", "1.0b1", "1.0rc1", -1},
+		{"PyPI", "1.0rc1", "1.0", -1},
+		{"PyPI", "1.0", "1.0.post1", -1},
+		{"PyPI", "1.0.post1.dev1", "1.0.post1", -1},
+		{"PyPI", "1.0a1.dev1", "1.0a1", -1},
+		{"PyPI", "1.0", "1.0.0", 0},
+		{"PyPI", "1.0-1", "1.0.post1", 0},
+		{"PyPI", "1.0RC1", "1.0rc1", 0},
+		{"PyPI", "1.0", "1.0+local", -1},
+		{"PyPI", "1.0+abc", "1.0+5", -1},
+		{"PyPI", "1!0.1", "2.0", 1},
+
+		// Other ecosystems
+		{"Alpine:v3.19", "3.1.4-r5", "3.1.4-r6", -1},
+		{"Alpine:v3.19", "1.36.1-r15", "1.36.1-r2", 1},
+	}
+
+	for _, tt := range tests {
+		if got := vulndb.Compare(tt.ecosystem, tt.a, tt.b); got != tt.want {
+			t.Errorf("Compare(%q, %q, %q) = %d, want %d", tt.ecosystem, tt.a, tt.b, got, tt.want)
+		}
+		if got := vulndb.Compare(tt.ecosystem, tt.b, tt.a); got != -tt.want {
+			t.Errorf("Compare(%q, %q, %q) = %d, want %d", tt.ecosystem, tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
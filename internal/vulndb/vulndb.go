@@ -0,0 +1,300 @@
+package vulndb
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lvrach/smp/internal/sbom"
+)
+
+// Vulnerability is an advisory in the OSV format, see https://ossf.github.io/osv-schema/
+type Vulnerability struct {
+	ID       string     `json:"id"`
+	Summary  string     `json:"summary"`
+	Aliases  []string   `json:"aliases"`
+	Affected []Affected `json:"affected"`
+
+	DatabaseSpecific struct {
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+}
+
+// Affected lists the versions of a package a vulnerability affects
+type Affected struct {
+	Package struct {
+		Ecosystem string `json:"ecosystem"`
+		Name      string `json:"name"`
+	} `json:"package"`
+	Ranges   []Range  `json:"ranges"`
+	Versions []string `json:"versions"`
+}
+
+// Range is a sequence of events introducing and fixing a vulnerability
+type Range struct {
+	Type   string  `json:"type"`
+	Events []Event `json:"events"`
+}
+
+// Event is a version at which a range starts or stops affecting a package
+type Event struct {
+	Introduced   string `json:"introduced,omitempty"`
+	Fixed        string `json:"fixed,omitempty"`
+	LastAffected string `json:"last_affected,omitempty"`
+	Limit        string `json:"limit,omitempty"`
+}
+
+// Finding is a vulnerability affecting a package of an SBOM
+type Finding struct {
+	Package       sbom.Package
+	Vulnerability *Vulnerability
+
+	// Lowest version fixing the vulnerability, empty if no fix is known
+	Fixed string
+}
+
+// Database is an offline vulnerability database indexed by package
+type Database struct {
+	byPackage map[string][]*Vulnerability
+	count     int
+}
+
+// Load reads OSV advisories from a JSON file holding one advisory or an array of
+// them, a directory of such files, or a zip archive as exported by osv.dev
+func Load(path string) (*Database, error) {
+	db := &Database{byPackage: make(map[string][]*Vulnerability)}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open vulnerability database: %w", err)
+	}
+
+	switch {
+	case info.IsDir():
+		err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || filepath.Ext(file) != ".json" {
+				return err
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			return db.add(file, data)
+		})
+	case filepath.Ext(path) == ".zip":
+		err = db.loadZip(path)
+	default:
+		var data []byte
+		data, err = os.ReadFile(path)
+		if err == nil {
+			err = db.add(path, data)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load vulnerability database: %w", err)
+	}
+
+	return db, nil
+}
+
+// Len returns the number of advisories in the database
+func (db *Database) Len() int {
+	return db.count
+}
+
+func (db *Database) loadZip(path string) error {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if filepath.Ext(f.Name) != ".json" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		if err := db.add(f.Name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add indexes the advisories of a file
+func (db *Database) add(file string, data []byte) error {
+	var vulns []*Vulnerability
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "[") {
+		if err := json.Unmarshal(data, &vulns); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	} else {
+		var vuln Vulnerability
+		if err := json.Unmarshal(data, &vuln); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		vulns = append(vulns, &vuln)
+	}
+
+	for _, vuln := range vulns {
+		db.count++
+		indexed := make(map[string]bool)
+		for _, affected := range vuln.Affected {
+			key := packageKey(affected.Package.Ecosystem, affected.Package.Name)
+			if !indexed[key] {
+				db.byPackage[key] = append(db.byPackage[key], vuln)
+				indexed[key] = true
+			}
+		}
+	}
+	return nil
+}
+
+// Match returns the vulnerabilities affecting the packages, ordered by package
+func (db *Database) Match(packages []sbom.Package) []Finding {
+	var findings []Finding
+	for _, p := range packages {
+		seen := make(map[string]bool)
+		for _, ecosystem := range []string{p.OSVEcosystem(), p.Ecosystem} {
+			for _, vuln := range db.byPackage[packageKey(ecosystem, p.Name)] {
+				if seen[vuln.ID] {
+					continue
+				}
+				if fixed, ok := vuln.affects(ecosystem, p); ok {
+					findings = append(findings, Finding{Package: p, Vulnerability: vuln, Fixed: fixed})
+					seen[vuln.ID] = true
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Package.Name != findings[j].Package.Name {
+			return findings[i].Package.Name < findings[j].Package.Name
+		}
+		return findings[i].Vulnerability.ID < findings[j].Vulnerability.ID
+	})
+	return findings
+}
+
+// affects reports whether the vulnerability affects the package's version, and
+// the version fixing it
+func (v *Vulnerability) affects(ecosystem string, p sbom.Package) (string, bool) {
+	for _, affected := range v.Affected {
+		if packageKey(affected.Package.Ecosystem, affected.Package.Name) != packageKey(ecosystem, p.Name) {
+			continue
+		}
+
+		for _, version := range affected.Versions {
+			if version == p.Version {
+				return fixedVersion(ecosystem, affected.Ranges, p.Version), true
+			}
+		}
+
+		for _, r := range affected.Ranges {
+			if r.Type == "GIT" {
+				continue
+			}
+			if r.contains(ecosystem, p.Version) {
+				return fixedVersion(ecosystem, affected.Ranges, p.Version), true
+			}
+		}
+	}
+	return "", false
+}
+
+// contains evaluates the range's events in version order, as the OSV schema
+// specifies
+func (r Range) contains(ecosystem, version string) bool {
+	compare := r.comparator(ecosystem)
+	events := append([]Event(nil), r.Events...)
+	sort.SliceStable(events, func(i, j int) bool {
+		return compare(events[i].version(), events[j].version()) < 0
+	})
+
+	affected := false
+	for _, e := range events {
+		switch {
+		case e.Introduced != "":
+			if e.Introduced == "0" || compare(version, e.Introduced) >= 0 {
+				affected = true
+			}
+		case e.Fixed != "":
+			if compare(version, e.Fixed) >= 0 {
+				affected = false
+			}
+		case e.LastAffected != "":
+			if compare(version, e.LastAffected) > 0 {
+				affected = false
+			}
+		case e.Limit != "":
+			if compare(version, e.Limit) >= 0 {
+				affected = false
+			}
+		}
+	}
+	return affected
+}
+
+// comparator returns how the range orders versions: SEMVER ranges as semantic
+// versions, others as the ecosystem does
+func (r Range) comparator(ecosystem string) func(a, b string) int {
+	if r.Type == "SEMVER" {
+		return compareSemver
+	}
+	return func(a, b string) int {
+		return Compare(ecosystem, a, b)
+	}
+}
+
+func (e Event) version() string {
+	switch {
+	case e.Introduced != "":
+		return e.Introduced
+	case e.Fixed != "":
+		return e.Fixed
+	case e.LastAffected != "":
+		return e.LastAffected
+	}
+	return e.Limit
+}
+
+// fixedVersion returns the lowest fix above version in any of the ranges
+func fixedVersion(ecosystem string, ranges []Range, version string) string {
+	var fixed string
+	for _, r := range ranges {
+		compare := r.comparator(ecosystem)
+		for _, e := range r.Events {
+			if e.Fixed == "" || compare(e.Fixed, version) <= 0 {
+				continue
+			}
+			if fixed == "" || compare(e.Fixed, fixed) < 0 {
+				fixed = e.Fixed
+			}
+		}
+	}
+	return fixed
+}
+
+// packageKey indexes advisories by ecosystem and package name, with Python
+// names normalized as PyPI compares them
+func packageKey(ecosystem, name string) string {
+	if ecosystem == sbom.EcosystemPyPI {
+		name = strings.NewReplacer("_", "-", ".", "-").Replace(strings.ToLower(name))
+	}
+	return ecosystem + "|" + name
+}
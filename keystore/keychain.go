@@ -68,3 +68,16 @@ func (*KeyChain) Retrieve(accountKey AccountType) (string, error) {
 	}
 	return string(results[0].Data), nil
 }
+
+func (*KeyChain) Delete(accountKey AccountType) error {
+	query := keychain.NewItem()
+	query.SetSecClass(keychain.SecClassGenericPassword)
+	query.SetService(service)
+	query.SetAccount(string(accountKey))
+
+	err := keychain.DeleteItem(query)
+	if err != nil && err != keychain.ErrorItemNotFound {
+		return fmt.Errorf("delete API key: %w", err)
+	}
+	return nil
+}
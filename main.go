@@ -13,13 +13,26 @@ func main() {
 		Name:        "smp",
 		Usage:       "Secure MCP Manager",
 		Description: "SMP is a tool for managing MCPs. ",
+		Flags:       commands.GlobalFlags(),
 		Commands: []*cli.Command{
 			commands.InstallCommand(),
 			commands.UninstallCommand(),
+			commands.ConfigureCommand(),
+			commands.UpgradeCommand(),
+			commands.RollbackCommand(),
 			commands.BuildCommand(),
 			commands.RunCommand(),
+			commands.ApproveCommand(),
+			commands.ToolsCommand(),
 			commands.ListCommand(),
+			commands.SearchCommand(),
+			commands.ShowCommand(),
 			commands.HostCommand(),
+			commands.SourceCommand(),
+			commands.GitCommand(),
+			commands.DefinitionCommand(),
+			commands.ApplyCommand(),
+			commands.AuditCommand(),
 		},
 	}
 